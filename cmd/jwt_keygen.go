@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/secure-notes/internal/security"
+	"github.com/spf13/cobra"
+)
+
+var jwtKeygenCmd = &cobra.Command{
+	Use:   "jwt-keygen",
+	Short: "generate a JWT signing key",
+	Long: `Writes <kid>.pem (private) and <kid>.pub.pem (public) into --dir.
+
+To rotate, generate a new key, point JWT_KEY_ID at it and restart. Keep the
+old <kid>.pub.pem in JWT_KEY_DIR until tokens signed with it have expired;
+its private key can be deleted once it is no longer current.
+
+Once JWT_KEY_DIR is set, HS256 tokens signed with JWT_SECRET are refused. To
+let tokens issued before the switch run out instead, set
+JWT_LEGACY_HS256_UNTIL to an RFC 3339 time at least JWT_TTL_MINUTES ahead and
+remove it once that time has passed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		alg, _ := cmd.Flags().GetString("alg")
+		kid, _ := cmd.Flags().GetString("kid")
+		dir, _ := cmd.Flags().GetString("dir")
+		if kid == "" {
+			kid = time.Now().UTC().Format("20060102-150405")
+		}
+
+		priv, pub, err := security.GenerateSigningKeyPEM(alg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = os.MkdirAll(dir, 0o700); err != nil {
+			log.Fatal(err)
+		}
+		privPath := filepath.Join(dir, kid+".pem")
+		if _, err = os.Stat(privPath); err == nil {
+			log.Fatalf("%s already exists", privPath)
+		}
+		if err = os.WriteFile(privPath, priv, 0o600); err != nil {
+			log.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, kid+".pub.pem"), pub, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("generated %s key %q in %s; set JWT_KEY_ID=%s to sign with it\n", alg, kid, dir, kid)
+	},
+}
+
+func init() {
+	jwtKeygenCmd.Flags().String("alg", security.AlgEdDSA, "EdDSA or RS256")
+	jwtKeygenCmd.Flags().String("kid", "", "key id (defaults to a timestamp)")
+	jwtKeygenCmd.Flags().String("dir", "keys/jwt", "keyset directory")
+}
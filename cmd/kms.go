@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/secure-notes/internal/config"
+	"github.com/secure-notes/internal/security"
+	"github.com/spf13/cobra"
+)
+
+var kmsCmd = &cobra.Command{
+	Use:   "kms",
+	Short: "run a local stand-in for a remote KMS",
+	Long: `Serves the KMS wire format used by KEY_PROVIDER=kms on top of a local keyring,
+so the remote key path can be exercised without a cloud dependency.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		keyringPath, _ := cmd.Flags().GetString("keyring")
+		token := config.Load().Keys.KMSToken
+		if token == "" {
+			log.Fatal("KMS_TOKEN is required: the stand-in serves master key operations")
+		}
+
+		var (
+			keys security.KeyProvider
+			err  error
+		)
+		if keyringPath != "" {
+			keys, err = security.NewFileKeyProvider(keyringPath)
+		} else {
+			keys, err = security.NewEnvKeyProvider(os.Getenv)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("kms stand-in listening on %s", addr)
+		log.Fatal(http.ListenAndServe(addr, security.NewKMSHandler(keys, token)))
+	},
+}
+
+func init() {
+	kmsCmd.Flags().String("addr", ":8200", "listen address")
+	kmsCmd.Flags().String("keyring", "", "keyring file to serve (defaults to MASTER_KEY* env vars)")
+}
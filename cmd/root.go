@@ -25,4 +25,8 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(kmsCmd)
+	rootCmd.AddCommand(rotateKeysCmd)
+	rootCmd.AddCommand(jwtKeygenCmd)
+	rootCmd.AddCommand(setRoleCmd)
 }
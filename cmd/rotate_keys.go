@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	appDB "github.com/secure-notes/internal/app"
+	"github.com/secure-notes/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys",
+	Short: "rotate the master key and rewrap user data keys",
+	Long: `Rewraps every user's data key and two-factor secret under the current
+master key version.
+
+With --new-key the key provider first creates a new master key version
+(keyring file and KMS providers only; for the env provider add the new version
+to MASTER_KEYS and point MASTER_KEY_ID at it before running). --new-data-keys
+issues a fresh data key to every user and --reencrypt-notes moves note rows
+and note revisions onto each user's newest data key.
+
+Progress is checkpointed after every batch; running the command again resumes
+an interrupted job unless --restart is given. A resumed job keeps the options
+it was started with, so asking for more fails until --restart is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts service.RotationOptions
+		opts.NewMasterKey, _ = cmd.Flags().GetBool("new-key")
+		opts.NewDataKeys, _ = cmd.Flags().GetBool("new-data-keys")
+		opts.ReencryptNotes, _ = cmd.Flags().GetBool("reencrypt-notes")
+		opts.BatchSize, _ = cmd.Flags().GetInt("batch-size")
+		opts.Restart, _ = cmd.Flags().GetBool("restart")
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		rotation, err := appDB.NewKeyRotation(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		job, err := rotation.Run(ctx, opts, func(p service.RotationProgress) {
+			switch {
+			case p.Resumed:
+				fmt.Printf("resuming job %d at phase %s\n", p.JobID, p.Phase)
+			case p.Total > 0:
+				fmt.Printf("job %d: %s %d/%d\n", p.JobID, p.Phase, p.Processed, p.Total)
+			default:
+				fmt.Printf("job %d: %s %d\n", p.JobID, p.Phase, p.Processed)
+			}
+		})
+		if err != nil {
+			log.Fatalf("rotation job %d stopped at phase %s: %v", job.ID, job.Phase, err)
+		}
+		fmt.Printf("rotation job %d finished, data keys wrapped by %s\n", job.ID, job.MasterKeyID)
+	},
+}
+
+func init() {
+	rotateKeysCmd.Flags().Bool("new-key", false, "create a new master key version before rewrapping")
+	rotateKeysCmd.Flags().Bool("new-data-keys", false, "issue a fresh data key to every user")
+	rotateKeysCmd.Flags().Bool("reencrypt-notes", false, "re-encrypt notes and their revisions under each user's newest data key")
+	rotateKeysCmd.Flags().Int("batch-size", 500, "rows per batch")
+	rotateKeysCmd.Flags().Bool("restart", false, "start a new job even if an unfinished one exists")
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appDB "github.com/secure-notes/internal/app"
+	"github.com/secure-notes/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+var setRoleCmd = &cobra.Command{
+	Use:   "set-role <email> <user|admin>",
+	Short: "change a user's role",
+	Long: `Sets the role of the account registered with <email>. Use it to create the
+first administrator; later ones can be managed the same way. The user is
+signed out everywhere so their next token carries the new role.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		email, role := args[0], args[1]
+		if !domain.ValidRole(role) {
+			log.Fatalf("unknown role %q: want %s or %s", role, domain.RoleUser, domain.RoleAdmin)
+		}
+		ctx := context.Background()
+		svc, err := appDB.NewUserAdmin(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		uid, err := svc.UserIDByEmail(ctx, email)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = svc.SetRole(ctx, 0, uid, role); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("user %d (%s) is now %s\n", uid, email, role)
+	},
+}
@@ -2,29 +2,155 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/config"
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/oidc"
 	"github.com/secure-notes/internal/security"
-	"os"
+	"gorm.io/gorm"
+	"log"
 	"time"
 
 	"github.com/secure-notes/internal/handler"
 	apihttp "github.com/secure-notes/internal/http"
+	"github.com/secure-notes/internal/repository/cached"
+	"github.com/secure-notes/internal/repository/encrypted"
+	"github.com/secure-notes/internal/repository/memory"
 	p "github.com/secure-notes/internal/repository/postgres"
 	"github.com/secure-notes/internal/service"
 )
 
+const issuer = "secure-notes"
+
 func New(ctx context.Context) (*fiber.App, error) {
-	jwtm := security.NewJWTManager(os.Getenv("JWT_SECRET"), "secure-notes", time.Hour)
+	cfg := config.Load()
+	jwtm, err := NewJWTManager(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
 	db, err := p.NewDB(ctx)
 	if err != nil {
 		return nil, err
 	}
-	noteRepo := p.NewNoteRepo(db)
-	userRepo := p.NewUserRepo(db)
-	noteSvc := service.NewNoteService(noteRepo)
-	userSvc := service.NewUserAuth(userRepo, jwtm)
+	keys, err := NewKeyProvider(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := NewMailer(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	storedNotes := p.NewNoteRepo(db)
+	noteRepo := encrypted.NewNoteRepo(storedNotes, p.NewDataKeyRepo(db), keys)
+	userRepo := cached.NewUserRepo(p.NewUserRepo(db), cfg.Auth.RevocationCacheTTL)
+	revocations := p.NewRevocationRepo(db)
+	noteOpts := []service.NoteOption{
+		service.WithUserRepository(userRepo),
+		service.WithRevisionLimit(cfg.Notes.RevisionLimit),
+	}
+	if cfg.Auth.RequireVerifiedEmail {
+		noteOpts = append(noteOpts, service.WithVerifiedEmailRequired())
+	}
+	noteSvc := service.NewNoteService(noteRepo, noteOpts...)
+	authOpts := []service.AuthOption{
+		service.WithUncachedUsers(p.NewUserRepo(db)),
+		service.WithRefreshTokens(p.NewRefreshTokenRepo(db), cfg.Auth.RefreshTTL),
+		service.WithRevocation(cached.NewRevocationStore(revocations, cfg.Auth.RevocationCacheTTL)),
+		service.WithMFA(p.NewMFARepo(db), keys, issuer),
+		service.WithLoginThrottle(newLoginAttemptStore(cfg.Auth, db), service.DefaultLoginThrottlePolicy()),
+		service.WithMailer(p.NewOneTimeTokenRepo(db), mailer, cfg.Mail.BaseURL),
+		service.WithPersonalTokens(p.NewPersonalTokenRepo(db)),
+		service.WithSessions(cached.NewSessionRepo(p.NewSessionRepo(db), cfg.Auth.RevocationCacheTTL)),
+		service.WithPasswordPolicy(passwordPolicy(cfg.Auth)),
+	}
+	if cfg.OIDC.Issuer != "" {
+		provider := oidc.NewClient(oidc.Config{
+			IssuerURL:    cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		oidcRequests := p.NewOIDCAuthRequestRepo(db)
+		authOpts = append(authOpts, service.WithOIDC(provider, p.NewUserIdentityRepo(db), oidcRequests))
+		go service.NewExpiryPurger(oidcRequests).Run(ctx, cfg.Auth.ExpiredPurgeInterval, reportPurge("sign-on request purge", "requests"))
+	}
+	userSvc := service.NewUserAuth(userRepo, jwtm, authOpts...)
 	noteHandler := handler.NewHandler(noteSvc)
 	userHandler := handler.NewUserAuthHandler(userSvc)
-	app := apihttp.NewServer(noteHandler, userHandler, jwtm)
+	keysHandler := handler.NewKeysHandler(jwtm)
+	app := apihttp.NewServer(noteHandler, userHandler, keysHandler, userSvc)
+
+	purger := service.NewTrashPurger(storedNotes, cfg.Notes.TrashRetention)
+	go purger.Run(ctx, cfg.Notes.TrashPurgeInterval, reportPurge("trash purge", "notes"))
+	go service.NewExpiryPurger(revocations).Run(ctx, cfg.Auth.ExpiredPurgeInterval, reportPurge("revoked token purge", "entries"))
 	return app, nil
 }
+
+func reportPurge(job, rows string) func(int64, error) {
+	return func(purged int64, err error) {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("%s: %v", job, err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("%s: removed %d %s", job, purged, rows)
+		}
+	}
+}
+
+func passwordPolicy(cfg config.Auth) security.PasswordPolicy {
+	policy := security.DefaultPasswordPolicy()
+	policy.MinLength = cfg.PasswordMinLength
+	policy.MinEntropyBits = float64(cfg.PasswordMinEntropyBits)
+	return policy
+}
+
+func newLoginAttemptStore(cfg config.Auth, db *gorm.DB) domain.LoginAttemptStore {
+	if cfg.LoginAttemptStore == config.AttemptStoreMemory {
+		return memory.NewLoginAttemptStore()
+	}
+	return p.NewLoginAttemptRepo(db)
+}
+
+// NewJWTManager signs with the asymmetric keyset in JWT_KEY_DIR when one is
+// configured and falls back to HS256 with JWT_SECRET otherwise. With a
+// keyset, HS256 tokens are only accepted until JWT_LEGACY_HS256_UNTIL.
+func NewJWTManager(cfg config.Auth) (*security.JWTManager, error) {
+	if cfg.JWTKeyDir == "" {
+		return security.NewJWTManager(cfg.JWTSecret, issuer, cfg.AccessTTL), nil
+	}
+	keys, err := security.LoadSigningKeys(cfg.JWTKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	legacy := security.LegacyHS256{Secret: cfg.JWTSecret}
+	if cfg.JWTLegacyUntil != "" {
+		if legacy.Until, err = time.Parse(time.RFC3339, cfg.JWTLegacyUntil); err != nil {
+			return nil, fmt.Errorf("JWT_LEGACY_HS256_UNTIL: %w", err)
+		}
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("JWT_LEGACY_HS256_UNTIL is set but JWT_SECRET is empty")
+		}
+	}
+	return security.NewJWTManagerWithKeys(issuer, cfg.AccessTTL, cfg.JWTKeyID, keys, legacy)
+}
+
+// NewUserAdmin wires the account service for command-line administration.
+// It signs users out through the same stores the API checks.
+func NewUserAdmin(ctx context.Context) (*service.UserAuth, error) {
+	cfg := config.Load()
+	jwtm, err := NewJWTManager(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	db, err := p.NewDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewUserAuth(p.NewUserRepo(db), jwtm,
+		service.WithRefreshTokens(p.NewRefreshTokenRepo(db), cfg.Auth.RefreshTTL),
+		service.WithRevocation(p.NewRevocationRepo(db)),
+		service.WithSessions(p.NewSessionRepo(db))), nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/secure-notes/internal/config"
+	"github.com/secure-notes/internal/repository/encrypted"
+	p "github.com/secure-notes/internal/repository/postgres"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+// NewKeyProvider builds the master key provider selected by cfg.
+func NewKeyProvider(cfg config.Keys) (security.KeyProvider, error) {
+	switch cfg.Provider {
+	case config.KeyProviderEnv:
+		return security.NewEnvKeyProvider(os.Getenv)
+	case config.KeyProviderFile:
+		return security.NewFileKeyProvider(cfg.File)
+	case config.KeyProviderKMS:
+		if cfg.KMSURL == "" {
+			return nil, fmt.Errorf("KMS_URL is required for key provider %q", cfg.Provider)
+		}
+		return security.NewKMSClient(cfg.KMSURL, cfg.KMSToken), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", cfg.Provider)
+	}
+}
+
+// NewKeyRotation wires the rotate-keys job against the configured database
+// and key provider.
+func NewKeyRotation(ctx context.Context) (*service.KeyRotation, error) {
+	db, err := p.NewDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := NewKeyProvider(config.Load().Keys)
+	if err != nil {
+		return nil, err
+	}
+	notes := p.NewNoteRepo(db)
+	dataKeys := p.NewDataKeyRepo(db)
+	resealer := encrypted.NewNoteRepo(notes, dataKeys, keys)
+	return service.NewKeyRotation(keys, dataKeys, p.NewMFARepo(db), notes, resealer, p.NewKeyRotationRepo(db)), nil
+}
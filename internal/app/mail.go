@@ -0,0 +1,33 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/secure-notes/internal/config"
+	"github.com/secure-notes/internal/mail"
+)
+
+// NewMailer builds the mailer selected by cfg. The log driver prints to
+// stdout, reset links included, and is meant for local development only, so
+// there is no default: every deployment has to choose a driver.
+func NewMailer(cfg config.Mail) (mail.Mailer, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, fmt.Errorf("MAIL_DRIVER is required: smtp or file, or log for local development")
+	case config.MailDriverLog:
+		return mail.NewWriterMailer(os.Stdout), nil
+	case config.MailDriverFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("MAIL_FILE is required for mail driver %q", cfg.Driver)
+		}
+		return mail.NewFileMailer(cfg.File)
+	case config.MailDriverSMTP:
+		if cfg.SMTPAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR is required for mail driver %q", cfg.Driver)
+		}
+		return mail.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
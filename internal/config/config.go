@@ -1 +1,168 @@
 package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	KeyProviderEnv  = "env"
+	KeyProviderFile = "file"
+	KeyProviderKMS  = "kms"
+
+	AttemptStorePostgres = "postgres"
+	AttemptStoreMemory   = "memory"
+
+	MailDriverSMTP = "smtp"
+	MailDriverFile = "file"
+	MailDriverLog  = "log"
+)
+
+type Config struct {
+	Keys  Keys
+	Auth  Auth
+	Mail  Mail
+	OIDC  OIDC
+	Notes Notes
+}
+
+// Notes configures note storage.
+type Notes struct {
+	// TRASH_RETENTION_DAYS, default 30: how long deleted notes stay in the
+	// trash before they are removed for good.
+	TrashRetention time.Duration
+	// TRASH_PURGE_INTERVAL_MINUTES, default 60: how often expired notes are
+	// removed from the trash.
+	TrashPurgeInterval time.Duration
+	// NOTE_REVISION_LIMIT, default 100: how many revisions are kept per
+	// note; older ones are dropped as new ones are saved.
+	RevisionLimit int
+}
+
+// OIDC configures single sign-on. It is disabled unless OIDC_ISSUER is set.
+type OIDC struct {
+	Issuer       string // OIDC_ISSUER, provider URL serving /.well-known/openid-configuration
+	ClientID     string // OIDC_CLIENT_ID
+	ClientSecret string // OIDC_CLIENT_SECRET; empty for public clients
+	RedirectURL  string // OIDC_REDIRECT_URL, default APP_BASE_URL + /api/v1/auth/oidc/callback
+}
+
+// Mail configures outgoing email (password reset links and similar).
+type Mail struct {
+	Driver       string // MAIL_DRIVER, required: log (stdout, development only), file or smtp
+	File         string // MAIL_FILE, used by the file driver
+	SMTPAddr     string // SMTP_ADDR, host:port of the relay
+	SMTPUsername string // SMTP_USERNAME; auth is skipped when empty
+	SMTPPassword string // SMTP_PASSWORD
+	From         string // MAIL_FROM
+	BaseURL      string // APP_BASE_URL, prefix for links in emails
+}
+
+// Keys selects where master keys for note encryption come from.
+type Keys struct {
+	Provider string // KEY_PROVIDER: env (default), file or kms
+	File     string // KEYRING_FILE, used by the file provider
+	KMSURL   string // KMS_URL, used by the kms provider
+	KMSToken string // KMS_TOKEN, bearer token sent to the KMS
+}
+
+type Auth struct {
+	JWTSecret  string        // JWT_SECRET, HS256 secret for legacy tokens without a kid
+	JWTKeyDir  string        // JWT_KEY_DIR, PEM keyset; enables asymmetric signing when set
+	JWTKeyID   string        // JWT_KEY_ID, kid of the key used to sign new tokens
+	AccessTTL  time.Duration // JWT_TTL_MINUTES, default 60
+	RefreshTTL time.Duration // REFRESH_TTL_HOURS, default 720 (30 days)
+	// JWT_LEGACY_HS256_UNTIL, RFC 3339 time: with JWT_KEY_DIR set, HS256
+	// tokens signed with JWT_SECRET are accepted until then, and never when
+	// it is empty.
+	JWTLegacyUntil string
+	// REVOCATION_CACHE_SECONDS, default 30: how long an instance may miss a
+	// logout, session revocation or account change such as disabling it
+	// performed through another instance.
+	RevocationCacheTTL time.Duration
+	// EXPIRED_PURGE_INTERVAL_MINUTES, default 60: how often revocations of
+	// tokens that have expired anyway and unfinished single sign-ons are
+	// deleted.
+	ExpiredPurgeInterval time.Duration
+	// LOGIN_ATTEMPT_STORE: postgres (default) shares failed-login counters
+	// across instances; memory keeps them per process.
+	LoginAttemptStore string
+	// REQUIRE_VERIFIED_EMAIL, default false: block note creation until the
+	// account's email address is verified.
+	RequireVerifiedEmail bool
+	// PASSWORD_MIN_LENGTH, default 16, and PASSWORD_MIN_ENTROPY_BITS,
+	// default 50: the password policy for new passwords.
+	PasswordMinLength      int
+	PasswordMinEntropyBits int
+}
+
+func Load() Config {
+	baseURL := getenv("APP_BASE_URL", "http://localhost:3030")
+	return Config{
+		Auth: Auth{
+			JWTSecret:            os.Getenv("JWT_SECRET"),
+			JWTKeyDir:            os.Getenv("JWT_KEY_DIR"),
+			JWTKeyID:             os.Getenv("JWT_KEY_ID"),
+			JWTLegacyUntil:       os.Getenv("JWT_LEGACY_HS256_UNTIL"),
+			AccessTTL:            time.Duration(getenvInt("JWT_TTL_MINUTES", 60)) * time.Minute,
+			RefreshTTL:           time.Duration(getenvInt("REFRESH_TTL_HOURS", 720)) * time.Hour,
+			RevocationCacheTTL:   time.Duration(getenvInt("REVOCATION_CACHE_SECONDS", 30)) * time.Second,
+			ExpiredPurgeInterval: time.Duration(getenvInt("EXPIRED_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+			LoginAttemptStore:    getenv("LOGIN_ATTEMPT_STORE", AttemptStorePostgres),
+			RequireVerifiedEmail: getenvBool("REQUIRE_VERIFIED_EMAIL", false),
+
+			PasswordMinLength:      getenvInt("PASSWORD_MIN_LENGTH", 16),
+			PasswordMinEntropyBits: getenvInt("PASSWORD_MIN_ENTROPY_BITS", 50),
+		},
+		Mail: Mail{
+			Driver:       os.Getenv("MAIL_DRIVER"),
+			File:         os.Getenv("MAIL_FILE"),
+			SMTPAddr:     os.Getenv("SMTP_ADDR"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			From:         getenv("MAIL_FROM", "no-reply@localhost"),
+			BaseURL:      baseURL,
+		},
+		OIDC: OIDC{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  getenv("OIDC_REDIRECT_URL", baseURL+"/api/v1/auth/oidc/callback"),
+		},
+		Notes: Notes{
+			TrashRetention:     time.Duration(getenvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			TrashPurgeInterval: time.Duration(getenvInt("TRASH_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
+			RevisionLimit:      getenvInt("NOTE_REVISION_LIMIT", 100),
+		},
+		Keys: Keys{
+			Provider: getenv("KEY_PROVIDER", KeyProviderEnv),
+			File:     os.Getenv("KEYRING_FILE"),
+			KMSURL:   os.Getenv("KMS_URL"),
+			KMSToken: os.Getenv("KMS_TOKEN"),
+		},
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getenvBool(key string, fallback bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func getenvInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,18 @@
+package domain
+
+// Algorithms accepted for client-side encrypted notes.
+const (
+	AlgAES256GCM         = "AES-256-GCM"
+	AlgXChaCha20Poly1305 = "XChaCha20-Poly1305"
+)
+
+// ClientEncryption describes a note that was encrypted by the client before
+// upload. The server stores the ciphertext in Note.Content and never sees
+// the key; the metadata is returned untouched so the client can decrypt.
+type ClientEncryption struct {
+	Algorithm string           `json:"algorithm"`
+	Nonce     string           `json:"nonce"`
+	KDF       string           `json:"kdf,omitempty"`
+	KDFSalt   string           `json:"kdf_salt,omitempty"`
+	KDFParams map[string]int64 `json:"kdf_params,omitempty"`
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// DataKey is a per-user AES-256 key wrapped by a versioned master key.
+type DataKey struct {
+	ID          int64     `gorm:"primaryKey"`
+	UserID      int64     `gorm:"not null;index"`
+	MasterKeyID string    `gorm:"not null"`
+	WrappedKey  []byte    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
@@ -3,3 +3,12 @@ package domain
 import "errors"
 
 var ErrNoteNotFound = errors.New("note not found")
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ErrVersionConflict means the note changed since the caller read it.
+var ErrVersionConflict = errors.New("note was modified by another request")
+
+// ErrAccountSuspended is returned while an administrator's suspension is in
+// effect, both at sign-in and for tokens issued before it.
+var ErrAccountSuspended = errors.New("account is suspended")
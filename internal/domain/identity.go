@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider. The pair (Issuer, Subject) is stable even if the email changes.
+type UserIdentity struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null;index"`
+	Issuer    string    `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email     string    // email asserted by the provider when the link was made
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// OIDCAuthRequest is a login started with the provider and not yet finished.
+// Only the hash of the state parameter is stored; the nonce and PKCE verifier
+// never leave the server.
+type OIDCAuthRequest struct {
+	StateHash    string    `gorm:"primaryKey"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+}
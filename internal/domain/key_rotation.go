@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+const (
+	RotationPhaseRewrap     = "rewrap"
+	RotationPhaseMFASecrets = "mfa_secrets"
+	RotationPhaseDataKeys   = "data_keys"
+	RotationPhaseNotes      = "notes"
+	RotationPhaseRevisions  = "revisions"
+	RotationPhaseDone       = "done"
+)
+
+// KeyRotationJob checkpoints a rotate-keys run so it can resume after an
+// interruption. Cursor is the last row ID handled in the current phase.
+type KeyRotationJob struct {
+	ID             int64     `gorm:"primaryKey"`
+	MasterKeyID    string    `gorm:"not null"`
+	NewDataKeys    bool      `gorm:"not null"`
+	ReencryptNotes bool      `gorm:"not null"`
+	Phase          string    `gorm:"not null"`
+	Cursor         int64     `gorm:"not null"`
+	Processed      int64     `gorm:"not null"`
+	StartedAt      time.Time `gorm:"not null"`
+	UpdatedAt      time.Time `gorm:"not null"`
+	FinishedAt     *time.Time
+}
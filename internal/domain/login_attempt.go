@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// LoginAttempt counts recent failed logins for one throttling key, such as an
+// account or a client IP.
+type LoginAttempt struct {
+	Key           string    `gorm:"column:attempt_key;primaryKey"`
+	Failures      int       `gorm:"not null"`
+	LastFailureAt time.Time `gorm:"not null"`
+	BlockedUntil  *time.Time
+}
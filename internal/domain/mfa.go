@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// UserMFA holds a user's TOTP secret, wrapped by a master key. The row exists
+// from enrollment on; 2FA is only enforced once EnabledAt is set.
+type UserMFA struct {
+	UserID        int64  `gorm:"primaryKey"`
+	SecretKeyID   string `gorm:"not null"`
+	SecretWrapped []byte `gorm:"not null"`
+	// LastUsedStep is the last accepted TOTP time step; a code is never
+	// accepted twice.
+	LastUsedStep int64 `gorm:"not null;default:0"`
+	EnabledAt    *time.Time
+	CreatedAt    time.Time `gorm:"not null"`
+}
+
+func (UserMFA) TableName() string { return "user_mfa" }
+
+// RecoveryCode is a hashed single-use code that replaces a TOTP code when the
+// user has lost their authenticator.
+type RecoveryCode struct {
+	ID        int64  `gorm:"primaryKey"`
+	UserID    int64  `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
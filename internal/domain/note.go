@@ -3,9 +3,67 @@ package domain
 import "time"
 
 type Note struct {
-	ID        int64
-	Title     string
-	Content   string
-	UserID    int64
+	ID               int64
+	Title            string
+	Content          string
+	UserID           int64
+	KeyID            *int64            `json:"-"`               // data key that sealed Title/Content; nil for legacy plaintext rows
+	ClientEncryption *ClientEncryption `gorm:"serializer:json"` // set for zero-knowledge notes; Content is the opaque payload
+	// Tags are stored in the clear, in the tags and note_tags tables, so
+	// notes can be filtered by them; client-encrypted notes have none. On
+	// update, nil keeps the current tags.
+	Tags       []string `gorm:"-"`
+	IsArchived bool     `gorm:"not null;default:false"` // hidden from List unless asked for
+	// DeletedAt is set while the note is in the trash. Trashed notes are
+	// only reachable through the trash methods of NoteRepository.
+	DeletedAt *time.Time
+	// Version starts at 1 and goes up with every Update and SetArchived.
+	// It is served as the note's ETag. On Update and RemoveByID a non-zero
+	// value is the version the caller expects to replace.
+	Version   int64 `gorm:"not null;default:1"`
 	CreatedAt time.Time
 }
+
+// NoteRevision is an immutable copy of a note's title and content as saved
+// by one create or update. Like notes, revisions are stored sealed with a
+// data key of the owner, or as the client's ciphertext.
+type NoteRevision struct {
+	ID               int64
+	NoteID           int64
+	UserID           int64
+	Title            string
+	Content          string
+	KeyID            *int64            `json:"-"`
+	ClientEncryption *ClientEncryption `gorm:"serializer:json"`
+	CreatedAt        time.Time
+}
+
+// Tag is a label owned by one user; notes link to it through note_tags.
+type Tag struct {
+	ID     int64
+	UserID int64
+	Name   string
+}
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// ArchiveFilter selects notes by IsArchived.
+type ArchiveFilter int
+
+const (
+	ArchivedHidden  ArchiveFilter = iota // only notes that are not archived
+	ArchivedOnly                         // only archived notes
+	ArchivedInclude                      // both
+)
+
+// NoteFilter narrows NoteRepository.List. The zero value matches every note
+// that is not archived.
+type NoteFilter struct {
+	Tags []string
+	// MatchAllTags requires every tag in Tags; otherwise any one will do.
+	MatchAllTags bool
+	Archived     ArchiveFilter
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// One-time token purposes.
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeVerifyEmail   = "verify_email"
+)
+
+// OneTimeToken is a hashed, expiring token mailed to a user to prove they
+// control their address, e.g. for a password reset.
+type OneTimeToken struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null"`
+	Email     string    // address the token was mailed to, when it matters
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Scopes limit what a token may do. Personal access tokens can only be
+// granted the notes scopes; ScopeAccount (credentials, tokens, sessions) is
+// reserved for interactive sessions.
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeAccount    = "account"
+)
+
+// SessionScopes are granted to access tokens issued by Login.
+var SessionScopes = []string{ScopeAccount, ScopeNotesRead, ScopeNotesWrite}
+
+// PersonalAccessToken is a long-lived, named credential for scripts. Only the
+// hash is stored; Prefix lets users recognise a token in listings.
+type PersonalAccessToken struct {
+	ID         int64    `gorm:"primaryKey"`
+	UserID     int64    `gorm:"not null;index"`
+	Name       string   `gorm:"not null"`
+	Prefix     string   `gorm:"not null"`
+	TokenHash  string   `gorm:"not null;uniqueIndex"`
+	Scopes     []string `gorm:"serializer:json;not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time `gorm:"not null"`
+}
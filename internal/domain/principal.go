@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID    int64
+	TokenID   string // jti of the access token
+	SessionID string // sid of the access token
+	ExpiresAt time.Time
+	// PersonalTokenID is set when the caller used a personal access token
+	// instead of a session.
+	PersonalTokenID int64
+	Scopes          []string
+	Role            string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
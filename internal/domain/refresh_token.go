@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// RefreshToken is a single-use token that renews an access token. Tokens
+// issued from the same login share a FamilyID so replaying a used token can
+// revoke the whole chain.
+type RefreshToken struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null;index"`
+	FamilyID  string    `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
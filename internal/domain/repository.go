@@ -1,18 +1,210 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // NoteRepository
 type NoteRepository interface {
 	Create(ctx context.Context, note Note) (Note, error)
-	List(ctx context.Context, uid int64, limit, offset int) ([]Note, error)
-	Update(ctx context.Context, note Note) error
+	List(ctx context.Context, uid int64, filter NoteFilter, limit, offset int) ([]Note, error)
+	// Update bumps the version and returns the new one. When note.Version
+	// is set and the stored note has a different one, it returns
+	// ErrVersionConflict.
+	Update(ctx context.Context, note Note) (int64, error)
 	GetByID(ctx context.Context, noteID, uid int64) (Note, error)
-	RemoveByID(ctx context.Context, noteID, uid int64) error
+	// RemoveByID moves the note to the trash. A non-zero version is checked
+	// like in Update.
+	RemoveByID(ctx context.Context, noteID, uid, version int64) error
+	SetArchived(ctx context.Context, noteID, uid int64, archived bool) error
+	// ListDeleted returns the user's trash, most recently deleted first.
+	ListDeleted(ctx context.Context, uid int64, limit, offset int) ([]Note, error)
+	// Restore takes a note out of the trash.
+	Restore(ctx context.Context, noteID, uid int64) error
+	// DeletePermanently removes a note that is in the trash.
+	DeletePermanently(ctx context.Context, noteID, uid int64) error
+	// ListRevisions returns the revisions of a note, newest first. Create
+	// and Update each record one.
+	ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]NoteRevision, error)
+	GetRevision(ctx context.Context, noteID, revisionID, uid int64) (NoteRevision, error)
+	// PruneRevisions deletes all but the newest keep revisions of a note.
+	PruneRevisions(ctx context.Context, noteID, uid int64, keep int) error
+	// TagCounts returns the user's tags in name order with how many notes
+	// carry each. Tags no note uses are left out.
+	TagCounts(ctx context.Context, uid int64) ([]TagCount, error)
 }
 
 // UserRepository
 type UserRepository interface {
 	Register(ctx context.Context, user User) (User, error)
 	GetByEmail(ctx context.Context, email string) (User, error)
+	GetByID(ctx context.Context, uid int64) (User, error)
+	UpdatePasswordHash(ctx context.Context, uid int64, hash string) error
+	MarkEmailVerified(ctx context.Context, uid int64, at time.Time) error
+	// UpdateEmail changes the address and clears its verification.
+	UpdateEmail(ctx context.Context, uid int64, email string) error
+	// List returns users ordered by ID.
+	List(ctx context.Context, limit, offset int) ([]User, error)
+	SetRole(ctx context.Context, uid int64, role string) error
+	// SetDisabled disables the account at the given time, or enables it when nil.
+	SetDisabled(ctx context.Context, uid int64, at *time.Time) error
+	SetPasswordResetRequired(ctx context.Context, uid int64, required bool) error
+	// SetSuspended suspends the account until the given time, or lifts the
+	// suspension when nil.
+	SetSuspended(ctx context.Context, uid int64, until *time.Time) error
+	// Delete removes the user. Notes, keys, sessions and tokens go with it
+	// through ON DELETE CASCADE.
+	Delete(ctx context.Context, uid int64) error
+}
+
+// NoteMaintenanceRepository gives background jobs raw, cross-user access to
+// stored note rows without touching user-visible metadata.
+type NoteMaintenanceRepository interface {
+	ScanAll(ctx context.Context, afterID int64, limit int) ([]Note, error)
+	CountAll(ctx context.Context) (int64, error)
+	// Load reads one note row by ID, trashed or not.
+	Load(ctx context.Context, noteID int64) (Note, error)
+	// Rewrite stores a resealed note. It returns ErrVersionConflict when the
+	// stored version is no longer note.Version.
+	Rewrite(ctx context.Context, note Note) error
+	// PurgeDeletedBefore permanently removes up to limit notes that went to
+	// the trash before cutoff and returns how many it removed.
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+	// ScanRevisions, CountRevisions, LoadRevision and RewriteRevision do for
+	// the revisions of all notes what ScanAll, CountAll, Load and Rewrite do
+	// for notes. Revisions have no version, so RewriteRevision checks that
+	// the row is still sealed with fromKeyID instead.
+	ScanRevisions(ctx context.Context, afterID int64, limit int) ([]NoteRevision, error)
+	CountRevisions(ctx context.Context) (int64, error)
+	LoadRevision(ctx context.Context, revisionID int64) (NoteRevision, error)
+	RewriteRevision(ctx context.Context, rev NoteRevision, fromKeyID *int64) error
+}
+
+// DataKeyRepository
+type DataKeyRepository interface {
+	Create(ctx context.Context, key DataKey) (DataKey, error)
+	GetByID(ctx context.Context, keyID, uid int64) (DataKey, error)
+	Current(ctx context.Context, uid int64) (DataKey, error)
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]DataKey, error)
+	CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error)
+	UserIDsAfter(ctx context.Context, afterUID int64, limit int) ([]int64, error)
+	Rewrap(ctx context.Context, key DataKey) error
+}
+
+// KeyRotationRepository
+type KeyRotationRepository interface {
+	Create(ctx context.Context, job KeyRotationJob) (KeyRotationJob, error)
+	Unfinished(ctx context.Context) (KeyRotationJob, error)
+	Save(ctx context.Context, job KeyRotationJob) error
+}
+
+// RefreshTokenRepository
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token RefreshToken) (RefreshToken, error)
+	GetByHash(ctx context.Context, hash string) (RefreshToken, error)
+	// MarkUsed flags an unused token as used; it returns false if the token
+	// was already used, so concurrent redemptions cannot both succeed.
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, uid int64) error
+}
+
+// RevocationStore
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, uid int64, expiresAt time.Time) error
+	RevokeAllForUser(ctx context.Context, uid int64, before time.Time) error
+	IsRevoked(ctx context.Context, jti string, uid int64, issuedAt time.Time) (bool, error)
+}
+
+// MFARepository
+type MFARepository interface {
+	Get(ctx context.Context, uid int64) (UserMFA, error)
+	// Upsert stores a pending (not yet enabled) enrollment, replacing any
+	// earlier pending one.
+	Upsert(ctx context.Context, mfa UserMFA) error
+	Enable(ctx context.Context, uid int64, step int64) error
+	Delete(ctx context.Context, uid int64) error
+	// UseStep records step as used; it returns false if the same or a later
+	// step was already accepted, so a code cannot be replayed.
+	UseStep(ctx context.Context, uid int64, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, uid int64, hashes []string) error
+	// UseRecoveryCode marks an unused code as used and returns false if none matched.
+	UseRecoveryCode(ctx context.Context, uid int64, hash string) (bool, error)
+}
+
+// MFASecretRepository lets rotate-keys rewrap TOTP secrets, which are
+// wrapped by the master key directly rather than by a user's data key.
+type MFASecretRepository interface {
+	ListAfter(ctx context.Context, afterUID int64, limit int) ([]UserMFA, error)
+	CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error)
+	// Rewrap stores a rewrapped secret only while the row still holds
+	// fromWrapped, so a re-enrollment made meanwhile is kept. It returns
+	// gorm.ErrRecordNotFound when nothing matched.
+	Rewrap(ctx context.Context, mfa UserMFA, fromWrapped []byte) error
+}
+
+// LoginAttemptStore
+type LoginAttemptStore interface {
+	// Get returns the counter for key, or a zero LoginAttempt if there is none.
+	Get(ctx context.Context, key string) (LoginAttempt, error)
+	// Fail atomically counts a failure at now. Failures older than window are
+	// forgotten first, so counters decay without a cleanup job.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempt, error)
+	Block(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// OneTimeTokenRepository
+type OneTimeTokenRepository interface {
+	Create(ctx context.Context, token OneTimeToken) (OneTimeToken, error)
+	GetByHash(ctx context.Context, purpose, hash string) (OneTimeToken, error)
+	// Consume marks an unused token as used and returns false if it already
+	// was, so a token cannot be redeemed twice.
+	Consume(ctx context.Context, id int64) (bool, error)
+	// InvalidateForUser consumes every outstanding token of purpose for uid.
+	InvalidateForUser(ctx context.Context, uid int64, purpose string) error
+}
+
+// PersonalAccessTokenRepository
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token PersonalAccessToken) (PersonalAccessToken, error)
+	GetByHash(ctx context.Context, hash string) (PersonalAccessToken, error)
+	ListByUser(ctx context.Context, uid int64) ([]PersonalAccessToken, error)
+	// Delete returns gorm.ErrRecordNotFound if uid has no token with id.
+	Delete(ctx context.Context, id, uid int64) error
+	DeleteAllForUser(ctx context.Context, uid int64) error
+	Touch(ctx context.Context, id int64, at time.Time) error
+}
+
+// SessionRepository
+type SessionRepository interface {
+	Create(ctx context.Context, session Session) (Session, error)
+	Get(ctx context.Context, id string) (Session, error)
+	// ListActive returns the user's unrevoked sessions that expire after now,
+	// most recently used first.
+	ListActive(ctx context.Context, uid int64, now time.Time) ([]Session, error)
+	// Touch records use of a session.
+	Touch(ctx context.Context, id string, at time.Time) error
+	// Renew records use and moves the expiry; it returns
+	// gorm.ErrRecordNotFound if there is no such session.
+	Renew(ctx context.Context, id string, at, expiresAt time.Time) error
+	// Revoke returns gorm.ErrRecordNotFound if uid has no active session with id.
+	Revoke(ctx context.Context, id string, uid int64) error
+	RevokeAllForUser(ctx context.Context, uid int64) error
+}
+
+// UserIdentityRepository
+type UserIdentityRepository interface {
+	Get(ctx context.Context, issuer, subject string) (UserIdentity, error)
+	// Create returns gorm.ErrDuplicatedKey if the identity is already linked.
+	Create(ctx context.Context, identity UserIdentity) (UserIdentity, error)
+}
+
+// OIDCAuthRequestRepository
+type OIDCAuthRequestRepository interface {
+	Create(ctx context.Context, req OIDCAuthRequest) error
+	// Take deletes and returns the request, so a state works once. It
+	// returns gorm.ErrRecordNotFound if there is none.
+	Take(ctx context.Context, stateHash string) (OIDCAuthRequest, error)
 }
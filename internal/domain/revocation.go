@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// RevokedToken blocks a single access token until it would have expired.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;column:jti"`
+	UserID    int64     `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RevokedAt time.Time `gorm:"not null"`
+}
+
+// UserRevocation invalidates every access token of a user issued before
+// RevokedBefore ("log out everywhere"); see RevokedByCutoff.
+type UserRevocation struct {
+	UserID        int64     `gorm:"primaryKey"`
+	RevokedBefore time.Time `gorm:"not null"`
+}
+
+// RevokedByCutoff reports whether a token issued at issuedAt falls under a
+// "log out everywhere" cutoff. Token iat claims have whole seconds, so the
+// cutoff is compared at that precision and tokens from its own second stay
+// valid: otherwise a session started right after the cutoff would be
+// revoked too. Session revocation covers the earlier tokens of that second.
+func RevokedByCutoff(issuedAt, cutoff time.Time) bool {
+	return !cutoff.IsZero() && issuedAt.Before(cutoff.Truncate(time.Second))
+}
+
+// ExpiredPurger deletes rows that stopped mattering at or before now, such
+// as revocations of tokens that have expired anyway.
+type ExpiredPurger interface {
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
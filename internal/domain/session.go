@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// Session is one login on one device. Its ID is the sid claim of every access
+// token issued for the login and the FamilyID of its refresh tokens, so
+// revoking a session ends both.
+type Session struct {
+	ID         string    `gorm:"primaryKey"`
+	UserID     int64     `gorm:"not null;index"`
+	UserAgent  string    `gorm:"not null"`
+	IP         string    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	LastUsedAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+}
@@ -2,9 +2,29 @@ package domain
 
 import "time"
 
+// Roles. Every account is a RoleUser unless promoted.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
 type User struct {
-	ID           int64     `gorm:"primaryKey"`
-	Email        string    `gorm:"not null;uniqueIndex"`
-	PasswordHash string    `gorm:"not null"`
-	CreatedAt    time.Time `gorm:"not null"`
+	ID              int64  `gorm:"primaryKey"`
+	Email           string `gorm:"not null;uniqueIndex"`
+	PasswordHash    string `gorm:"not null"`
+	ZeroKnowledge   bool   `gorm:"not null;default:false"` // only client-side encrypted notes are accepted
+	EmailVerifiedAt *time.Time
+	Role            string `gorm:"not null;default:user"`
+	DisabledAt      *time.Time
+	// SuspendedUntil blocks sign-in and every outstanding token until it
+	// passes. Unlike DisabledAt it does not sign the user out.
+	SuspendedUntil *time.Time
+	// PasswordResetRequired blocks password login until the user sets a new
+	// password through the reset flow.
+	PasswordResetRequired bool      `gorm:"not null;default:false"`
+	CreatedAt             time.Time `gorm:"not null"`
 }
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+// ChangePassword responds with fresh tokens: every other session, including
+// the caller's old tokens, is revoked.
+func (h UserAuthHandler) ChangePassword(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req changePasswordReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	resp, err := h.svc.ChangePassword(clientContext(c), principal.UserID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		return accountError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+func (h UserAuthHandler) ChangeEmail(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req changeEmailReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	resp, err := h.svc.ChangeEmail(clientContext(c), principal.UserID, req.Password, req.Email)
+	if err != nil {
+		return accountError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+// DeleteAccount permanently deletes the caller's account and everything in
+// it. The password is asked for again so a stolen access token is not enough.
+func (h UserAuthHandler) DeleteAccount(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req deleteAccountReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	if err := h.svc.DeleteAccount(clientContext(c), principal.UserID, req.Password); err != nil {
+		return accountError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func accountError(c *fiber.Ctx, err error) error {
+	var locked *service.LoginLockedError
+	var weak *security.PasswordPolicyError
+	switch {
+	case errors.As(err, &locked):
+		return loginLocked(c, locked)
+	case errors.As(err, &weak):
+		return passwordRejected(c, weak)
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return c.Status(fiber.StatusForbidden).JSON(response.NewError(response.CodeUnauthorized, "current password is incorrect"))
+	case errors.Is(err, service.ErrInvalidEmail),
+		errors.Is(err, service.ErrSameEmail):
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+	case errors.Is(err, service.ErrEmailAlreadyExists):
+		return c.Status(fiber.StatusConflict).JSON(response.NewError(response.CodeValidation, err.Error()))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+}
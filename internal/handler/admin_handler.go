@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+)
+
+func (h UserAuthHandler) AdminListUsers(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	users, err := h.svc.ListUsers(c.Context(), limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	out := make([]adminUserResp, len(users))
+	for i, u := range users {
+		out[i] = toAdminUserResp(u)
+	}
+	return c.Status(fiber.StatusOK).JSON(out)
+}
+
+func (h UserAuthHandler) AdminDisableUser(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	if err = h.svc.DisableUser(c.Context(), principal.UserID, id); err != nil {
+		return adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) AdminEnableUser(c *fiber.Ctx) error {
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	if err = h.svc.EnableUser(c.Context(), id); err != nil {
+		return adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) AdminSuspendUser(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	var req suspendUserReq
+	if err = c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	if err = h.svc.SuspendUser(c.Context(), principal.UserID, id, req.Until); err != nil {
+		return adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) AdminUnsuspendUser(c *fiber.Ctx) error {
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	if err = h.svc.UnsuspendUser(c.Context(), id); err != nil {
+		return adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) AdminForcePasswordReset(c *fiber.Ctx) error {
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	if err = h.svc.ForcePasswordReset(c.Context(), id); err != nil {
+		return adminError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func adminError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeUserNotFound, err.Error()))
+	case errors.Is(err, service.ErrCannotModifySelf), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidSuspension):
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+}
+
+func toAdminUserResp(u domain.User) adminUserResp {
+	role := u.Role
+	if role == "" {
+		role = domain.RoleUser
+	}
+	return adminUserResp{
+		ID:                    u.ID,
+		Email:                 u.Email,
+		Role:                  role,
+		EmailVerifiedAt:       u.EmailVerifiedAt,
+		DisabledAt:            u.DisabledAt,
+		SuspendedUntil:        u.SuspendedUntil,
+		PasswordResetRequired: u.PasswordResetRequired,
+		CreatedAt:             u.CreatedAt,
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/http/middleware"
 	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/security"
 	"github.com/secure-notes/internal/service"
+	"math"
+	"strconv"
 	"time"
 )
 
@@ -16,13 +20,17 @@ func (h UserAuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	user := domain.User{
-		Email:        req.Email,
-		PasswordHash: req.Password,
+		Email:         req.Email,
+		PasswordHash:  req.Password,
+		ZeroKnowledge: req.ZeroKnowledge,
 	}
 	created, err := h.svc.Register(c.Context(), user)
 	if err != nil {
-		if errors.Is(err, service.ErrPasswordTooShort) ||
-			errors.Is(err, service.ErrInvalidEmail) ||
+		var weak *security.PasswordPolicyError
+		if errors.As(err, &weak) {
+			return passwordRejected(c, weak)
+		}
+		if errors.Is(err, service.ErrInvalidEmail) ||
 			errors.Is(err, service.ErrInvalidPassword) {
 			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
 		}
@@ -41,16 +49,134 @@ func (h UserAuthHandler) Login(c *fiber.Ctx) error {
 		Email:        req.Email,
 		PasswordHash: req.Password,
 	}
-	resp, err := h.svc.Login(c.Context(), user)
+	resp, err := h.svc.Login(clientContext(c), user)
 	if err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			return loginLocked(c, locked)
+		}
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeUnauthorized, "invalid credentials"))
 		}
+		if isAccountBlocked(err) {
+			return accountBlocked(c, err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+func (h UserAuthHandler) Refresh(c *fiber.Ctx) error {
+	var req refreshReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+
+	resp, err := h.svc.Refresh(clientContext(c), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(response.NewError(response.CodeTokenReused, "refresh token already used; session revoked"))
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshDisabled) {
+			return c.Status(fiber.StatusUnauthorized).JSON(response.NewError(response.CodeUnauthorized, "invalid refresh token"))
+		}
+		if isAccountBlocked(err) {
+			return accountBlocked(c, err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+func (h UserAuthHandler) Logout(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req refreshReq
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+		}
+	}
+	if err := h.svc.Logout(c.Context(), principal, req.RefreshToken); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) LogoutAll(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	if err := h.svc.LogoutAll(c.Context(), principal.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loginLocked answers 429 with Retry-After in whole seconds.
+func loginLocked(c *fiber.Ctx, locked *service.LoginLockedError) error {
+	seconds := int(math.Ceil(locked.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).
+		JSON(response.NewError(response.CodeLoginLocked, "too many failed attempts; try again later"))
+}
+
+// passwordViolationCodes names each policy rule for API clients.
+var passwordViolationCodes = map[error]string{
+	security.ErrPasswordTooShort:      "too_short",
+	security.ErrPasswordTooWeak:       "too_weak",
+	security.ErrPasswordBreached:      "breached",
+	security.ErrPasswordContainsEmail: "contains_email",
+}
+
+// passwordRejected answers 400 with one detail per broken rule.
+func passwordRejected(c *fiber.Ctx, weak *security.PasswordPolicyError) error {
+	details := make([]response.ErrorDetail, len(weak.Violations))
+	for i, v := range weak.Violations {
+		details[i] = response.ErrorDetail{Field: "password", Code: passwordViolationCodes[v], Message: v.Error()}
+	}
+	return c.Status(fiber.StatusBadRequest).
+		JSON(response.NewErrorWithDetails(response.CodeWeakPassword, "password does not meet the password policy", details))
+}
+
+func isAccountBlocked(err error) bool {
+	return errors.Is(err, service.ErrAccountDisabled) || errors.Is(err, service.ErrAccountSuspended) ||
+		errors.Is(err, service.ErrPasswordResetRequired)
+}
+
+// accountBlocked answers 403 for an account that may not sign in right now.
+func accountBlocked(c *fiber.Ctx, err error) error {
+	code := response.CodeAccountDisabled
+	switch {
+	case errors.Is(err, service.ErrAccountSuspended):
+		code = response.CodeAccountSuspended
+	case errors.Is(err, service.ErrPasswordResetRequired):
+		code = response.CodeResetRequired
+	}
+	return c.Status(fiber.StatusForbidden).JSON(response.NewError(code, err.Error()))
+}
+
+func tokenResponse(resp service.LoginResult) fiber.Map {
+	if resp.MFARequired {
+		return fiber.Map{
+			"mfa_required":         true,
+			"challenge_token":      resp.ChallengeToken,
+			"challenge_expires_at": resp.ChallengeExpiresAt.UTC().Format(time.RFC3339),
+		}
+	}
+	body := fiber.Map{
 		"access_token": resp.AccessToken,
 		"token_type":   "Bearer",
 		"expires_at":   resp.ExpiresAt.UTC().Format(time.RFC3339),
-	})
+	}
+	if resp.RefreshToken != "" {
+		body["refresh_token"] = resp.RefreshToken
+		body["refresh_expires_at"] = resp.RefreshExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return body
 }
@@ -0,0 +1,10 @@
+package handler
+
+import "github.com/gofiber/fiber/v2"
+
+// JWKS publishes the public keys that verify our access tokens so other
+// services can check them without holding a signing secret.
+func (h KeysHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.jwt.JWKS())
+}
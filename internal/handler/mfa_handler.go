@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+)
+
+func (h UserAuthHandler) EnrollTOTP(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	enrollment, err := h.svc.EnrollTOTP(c.Context(), principal.UserID)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+	})
+}
+
+func (h UserAuthHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req mfaCodeReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	codes, err := h.svc.ConfirmTOTP(c.Context(), principal.UserID, req.Code)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"recovery_codes": codes})
+}
+
+func (h UserAuthHandler) DisableTOTP(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req mfaCodeReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	if err := h.svc.DisableTOTP(c.Context(), principal.UserID, req.Code); err != nil {
+		return mfaError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) LoginMFA(c *fiber.Ctx) error {
+	var req mfaLoginReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	resp, err := h.svc.VerifyMFA(clientContext(c), req.ChallengeToken, req.Code)
+	if err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			return loginLocked(c, locked)
+		}
+		if errors.Is(err, service.ErrInvalidChallenge) || errors.Is(err, service.ErrInvalidMFACode) {
+			return c.Status(fiber.StatusUnauthorized).JSON(response.NewError(response.CodeUnauthorized, err.Error()))
+		}
+		if isAccountBlocked(err) {
+			return accountBlocked(c, err)
+		}
+		return mfaError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+func mfaError(c *fiber.Ctx, err error) error {
+	var locked *service.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		return loginLocked(c, locked)
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidMFACode, err.Error()))
+	case errors.Is(err, service.ErrMFAAlreadyEnabled),
+		errors.Is(err, service.ErrMFANotEnrolled),
+		errors.Is(err, service.ErrMFANotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(response.NewError(response.CodeValidation, err.Error()))
+	case errors.Is(err, service.ErrMFAUnavailable):
+		return c.Status(fiber.StatusServiceUnavailable).JSON(response.NewError(response.CodeMFAUnavailable, err.Error()))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+}
@@ -1,13 +1,34 @@
 package handler
 
-import "github.com/secure-notes/internal/service"
+import (
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+	"time"
+)
 
 type NoteHandler struct {
 	svc *service.NoteService
 }
 type createNoteReq struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title     string            `json:"title"`
+	Content   string            `json:"content"`
+	Encrypted *encryptedNoteReq `json:"encrypted"`
+	// Tags are stored in the clear, so they are refused on client-encrypted
+	// (zero-knowledge) notes, and an update to one drops the note's tags.
+	// Otherwise leaving them out of an update keeps the current ones; []
+	// removes them.
+	Tags []string `json:"tags"`
+}
+
+// encryptedNoteReq carries a note encrypted on the client. Binary fields are
+// standard base64.
+type encryptedNoteReq struct {
+	Ciphertext string           `json:"ciphertext"`
+	Algorithm  string           `json:"algorithm"`
+	Nonce      string           `json:"nonce"`
+	KDF        string           `json:"kdf"`
+	KDFSalt    string           `json:"kdf_salt"`
+	KDFParams  map[string]int64 `json:"kdf_params"`
 }
 
 func NewHandler(svc *service.NoteService) *NoteHandler {
@@ -18,10 +39,101 @@ type UserAuthHandler struct {
 	svc *service.UserAuth
 }
 type createUsereAuthReq struct {
+	Email         string `json:"email"`
+	Password      string `json:"password"`
+	ZeroKnowledge bool   `json:"zero_knowledge"`
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+type mfaLoginReq struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type changeEmailReq struct {
+	Password string `json:"password"`
 	Email    string `json:"email"`
+}
+
+type deleteAccountReq struct {
 	Password string `json:"password"`
 }
 
+type createTokenReq struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type personalTokenResp struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"` // only in the create response
+}
+
+type sessionResp struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type suspendUserReq struct {
+	Until time.Time `json:"until"`
+}
+
+type adminUserResp struct {
+	ID                    int64      `json:"id"`
+	Email                 string     `json:"email"`
+	Role                  string     `json:"role"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	SuspendedUntil        *time.Time `json:"suspended_until"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
 func NewUserAuthHandler(svc *service.UserAuth) *UserAuthHandler {
 	return &UserAuthHandler{svc: svc}
 }
+
+type KeysHandler struct {
+	jwt *security.JWTManager
+}
+
+func NewKeysHandler(jwtm *security.JWTManager) *KeysHandler {
+	return &KeysHandler{jwt: jwtm}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/secure-notes/internal/domain"
@@ -8,6 +9,7 @@ import (
 	"github.com/secure-notes/internal/http/response"
 	"github.com/secure-notes/internal/service"
 	"strconv"
+	"strings"
 )
 
 func (h NoteHandler) Create(c *fiber.Ctx) error {
@@ -16,9 +18,9 @@ func (h NoteHandler) Create(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
 	}
 
-	note := domain.Note{
-		Title:   req.Title,
-		Content: req.Content,
+	note, err := req.toNote()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
 	}
 	uidAny := c.Locals(middleware.LocalUserIDKey)
 	uid, ok := uidAny.(int64)
@@ -29,11 +31,15 @@ func (h NoteHandler) Create(c *fiber.Ctx) error {
 	note.UserID = uid
 	created, err := h.svc.CreateNote(c.Context(), note)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidContent) || errors.Is(err, service.ErrInvalidTitle) {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return c.Status(fiber.StatusForbidden).JSON(response.NewError(response.CodeEmailNotVerified, err.Error()))
+		}
+		if isNoteValidationErr(err) {
 			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
+	c.Set(fiber.HeaderETag, etag(created.Version))
 	return c.Status(fiber.StatusCreated).JSON(created)
 }
 
@@ -44,15 +50,19 @@ func (h NoteHandler) UpdateByID(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
 	}
+	var ok bool
 	var req createNoteReq
 	if err = c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
 	}
 
-	note := domain.Note{
-		ID:      id,
-		Title:   req.Title,
-		Content: req.Content,
+	note, err := req.toNote()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+	}
+	note.ID = id
+	if note.Version, ok = ifMatch(c); !ok {
+		return versionConflict(c)
 	}
 	uidAny := c.Locals(middleware.LocalUserIDKey)
 	uid, ok := uidAny.(int64)
@@ -61,13 +71,20 @@ func (h NoteHandler) UpdateByID(c *fiber.Ctx) error {
 			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
 	}
 	note.UserID = uid
-	err = h.svc.UpdateByID(c.Context(), note)
+	version, err := h.svc.UpdateByID(c.Context(), note)
 	if err != nil {
+		if isNoteValidationErr(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+		}
 		if errors.Is(err, domain.ErrNoteNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
 		}
+		if errors.Is(err, domain.ErrVersionConflict) {
+			return versionConflict(c)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
+	c.Set(fiber.HeaderETag, etag(version))
 	return c.SendStatus(fiber.StatusNoContent)
 }
 func (h NoteHandler) DeleteByID(c *fiber.Ctx) error {
@@ -77,16 +94,23 @@ func (h NoteHandler) DeleteByID(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
 	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return versionConflict(c)
+	}
 	uidAny := c.Locals(middleware.LocalUserIDKey)
 	uid, ok := uidAny.(int64)
 	if !ok || uid <= 0 {
 		return c.Status(fiber.StatusUnauthorized).
 			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
 	}
-	if err = h.svc.RemoveNote(c.Context(), noteID, uid); err != nil {
+	if err = h.svc.RemoveNote(c.Context(), noteID, uid, version); err != nil {
 		if errors.Is(err, domain.ErrNoteNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
 		}
+		if errors.Is(err, domain.ErrVersionConflict) {
+			return versionConflict(c)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
 	return c.Status(fiber.StatusNoContent).JSON(fiber.Map{"status": true})
@@ -113,9 +137,41 @@ func (h NoteHandler) GetByID(c *fiber.Ctx) error {
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
+	c.Set(fiber.HeaderETag, etag(note.Version))
 	return c.Status(fiber.StatusOK).JSON(note)
 }
 
+// etag formats a note version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch reads the If-Match header as the note version the client expects.
+// It returns 0 when the header is absent or "*". A header naming anything
+// other than one version this API could have issued can never match, so ok
+// is false and the request fails its precondition.
+func ifMatch(c *fiber.Ctx) (version int64, ok bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	unquoted, found := strings.CutPrefix(header, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	if !found || !closed {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+func versionConflict(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusPreconditionFailed).
+		JSON(response.NewError(response.CodeVersionConflict, "note has changed; fetch it again before saving"))
+}
+
 func (h NoteHandler) List(c *fiber.Ctx) error {
 	uidAny := c.Locals("user_id")
 	uid, ok := uidAny.(int64)
@@ -131,13 +187,288 @@ func (h NoteHandler) List(c *fiber.Ctx) error {
 	if offset < 0 {
 		offset = 0
 	}
-	notes, err := h.svc.List(c.Context(), uid, limit, offset)
+	filter, err := noteFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+	}
+	notes, err := h.svc.List(c.Context(), uid, filter, limit, offset)
+	if err != nil {
+		if isNoteValidationErr(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.Status(fiber.StatusOK).JSON(notes)
+}
+
+func (h NoteHandler) ListTags(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	tags, err := h.svc.Tags(c.Context(), principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	if tags == nil {
+		tags = []domain.TagCount{}
+	}
+	return c.Status(fiber.StatusOK).JSON(tags)
+}
+
+// ListTrash pages through deleted notes with the same limit and offset
+// rules as List.
+func (h NoteHandler) ListTrash(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	notes, err := h.svc.ListTrash(c.Context(), principal.UserID, limit, offset)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
 	}
+	if notes == nil {
+		notes = []domain.Note{}
+	}
 	return c.Status(fiber.StatusOK).JSON(notes)
 }
 
+func (h NoteHandler) Restore(c *fiber.Ctx) error {
+	return h.trashAction(c, h.svc.RestoreNote)
+}
+
+// Purge deletes a note in the trash permanently.
+func (h NoteHandler) Purge(c *fiber.Ctx) error {
+	return h.trashAction(c, h.svc.PurgeNote)
+}
+
+func (h NoteHandler) trashAction(c *fiber.Ctx, action func(ctx context.Context, noteID, uid int64) error) error {
+	noteID, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	if err = action(c.Context(), noteID, principal.UserID); err != nil {
+		if errors.Is(err, domain.ErrNoteNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h NoteHandler) Archive(c *fiber.Ctx) error {
+	return h.setArchived(c, true)
+}
+
+func (h NoteHandler) Unarchive(c *fiber.Ctx) error {
+	return h.setArchived(c, false)
+}
+
+func (h NoteHandler) setArchived(c *fiber.Ctx, archived bool) error {
+	noteID, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	if archived {
+		err = h.svc.ArchiveNote(c.Context(), noteID, principal.UserID)
+	} else {
+		err = h.svc.UnarchiveNote(c.Context(), noteID, principal.UserID)
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrNoteNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h NoteHandler) ListRevisions(c *fiber.Ctx) error {
+	noteID, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	revs, err := h.svc.ListRevisions(c.Context(), noteID, principal.UserID, limit, offset)
+	if err != nil {
+		if errors.Is(err, domain.ErrNoteNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	if revs == nil {
+		revs = []domain.NoteRevision{}
+	}
+	return c.Status(fiber.StatusOK).JSON(revs)
+}
+
+// DiffRevisions answers ?from=<revision>&to=<revision> with a unified diff
+// as text. Identical revisions give an empty body.
+func (h NoteHandler) DiffRevisions(c *fiber.Ctx) error {
+	noteID, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	from, errFrom := idValidator(c.Query("from"))
+	to, errTo := idValidator(c.Query("to"))
+	if errFrom != nil || errTo != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "from and to must be revision ids"))
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	diff, err := h.svc.DiffRevisions(c.Context(), noteID, principal.UserID, from, to)
+	if err != nil {
+		return revisionError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, "text/x-diff; charset=utf-8")
+	return c.Status(fiber.StatusOK).SendString(diff)
+}
+
+// RestoreRevision saves an old revision as the newest one and returns the
+// note as it now is.
+func (h NoteHandler) RestoreRevision(c *fiber.Ctx) error {
+	noteID, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	revisionID, err := idValidator(c.Params("rev"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid revision id"))
+	}
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		return versionConflict(c)
+	}
+	note, err := h.svc.RestoreRevision(c.Context(), noteID, revisionID, principal.UserID, version)
+	if err != nil {
+		return revisionError(c, err)
+	}
+	c.Set(fiber.HeaderETag, etag(note.Version))
+	return c.Status(fiber.StatusOK).JSON(note)
+}
+
+func revisionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrRevisionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeRevisionNotFound, err.Error()))
+	case errors.Is(err, domain.ErrNoteNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeNoteNotFound, "note not found"))
+	case errors.Is(err, domain.ErrVersionConflict):
+		return versionConflict(c)
+	case errors.Is(err, service.ErrRevisionNotDiffable), isNoteValidationErr(err):
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+}
+
+var (
+	errInvalidMatch    = errors.New("match must be all or any")
+	errInvalidArchived = errors.New("archived must be true, false or all")
+)
+
+// noteFilter reads ?tag=a&tag=b (or ?tag=a,b), ?match=all|any and
+// ?archived=true|false|all. By default a note must carry every listed tag
+// and archived notes are left out.
+func noteFilter(c *fiber.Ctx) (domain.NoteFilter, error) {
+	var filter domain.NoteFilter
+	for _, v := range c.Context().QueryArgs().PeekMulti("tag") {
+		filter.Tags = append(filter.Tags, strings.Split(string(v), ",")...)
+	}
+	switch c.Query("match", "all") {
+	case "all":
+		filter.MatchAllTags = true
+	case "any":
+	default:
+		return domain.NoteFilter{}, errInvalidMatch
+	}
+	switch c.Query("archived", "false") {
+	case "false":
+		filter.Archived = domain.ArchivedHidden
+	case "true":
+		filter.Archived = domain.ArchivedOnly
+	case "all":
+		filter.Archived = domain.ArchivedInclude
+	default:
+		return domain.NoteFilter{}, errInvalidArchived
+	}
+	return filter, nil
+}
+
+// toNote maps the request body to a note. For client-encrypted notes the
+// ciphertext is stored as the content and no plaintext may accompany it.
+func (r createNoteReq) toNote() (domain.Note, error) {
+	if r.Encrypted == nil {
+		return domain.Note{Title: r.Title, Content: r.Content, Tags: r.Tags}, nil
+	}
+	if r.Title != "" || r.Content != "" {
+		return domain.Note{}, service.ErrPlaintextWithCiphertext
+	}
+	return domain.Note{
+		Content: r.Encrypted.Ciphertext,
+		Tags:    r.Tags,
+		ClientEncryption: &domain.ClientEncryption{
+			Algorithm: r.Encrypted.Algorithm,
+			Nonce:     r.Encrypted.Nonce,
+			KDF:       r.Encrypted.KDF,
+			KDFSalt:   r.Encrypted.KDFSalt,
+			KDFParams: r.Encrypted.KDFParams,
+		},
+	}, nil
+}
+
+func isNoteValidationErr(err error) bool {
+	return errors.Is(err, service.ErrInvalidContent) ||
+		errors.Is(err, service.ErrInvalidTitle) ||
+		errors.Is(err, service.ErrInvalidCiphertext) ||
+		errors.Is(err, service.ErrUnsupportedAlgorithm) ||
+		errors.Is(err, service.ErrInvalidNonce) ||
+		errors.Is(err, service.ErrInvalidKDFSalt) ||
+		errors.Is(err, service.ErrPlaintextWithCiphertext) ||
+		errors.Is(err, service.ErrPlaintextNotAllowed) ||
+		errors.Is(err, service.ErrInvalidTag) ||
+		errors.Is(err, service.ErrTooManyTags)
+}
+
 func idValidator(id string) (int64, error) {
 	return strconv.ParseInt(id, 10, 64)
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIfMatch(t *testing.T) {
+	cases := map[string]struct {
+		header  string
+		version int64
+		ok      bool
+	}{
+		"absent":         {"", 0, true},
+		"any":            {"*", 0, true},
+		"strong":         {`"7"`, 7, true},
+		"padded":         {` "7" `, 7, true},
+		"weak":           {`W/"1"`, 0, false},
+		"unquoted":       {"7", 0, false},
+		"unterminated":   {`"7`, 0, false},
+		"lone quote":     {`"`, 0, false},
+		"not a version":  {`"abc"`, 0, false},
+		"zero":           {`"0"`, 0, false},
+		"negative":       {`"-1"`, 0, false},
+		"list of etags":  {`"1", "2"`, 0, false},
+		"overflows int":  {`"99999999999999999999"`, 0, false},
+		"empty quotes":   {`""`, 0, false},
+		"inner spaces":   {`" 7"`, 0, false},
+		"trailing bytes": {`"7"x`, 0, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			app := fiber.New()
+			var version int64
+			var ok bool
+			app.Get("/", func(c *fiber.Ctx) error {
+				version, ok = ifMatch(c)
+				return nil
+			})
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tc.header)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			if version != tc.version || ok != tc.ok {
+				t.Fatalf("ifMatch(%q) = %d, %v; want %d, %v", tc.header, version, ok, tc.version, tc.ok)
+			}
+		})
+	}
+}
+
+func TestEtag(t *testing.T) {
+	if got := etag(12); got != `"12"` {
+		t.Fatalf("etag(12) = %s", got)
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+	"time"
+)
+
+// oidcStateCookie binds a sign-in to the browser that started it, so a
+// callback URL from someone else's sign-in cannot log this browser in.
+const oidcStateCookie = "oidc_state"
+
+func (h UserAuthHandler) OIDCLogin(c *fiber.Ctx) error {
+	authURL, state, err := h.svc.StartOIDC(clientContext(c))
+	if err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			return loginLocked(c, locked)
+		}
+		return oidcError(c, err)
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		Expires:  time.Now().Add(10 * time.Minute),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+func (h UserAuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	// The provider's error and error_description are attacker-controlled
+	// text on a link anyone can send, so they are not repeated back.
+	if c.Query("error") != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(response.NewError(response.CodeUnauthorized, service.ErrOIDCLoginFailed.Error()))
+	}
+	state := c.Query("state")
+	cookie := c.Cookies(oidcStateCookie)
+	c.ClearCookie(oidcStateCookie)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidToken, "sign-in state mismatch"))
+	}
+	resp, err := h.svc.LoginOIDC(clientContext(c), state, c.Query("code"))
+	if err != nil {
+		return oidcError(c, err)
+	}
+	return c.Status(fiber.StatusOK).JSON(tokenResponse(resp))
+}
+
+func oidcError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeBadRequest, err.Error()))
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidToken, err.Error()))
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		return c.Status(fiber.StatusUnauthorized).JSON(response.NewError(response.CodeUnauthorized, service.ErrOIDCLoginFailed.Error()))
+	case errors.Is(err, service.ErrOIDCEmailNotVerified):
+		return c.Status(fiber.StatusForbidden).JSON(response.NewError(response.CodeEmailNotVerified, err.Error()))
+	case errors.Is(err, service.ErrOIDCAccountConflict):
+		return c.Status(fiber.StatusConflict).JSON(response.NewError(response.CodeEmailNotVerified, err.Error()))
+	case isAccountBlocked(err):
+		return accountBlocked(c, err)
+	case errors.Is(err, service.ErrOIDCUnavailable):
+		return c.Status(fiber.StatusBadGateway).JSON(response.NewError(response.CodeInternal, service.ErrOIDCUnavailable.Error()))
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+	"log"
+)
+
+// ForgotPassword answers 202 unless the caller is throttled, so callers
+// cannot tell whether an account exists. Failures to build or deliver the
+// email only reach the log: they happen for existing accounts only.
+func (h UserAuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req forgotPasswordReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	if err := h.svc.ForgotPassword(clientContext(c), req.Email); err != nil {
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			return loginLocked(c, locked)
+		}
+		log.Printf("forgot password: %v", err)
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func (h UserAuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req resetPasswordReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	err := h.svc.ResetPassword(c.Context(), req.Token, req.Password)
+	if err != nil {
+		var weak *security.PasswordPolicyError
+		if errors.As(err, &weak) {
+			return passwordRejected(c, weak)
+		}
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidToken, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
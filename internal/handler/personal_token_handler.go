@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+)
+
+func (h UserAuthHandler) CreateToken(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	var req createTokenReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	token, raw, err := h.svc.CreatePersonalToken(c.Context(), principal.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTokenName) ||
+			errors.Is(err, service.ErrInvalidScopes) ||
+			errors.Is(err, service.ErrInvalidTokenExpiry) {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	resp := toPersonalTokenResp(token)
+	resp.Token = raw
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+func (h UserAuthHandler) ListTokens(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	tokens, err := h.svc.ListPersonalTokens(c.Context(), principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	out := make([]personalTokenResp, len(tokens))
+	for i, t := range tokens {
+		out[i] = toPersonalTokenResp(t)
+	}
+	return c.Status(fiber.StatusOK).JSON(out)
+}
+
+func (h UserAuthHandler) DeleteToken(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	id, err := idValidator(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidID, "invalid id"))
+	}
+	if err = h.svc.RevokePersonalToken(c.Context(), principal.UserID, id); err != nil {
+		if errors.Is(err, service.ErrPersonalTokenNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeBadRequest, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func toPersonalTokenResp(t domain.PersonalAccessToken) personalTokenResp {
+	return personalTokenResp{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
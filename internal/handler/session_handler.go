@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+)
+
+func (h UserAuthHandler) ListSessions(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	sessions, err := h.svc.ListSessions(c.Context(), principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	out := make([]sessionResp, len(sessions))
+	for i, s := range sessions {
+		out[i] = sessionResp{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == principal.SessionID,
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(out)
+}
+
+func (h UserAuthHandler) DeleteSession(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	if err := h.svc.RevokeSession(c.Context(), principal.UserID, c.Params("id")); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(response.NewError(response.CodeBadRequest, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// clientContext carries the caller's address and User-Agent to the service,
+// which uses them for login throttling and to describe new sessions.
+func clientContext(c *fiber.Ctx) context.Context {
+	ctx := service.WithClientIP(c.Context(), c.IP())
+	return service.WithUserAgent(ctx, c.Get(fiber.HeaderUserAgent))
+}
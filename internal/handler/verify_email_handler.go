@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/http/response"
+	"github.com/secure-notes/internal/service"
+)
+
+func (h UserAuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req verifyEmailReq
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeValidation, "bad request"))
+	}
+	if err := h.svc.VerifyEmail(c.Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(response.NewError(response.CodeInvalidToken, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h UserAuthHandler) ResendVerification(c *fiber.Ctx) error {
+	principal, ok := middleware.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+	}
+	if err := h.svc.ResendVerification(c.Context(), principal.UserID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			return c.Status(fiber.StatusConflict).JSON(response.NewError(response.CodeValidation, err.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(response.NewError(response.CodeInternal, "internal server error"))
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
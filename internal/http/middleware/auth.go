@@ -1,15 +1,26 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/domain"
 	"github.com/secure-notes/internal/http/response"
 	"github.com/secure-notes/internal/security"
 	"strings"
 )
 
-const LocalUserIDKey = "user_id"
+const (
+	LocalUserIDKey    = "user_id"
+	LocalPrincipalKey = "principal"
+)
+
+// Authenticator turns a bearer token into the calling principal.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (domain.Principal, error)
+}
 
-func AuthRequired(jwtm *security.JWTManager) fiber.Handler {
+func AuthRequired(auth Authenticator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		h := c.Get("Authorization")
 		if h == "" {
@@ -23,13 +34,66 @@ func AuthRequired(jwtm *security.JWTManager) fiber.Handler {
 				JSON(response.NewError(response.CodeUnauthorized, "invalid authorization header"))
 		}
 
-		userID, err := jwtm.Parse(parts[1])
+		principal, err := auth.Authenticate(c.Context(), parts[1])
 		if err != nil {
+			if errors.Is(err, security.ErrTokenRevoked) {
+				return c.Status(fiber.StatusUnauthorized).
+					JSON(response.NewError(response.CodeUnauthorized, "token revoked"))
+			}
+			if errors.Is(err, domain.ErrAccountSuspended) {
+				return c.Status(fiber.StatusForbidden).
+					JSON(response.NewError(response.CodeAccountSuspended, "account is suspended"))
+			}
+			if errors.Is(err, security.ErrInvalidToken) || errors.Is(err, security.ErrMissingToken) {
+				return c.Status(fiber.StatusUnauthorized).
+					JSON(response.NewError(response.CodeUnauthorized, "invalid token"))
+			}
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(response.NewError(response.CodeInternal, "internal server error"))
+		}
+
+		c.Locals(LocalUserIDKey, principal.UserID)
+		c.Locals(LocalPrincipalKey, principal)
+		return c.Next()
+	}
+}
+
+// RequireScope must follow AuthRequired. It answers 403 unless the caller's
+// token was granted scope.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, ok := PrincipalFrom(c)
+		if !ok {
 			return c.Status(fiber.StatusUnauthorized).
-				JSON(response.NewError(response.CodeUnauthorized, "invalid token"))
+				JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
 		}
+		if !p.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).
+				JSON(response.NewError(response.CodeForbidden, "token lacks scope "+scope))
+		}
+		return c.Next()
+	}
+}
 
-		c.Locals(LocalUserIDKey, userID)
+// RequireRole must follow AuthRequired. It answers 403 unless the caller's
+// token carries role.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, ok := PrincipalFrom(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(response.NewError(response.CodeUnauthorized, "unauthorized"))
+		}
+		if p.Role != role {
+			return c.Status(fiber.StatusForbidden).
+				JSON(response.NewError(response.CodeForbidden, "requires role "+role))
+		}
 		return c.Next()
 	}
 }
+
+// PrincipalFrom returns the principal stored by AuthRequired.
+func PrincipalFrom(c *fiber.Ctx) (domain.Principal, bool) {
+	p, ok := c.Locals(LocalPrincipalKey).(domain.Principal)
+	return p, ok && p.UserID > 0
+}
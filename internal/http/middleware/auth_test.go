@@ -0,0 +1,68 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/http/middleware"
+	"github.com/secure-notes/internal/security"
+)
+
+type stubAuth map[string]domain.Principal
+
+func (s stubAuth) Authenticate(ctx context.Context, token string) (domain.Principal, error) {
+	p, ok := s[token]
+	if !ok {
+		return domain.Principal{}, security.ErrInvalidToken
+	}
+	return p, nil
+}
+
+func TestRequireScope(t *testing.T) {
+	auth := stubAuth{
+		"session": {UserID: 1, Scopes: domain.SessionScopes},
+		"reader":  {UserID: 1, PersonalTokenID: 7, Scopes: []string{domain.ScopeNotesRead}},
+	}
+	app := fiber.New()
+	app.Delete("/notes/1", middleware.AuthRequired(auth), middleware.RequireScope(domain.ScopeNotesWrite),
+		func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+
+	cases := map[string]int{"session": fiber.StatusNoContent, "reader": fiber.StatusForbidden, "bogus": fiber.StatusUnauthorized}
+	for token, want := range cases {
+		req := httptest.NewRequest(fiber.MethodDelete, "/notes/1", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("%s: status %d, want %d", token, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	auth := stubAuth{
+		"admin": {UserID: 1, Scopes: domain.SessionScopes, Role: domain.RoleAdmin},
+		"user":  {UserID: 2, Scopes: domain.SessionScopes, Role: domain.RoleUser},
+	}
+	app := fiber.New()
+	app.Get("/admin/users", middleware.AuthRequired(auth), middleware.RequireRole(domain.RoleAdmin),
+		func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	cases := map[string]int{"admin": fiber.StatusOK, "user": fiber.StatusForbidden, "bogus": fiber.StatusUnauthorized}
+	for token, want := range cases {
+		req := httptest.NewRequest(fiber.MethodGet, "/admin/users", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("%s: status %d, want %d", token, resp.StatusCode, want)
+		}
+	}
+}
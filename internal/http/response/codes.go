@@ -1,10 +1,24 @@
 package response
 
 const (
-	CodeInvalidID    = "INVALID_ID"
-	CodeNoteNotFound = "NOTE_NOT_FOUND"
-	CodeInternal     = "INTERNAL"
-	CodeBadRequest   = "BAD_REQUEST"
-	CodeValidation   = "VALIDATION_ERROR"
-	CodeUnauthorized = "UNAUTHORIZED"
+	CodeInvalidID        = "INVALID_ID"
+	CodeNoteNotFound     = "NOTE_NOT_FOUND"
+	CodeInternal         = "INTERNAL"
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeValidation       = "VALIDATION_ERROR"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeTokenReused      = "REFRESH_TOKEN_REUSED"
+	CodeInvalidMFACode   = "INVALID_MFA_CODE"
+	CodeLoginLocked      = "LOGIN_LOCKED"
+	CodeInvalidToken     = "INVALID_TOKEN"
+	CodeEmailNotVerified = "EMAIL_NOT_VERIFIED"
+	CodeAccountDisabled  = "ACCOUNT_DISABLED"
+	CodeAccountSuspended = "ACCOUNT_SUSPENDED"
+	CodeResetRequired    = "PASSWORD_RESET_REQUIRED"
+	CodeUserNotFound     = "USER_NOT_FOUND"
+	CodeWeakPassword     = "WEAK_PASSWORD"
+	CodeRevisionNotFound = "REVISION_NOT_FOUND"
+	CodeVersionConflict  = "VERSION_CONFLICT"
+	CodeMFAUnavailable   = "MFA_UNAVAILABLE"
 )
@@ -4,6 +4,15 @@ type ErrorBody struct {
 	Error ErrorItem `json:"error"`
 }
 type ErrorItem struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail is one of several problems reported together, such as every
+// rule a rejected password broke.
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
@@ -13,3 +22,9 @@ func NewError(code, message string) ErrorBody {
 		Error: ErrorItem{Code: code, Message: message},
 	}
 }
+
+func NewErrorWithDetails(code, message string, details []ErrorDetail) ErrorBody {
+	return ErrorBody{
+		Error: ErrorItem{Code: code, Message: message, Details: details},
+	}
+}
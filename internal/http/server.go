@@ -2,9 +2,9 @@ package http
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/secure-notes/internal/domain"
 	"github.com/secure-notes/internal/handler"
 	"github.com/secure-notes/internal/http/middleware"
-	"github.com/secure-notes/internal/security"
 	"github.com/secure-notes/internal/service"
 )
 
@@ -13,31 +13,106 @@ type NoteApi struct {
 }
 
 const (
-	prefix   = "/api/v1"
-	pingPath = "/healthz"
-	pathNote = "/notes"
-	pathAuth = "/auth"
-	register = "/register"
-	login    = "/login"
+	prefix    = "/api/v1"
+	jwksPath  = "/.well-known/jwks.json"
+	pingPath  = "/healthz"
+	pathNote  = "/notes"
+	pathTags  = "/tags"
+	pathTrash = "/trash"
+	pathAuth  = "/auth"
+	pathToken = "/tokens"
+	pathSess  = "/sessions"
+	pathAdmin = "/admin"
+	pathMe    = "/me"
+	register  = "/register"
+	login     = "/login"
+	refresh   = "/refresh"
+	logout    = "/logout"
+	logoutAll = "/logout-all"
+	loginMFA  = "/login/mfa"
+	pathMFA   = "/mfa"
+	forgotPwd = "/password/forgot"
+	resetPwd  = "/password/reset"
+	verify    = "/verify-email"
+	resend    = "/verify-email/resend"
+	password  = "/password"
+	email     = "/email"
+	oidcLogin = "/oidc/login"
+	oidcCb    = "/oidc/callback"
 )
 
-func NewServer(noteHandler *handler.NoteHandler, userHandler *handler.UserAuthHandler, jwtm *security.JWTManager) *fiber.App {
+func NewServer(noteHandler *handler.NoteHandler, userHandler *handler.UserAuthHandler, keysHandler *handler.KeysHandler,
+	authn middleware.Authenticator) *fiber.App {
 	app := fiber.New()
+	app.Get(jwksPath, keysHandler.JWKS)
+
 	api := app.Group(prefix)
 	api.Get(pingPath, func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
-	notes := api.Group(pathNote, middleware.AuthRequired(jwtm))
-	notes.Post("/", noteHandler.Create)
-	notes.Get("/", noteHandler.List)
-	notes.Get("/:id", noteHandler.GetByID)
-	notes.Put("/:id", noteHandler.UpdateByID)
-	notes.Delete("/:id", noteHandler.DeleteByID)
+	read := middleware.RequireScope(domain.ScopeNotesRead)
+	write := middleware.RequireScope(domain.ScopeNotesWrite)
+	notes := api.Group(pathNote, middleware.AuthRequired(authn))
+	notes.Post("/", write, noteHandler.Create)
+	notes.Get("/", read, noteHandler.List)
+	notes.Get("/:id", read, noteHandler.GetByID)
+	notes.Put("/:id", write, noteHandler.UpdateByID)
+	notes.Delete("/:id", write, noteHandler.DeleteByID)
+	notes.Post("/:id/archive", write, noteHandler.Archive)
+	notes.Post("/:id/unarchive", write, noteHandler.Unarchive)
+	notes.Get("/:id/revisions", read, noteHandler.ListRevisions)
+	notes.Get("/:id/revisions/diff", read, noteHandler.DiffRevisions)
+	notes.Post("/:id/revisions/:rev/restore", write, noteHandler.RestoreRevision)
+
+	tags := api.Group(pathTags, middleware.AuthRequired(authn))
+	tags.Get("/", read, noteHandler.ListTags)
+
+	trash := api.Group(pathTrash, middleware.AuthRequired(authn))
+	trash.Get("/", read, noteHandler.ListTrash)
+	trash.Post("/:id/restore", write, noteHandler.Restore)
+	trash.Delete("/:id", write, noteHandler.Purge)
+
+	tokens := api.Group(pathToken, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount))
+	tokens.Post("/", userHandler.CreateToken)
+	tokens.Get("/", userHandler.ListTokens)
+	tokens.Delete("/:id", userHandler.DeleteToken)
+
+	sessions := api.Group(pathSess, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount))
+	sessions.Get("/", userHandler.ListSessions)
+	sessions.Delete("/:id", userHandler.DeleteSession)
+
+	api.Delete(pathMe, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.DeleteAccount)
+
+	admin := api.Group(pathAdmin, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount),
+		middleware.RequireRole(domain.RoleAdmin))
+	admin.Get("/users", userHandler.AdminListUsers)
+	admin.Post("/users/:id/disable", userHandler.AdminDisableUser)
+	admin.Post("/users/:id/enable", userHandler.AdminEnableUser)
+	admin.Post("/users/:id/suspend", userHandler.AdminSuspendUser)
+	admin.Post("/users/:id/unsuspend", userHandler.AdminUnsuspendUser)
+	admin.Post("/users/:id/force-password-reset", userHandler.AdminForcePasswordReset)
 
 	auth := api.Group(pathAuth)
 	auth.Post(register, userHandler.Register)
 	auth.Post(login, userHandler.Login)
+	auth.Post(refresh, userHandler.Refresh)
+	auth.Post(logout, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.Logout)
+	auth.Post(logoutAll, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.LogoutAll)
+	auth.Post(loginMFA, userHandler.LoginMFA)
+	auth.Get(oidcLogin, userHandler.OIDCLogin)
+	auth.Get(oidcCb, userHandler.OIDCCallback)
+	auth.Post(forgotPwd, userHandler.ForgotPassword)
+	auth.Post(resetPwd, userHandler.ResetPassword)
+	auth.Post(verify, userHandler.VerifyEmail)
+	auth.Post(resend, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.ResendVerification)
+	auth.Post(password, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.ChangePassword)
+	auth.Post(email, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount), userHandler.ChangeEmail)
+
+	mfa := auth.Group(pathMFA, middleware.AuthRequired(authn), middleware.RequireScope(domain.ScopeAccount))
+	mfa.Post("/enroll", userHandler.EnrollTOTP)
+	mfa.Post("/confirm", userHandler.ConfirmTOTP)
+	mfa.Post("/disable", userHandler.DisableTOTP)
 
 	return app
 }
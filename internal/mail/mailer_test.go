@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSMTPMailer_RenderStripsHeaderInjection(t *testing.T) {
+	m := NewSMTPMailer("localhost:25", "", "", "no-reply@example.com")
+	raw := string(m.render(Message{
+		To:      "victim@example.com\r\nBcc: attacker@example.com",
+		Subject: "hi\nX-Evil: 1",
+		Body:    "line1\nline2",
+	}))
+	headers, body, _ := strings.Cut(raw, "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") || strings.Contains(headers, "\r\nX-Evil:") {
+		t.Fatalf("header injection:\n%s", headers)
+	}
+	if body != "line1\r\nline2" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriterMailer(&buf).Send(context.Background(), Message{To: "a@example.com", Subject: "s", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "To: a@example.com") {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
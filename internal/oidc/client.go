@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/secure-notes/internal/security"
+)
+
+// The client speaks the authorization code flow with PKCE (RFC 7636) and
+// verifies ID tokens against the provider's published JWKS:
+//
+//	GET  <issuer>/.well-known/openid-configuration
+//	GET  authorization_endpoint?response_type=code&...  (browser redirect)
+//	POST token_endpoint  grant_type=authorization_code  -> {"id_token"}
+//	GET  jwks_uri                                        -> {"keys"}
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// jwksRefreshEvery limits JWKS refetches triggered by unknown key IDs.
+	jwksRefreshEvery = time.Minute
+)
+
+var (
+	ErrProviderUnavailable = errors.New("oidc provider request failed")
+	ErrCodeRejected        = errors.New("authorization code rejected")
+	ErrInvalidIDToken      = errors.New("invalid id token")
+)
+
+// Config identifies this application to an OpenID Connect provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+}
+
+// Identity is the verified subject of an ID token.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResp struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+type verifyKey struct {
+	method jwt.SigningMethod
+	key    any
+}
+
+// Client talks to one provider. Discovery and keys are fetched on first use
+// so the application can start while the provider is unreachable.
+type Client struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	meta      *discovery
+	keys      map[string]verifyKey
+	keysFetch time.Time
+}
+
+func NewClient(cfg Config) *Client {
+	cfg.IssuerURL = strings.TrimRight(cfg.IssuerURL, "/")
+	return &Client{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL returns the provider URL to send the browser to. The caller
+// keeps state, nonce and the code verifier behind challenge for Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the ID
+// token, which must carry nonce.
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	meta, err := c.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {c.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	var body tokenResp
+	_ = json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return Identity{}, fmt.Errorf("%w: %s %s", ErrCodeRejected, body.Error, body.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("%w: token endpoint: %d %s", ErrProviderUnavailable, res.StatusCode, body.Error)
+	}
+	if body.IDToken == "" {
+		return Identity{}, fmt.Errorf("%w: no id_token in response", ErrInvalidIDToken)
+	}
+	return c.verify(ctx, meta, body.IDToken, nonce)
+}
+
+func (c *Client) verify(ctx context.Context, meta discovery, raw, nonce string) (Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims,
+		func(t *jwt.Token) (any, error) { return c.key(ctx, meta, t) },
+		jwt.WithValidMethods([]string{security.AlgRS256, security.AlgEdDSA}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	return Identity{
+		Issuer:        meta.Issuer,
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+// key finds the verification key for t, refetching the JWKS when the
+// provider has rotated to a key we have not seen.
+func (c *Client) key(ctx context.Context, meta discovery, t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k, ok := c.lookupKey(kid)
+	if !ok && time.Since(c.keysFetch) >= jwksRefreshEvery {
+		if err := c.fetchKeys(ctx, meta.JWKSURI); err != nil {
+			return nil, err
+		}
+		k, ok = c.lookupKey(kid)
+	}
+	if !ok || k.method.Alg() != t.Method.Alg() {
+		return nil, ErrInvalidIDToken
+	}
+	return k.key, nil
+}
+
+// lookupKey must be called with mu held. Tokens without a kid are accepted
+// only while the provider publishes a single key.
+func (c *Client) lookupKey(kid string) (verifyKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+// fetchKeys must be called with mu held.
+func (c *Client) fetchKeys(ctx context.Context, uri string) error {
+	var set security.JWKSet
+	if err := c.getJSON(ctx, uri, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]verifyKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		method, key, err := jwk.PublicKey()
+		if err != nil {
+			continue // skip key types we cannot verify with
+		}
+		keys[jwk.Kid] = verifyKey{method: method, key: key}
+	}
+	c.keys = keys
+	c.keysFetch = time.Now()
+	return nil
+}
+
+func (c *Client) discover(ctx context.Context) (discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta != nil {
+		return *c.meta, nil
+	}
+	var meta discovery
+	if err := c.getJSON(ctx, c.cfg.IssuerURL+discoveryPath, &meta); err != nil {
+		return discovery{}, err
+	}
+	if strings.TrimRight(meta.Issuer, "/") != c.cfg.IssuerURL {
+		return discovery{}, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrProviderUnavailable, meta.Issuer, c.cfg.IssuerURL)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return discovery{}, fmt.Errorf("%w: incomplete discovery document", ErrProviderUnavailable)
+	}
+	c.meta = &meta
+	return meta, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, uri string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GET %s: %d", ErrProviderUnavailable, uri, res.StatusCode)
+	}
+	if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	return nil
+}
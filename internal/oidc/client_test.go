@@ -0,0 +1,84 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/secure-notes/internal/oidc"
+	"github.com/secure-notes/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/callback"
+
+// authorize follows the browser leg: it visits the authorization URL and
+// returns the query the provider redirected back with.
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	defer res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect, got %d %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	return loc.Query()
+}
+
+func TestClient_CodeFlowWithPKCE(t *testing.T) {
+	idp := oidctest.NewServer("notes", "s3cret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "u-1", Email: "a@example.com", EmailVerified: true})
+	c := oidc.NewClient(oidc.Config{IssuerURL: idp.Issuer(), ClientID: "notes", ClientSecret: "s3cret", RedirectURL: redirectURL})
+	ctx := context.Background()
+
+	verifier, _ := oidc.NewCodeVerifier()
+	authURL, err := c.AuthCodeURL(ctx, "st", "n0nce", oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+	q := authorize(t, authURL)
+	if q.Get("state") != "st" || q.Get("code") == "" {
+		t.Fatalf("unexpected callback query: %v", q)
+	}
+
+	id, err := c.Exchange(ctx, q.Get("code"), verifier, "n0nce")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if id.Issuer != idp.Issuer() || id.Subject != "u-1" || id.Email != "a@example.com" || !id.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if _, err = c.Exchange(ctx, q.Get("code"), verifier, "n0nce"); !errors.Is(err, oidc.ErrCodeRejected) {
+		t.Fatalf("codes must be single use, got: %v", err)
+	}
+}
+
+func TestClient_RejectsWrongVerifierAndNonce(t *testing.T) {
+	idp := oidctest.NewServer("notes", "")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "u-1"})
+	c := oidc.NewClient(oidc.Config{IssuerURL: idp.Issuer(), ClientID: "notes", RedirectURL: redirectURL})
+	ctx := context.Background()
+
+	verifier, _ := oidc.NewCodeVerifier()
+	authURL, _ := c.AuthCodeURL(ctx, "st", "n0nce", oidc.CodeChallenge(verifier))
+	q := authorize(t, authURL)
+	other, _ := oidc.NewCodeVerifier()
+	if _, err := c.Exchange(ctx, q.Get("code"), other, "n0nce"); !errors.Is(err, oidc.ErrCodeRejected) {
+		t.Fatalf("expected ErrCodeRejected for a wrong verifier, got: %v", err)
+	}
+
+	authURL, _ = c.AuthCodeURL(ctx, "st", "n0nce", oidc.CodeChallenge(verifier))
+	q = authorize(t, authURL)
+	if _, err := c.Exchange(ctx, q.Get("code"), verifier, "other"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken for a nonce mismatch, got: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cached
+
+import (
+	"sync"
+	"time"
+)
+
+// maxEntries bounds an entries cache before a sweep.
+const maxEntries = 10000
+
+type entry[V any] struct {
+	value   V
+	fetched time.Time
+}
+
+// entries is a map whose values are served for ttl after they were stored.
+type entries[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	m  map[K]entry[V]
+}
+
+func newEntries[K comparable, V any](ttl time.Duration) *entries[K, V] {
+	return &entries[K, V]{ttl: ttl, m: make(map[K]entry[V])}
+}
+
+func (e *entries[K, V]) get(key K) (V, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	en, ok := e.m[key]
+	if !ok || time.Since(en.fetched) >= e.ttl {
+		var zero V
+		return zero, false
+	}
+	return en.value, true
+}
+
+func (e *entries[K, V]) put(key K, value V) {
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.m) >= maxEntries {
+		for k, en := range e.m {
+			if now.Sub(en.fetched) >= e.ttl {
+				delete(e.m, k)
+			}
+		}
+	}
+	e.m[key] = entry[V]{value: value, fetched: now}
+}
+
+// update changes a fresh cached value in place, keeping its age.
+func (e *entries[K, V]) update(key K, change func(*V)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if en, ok := e.m[key]; ok {
+		change(&en.value)
+		e.m[key] = en
+	}
+}
+
+// drop forgets every key for which match returns true.
+func (e *entries[K, V]) drop(match func(K, V) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k, en := range e.m {
+		if match(k, en.value) {
+			delete(e.m, k)
+		}
+	}
+}
+
+func (e *entries[K, V]) delete(key K) {
+	e.mu.Lock()
+	delete(e.m, key)
+	e.mu.Unlock()
+}
@@ -0,0 +1,152 @@
+// Package cached puts in-memory caches in front of hot lookups.
+package cached
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+// RevocationBackend is the durable store behind RevocationStore.
+type RevocationBackend interface {
+	domain.RevocationStore
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokedBefore(ctx context.Context, uid int64) (time.Time, error)
+}
+
+// maxNegativeEntries bounds the "not revoked" cache before a sweep.
+const maxNegativeEntries = 10000
+
+type cutoffEntry struct {
+	before  time.Time
+	fetched time.Time
+}
+
+// RevocationStore answers IsRevoked, which runs on every authenticated
+// request, from memory. Revocations made through this instance apply
+// immediately; revocations made by other instances are seen once the
+// cached "not revoked" answer is older than ttl.
+type RevocationStore struct {
+	inner RevocationBackend
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // jti -> token expiry
+	checked map[string]time.Time // jti -> when the negative answer goes stale
+	cutoffs map[int64]cutoffEntry
+}
+
+func NewRevocationStore(inner RevocationBackend, ttl time.Duration) *RevocationStore {
+	return &RevocationStore{
+		inner:   inner,
+		ttl:     ttl,
+		revoked: make(map[string]time.Time),
+		checked: make(map[string]time.Time),
+		cutoffs: make(map[int64]cutoffEntry),
+	}
+}
+
+func (s *RevocationStore) RevokeToken(ctx context.Context, jti string, uid int64, expiresAt time.Time) error {
+	if err := s.inner.RevokeToken(ctx, jti, uid, expiresAt); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	delete(s.checked, jti)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, uid int64, before time.Time) error {
+	if err := s.inner.RevokeAllForUser(ctx, uid, before); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cutoffs[uid] = cutoffEntry{before: before, fetched: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string, uid int64, issuedAt time.Time) (bool, error) {
+	cutoff, err := s.cutoff(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	if domain.RevokedByCutoff(issuedAt, cutoff) {
+		return true, nil
+	}
+	return s.tokenRevoked(ctx, jti)
+}
+
+func (s *RevocationStore) tokenRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	if _, ok := s.revoked[jti]; ok {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if staleAt, ok := s.checked[jti]; ok && now.Before(staleAt) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := s.inner.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revoked {
+		// The expiry is unknown here; keep the entry for one ttl so the
+		// sweep can drop it, the backend still has the authoritative row.
+		s.revoked[jti] = now.Add(s.ttl)
+		return true, nil
+	}
+	if len(s.checked) >= maxNegativeEntries {
+		s.sweep(now)
+	}
+	s.checked[jti] = now.Add(s.ttl)
+	return false, nil
+}
+
+func (s *RevocationStore) cutoff(ctx context.Context, uid int64) (time.Time, error) {
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.cutoffs[uid]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.fetched) < s.ttl {
+		return entry.before, nil
+	}
+
+	before, err := s.inner.RevokedBefore(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s.mu.Lock()
+	s.cutoffs[uid] = cutoffEntry{before: before, fetched: now}
+	s.mu.Unlock()
+	return before, nil
+}
+
+// sweep drops entries that no longer matter. Callers hold s.mu.
+func (s *RevocationStore) sweep(now time.Time) {
+	for jti, staleAt := range s.checked {
+		if !now.Before(staleAt) {
+			delete(s.checked, jti)
+		}
+	}
+	for jti, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, jti)
+		}
+	}
+	for uid, entry := range s.cutoffs {
+		if now.Sub(entry.fetched) >= s.ttl {
+			delete(s.cutoffs, uid)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cached_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/repository/cached"
+)
+
+type countingBackend struct {
+	jtis    map[string]bool
+	cutoffs map[int64]time.Time
+	lookups int
+}
+
+func (b *countingBackend) RevokeToken(ctx context.Context, jti string, uid int64, expiresAt time.Time) error {
+	b.jtis[jti] = true
+	return nil
+}
+
+func (b *countingBackend) RevokeAllForUser(ctx context.Context, uid int64, before time.Time) error {
+	b.cutoffs[uid] = before
+	return nil
+}
+
+func (b *countingBackend) IsRevoked(ctx context.Context, jti string, uid int64, issuedAt time.Time) (bool, error) {
+	panic("the cache should use the granular lookups")
+}
+
+func (b *countingBackend) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	b.lookups++
+	return b.jtis[jti], nil
+}
+
+func (b *countingBackend) RevokedBefore(ctx context.Context, uid int64) (time.Time, error) {
+	b.lookups++
+	return b.cutoffs[uid], nil
+}
+
+func TestRevocationStore_CachesAndAppliesLocalRevocations(t *testing.T) {
+	backend := &countingBackend{jtis: map[string]bool{}, cutoffs: map[int64]time.Time{}}
+	store := cached.NewRevocationStore(backend, time.Minute)
+	ctx := context.Background()
+	issued := time.Now().Add(-time.Second)
+
+	for i := 0; i < 3; i++ {
+		if revoked, _ := store.IsRevoked(ctx, "a", 1, issued); revoked {
+			t.Fatalf("token should not be revoked")
+		}
+	}
+	if backend.lookups != 2 {
+		t.Fatalf("expected one backend lookup per key, got %d", backend.lookups)
+	}
+
+	_ = store.RevokeToken(ctx, "a", 1, time.Now().Add(time.Hour))
+	if revoked, _ := store.IsRevoked(ctx, "a", 1, issued); !revoked {
+		t.Fatalf("local revocation must apply immediately")
+	}
+
+	_ = store.RevokeAllForUser(ctx, 1, time.Now())
+	if revoked, _ := store.IsRevoked(ctx, "b", 1, issued); !revoked {
+		t.Fatalf("tokens issued before the cutoff must be revoked")
+	}
+	if revoked, _ := store.IsRevoked(ctx, "c", 1, time.Now().Add(time.Second)); revoked {
+		t.Fatalf("tokens issued after the cutoff are valid")
+	}
+}
+
+func TestRevocationStore_CutoffHasSecondPrecision(t *testing.T) {
+	backend := &countingBackend{jtis: map[string]bool{}, cutoffs: map[int64]time.Time{}}
+	store := cached.NewRevocationStore(backend, time.Minute)
+	ctx := context.Background()
+	cutoff := time.Date(2026, 1, 2, 3, 4, 5, 600_000_000, time.UTC)
+	_ = store.RevokeAllForUser(ctx, 1, cutoff)
+
+	// A token signed in the same second after the cutoff carries an iat
+	// that reads as earlier than the cutoff.
+	sameSecond := cutoff.Truncate(time.Second)
+	if revoked, _ := store.IsRevoked(ctx, "new", 1, sameSecond); revoked {
+		t.Fatalf("a token from the cutoff's own second must stay valid")
+	}
+	if revoked, _ := store.IsRevoked(ctx, "old", 1, sameSecond.Add(-time.Second)); !revoked {
+		t.Fatalf("a token from the second before the cutoff must be revoked")
+	}
+}
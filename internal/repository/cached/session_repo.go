@@ -0,0 +1,62 @@
+package cached
+
+import (
+	"context"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+// SessionRepo answers Get, which runs on every authenticated request, from
+// memory. Sessions revoked through this instance are dropped at once;
+// revocations made by other instances are seen once the cached session is
+// older than ttl.
+type SessionRepo struct {
+	domain.SessionRepository
+	sessions *entries[string, domain.Session]
+}
+
+func NewSessionRepo(inner domain.SessionRepository, ttl time.Duration) *SessionRepo {
+	return &SessionRepo{SessionRepository: inner, sessions: newEntries[string, domain.Session](ttl)}
+}
+
+func (r *SessionRepo) Get(ctx context.Context, id string) (domain.Session, error) {
+	if s, ok := r.sessions.get(id); ok {
+		return s, nil
+	}
+	s, err := r.SessionRepository.Get(ctx, id)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	r.sessions.put(id, s)
+	return s, nil
+}
+
+func (r *SessionRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	if err := r.SessionRepository.Touch(ctx, id, at); err != nil {
+		return err
+	}
+	r.sessions.update(id, func(s *domain.Session) { s.LastUsedAt = at })
+	return nil
+}
+
+func (r *SessionRepo) Renew(ctx context.Context, id string, at, expiresAt time.Time) error {
+	r.sessions.delete(id)
+	return r.SessionRepository.Renew(ctx, id, at, expiresAt)
+}
+
+func (r *SessionRepo) Revoke(ctx context.Context, id string, uid int64) error {
+	if err := r.SessionRepository.Revoke(ctx, id, uid); err != nil {
+		return err
+	}
+	r.sessions.delete(id)
+	return nil
+}
+
+func (r *SessionRepo) RevokeAllForUser(ctx context.Context, uid int64) error {
+	if err := r.SessionRepository.RevokeAllForUser(ctx, uid); err != nil {
+		return err
+	}
+	r.sessions.drop(func(_ string, s domain.Session) bool { return s.UserID == uid })
+	return nil
+}
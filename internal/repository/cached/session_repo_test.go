@@ -0,0 +1,77 @@
+package cached_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/cached"
+	"gorm.io/gorm"
+)
+
+type countingSessions struct {
+	domain.SessionRepository
+	sessions map[string]domain.Session
+	lookups  int
+}
+
+func (c *countingSessions) Get(ctx context.Context, id string) (domain.Session, error) {
+	c.lookups++
+	s, ok := c.sessions[id]
+	if !ok {
+		return domain.Session{}, gorm.ErrRecordNotFound
+	}
+	return s, nil
+}
+
+func (c *countingSessions) Touch(ctx context.Context, id string, at time.Time) error {
+	s := c.sessions[id]
+	s.LastUsedAt = at
+	c.sessions[id] = s
+	return nil
+}
+
+func (c *countingSessions) RevokeAllForUser(ctx context.Context, uid int64) error {
+	now := time.Now()
+	for id, s := range c.sessions {
+		if s.UserID == uid {
+			s.RevokedAt = &now
+			c.sessions[id] = s
+		}
+	}
+	return nil
+}
+
+func TestSessionRepo_CachesAndAppliesLocalRevocations(t *testing.T) {
+	inner := &countingSessions{sessions: map[string]domain.Session{
+		"a": {ID: "a", UserID: 1},
+		"b": {ID: "b", UserID: 2},
+	}}
+	repo := cached.NewSessionRepo(inner, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.Get(ctx, "a"); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	if inner.lookups != 1 {
+		t.Fatalf("expected one backend lookup, got %d", inner.lookups)
+	}
+
+	at := time.Now()
+	_ = repo.Touch(ctx, "a", at)
+	if s, _ := repo.Get(ctx, "a"); !s.LastUsedAt.Equal(at) || inner.lookups != 1 {
+		t.Fatalf("touch should update the cached session: %+v after %d lookups", s, inner.lookups)
+	}
+
+	_, _ = repo.Get(ctx, "b")
+	_ = repo.RevokeAllForUser(ctx, 1)
+	if s, _ := repo.Get(ctx, "a"); s.RevokedAt == nil {
+		t.Fatalf("revoking through the cache must apply immediately")
+	}
+	if inner.lookups != 3 {
+		t.Fatalf("only the revoked user's sessions should be dropped, got %d lookups", inner.lookups)
+	}
+}
@@ -0,0 +1,77 @@
+package cached
+
+import (
+	"context"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+// UserRepo answers GetByID, which checks the account status on every
+// authenticated request, from memory. Changes made through this instance
+// apply at once; changes made by other instances, such as disabling the
+// account, are seen once the cached user is older than ttl.
+//
+// Users come back without PasswordHash, so a password another instance has
+// already reset can never be checked against its old hash. Password checks
+// need the uncached repository.
+type UserRepo struct {
+	domain.UserRepository
+	users *entries[int64, domain.User]
+}
+
+func NewUserRepo(inner domain.UserRepository, ttl time.Duration) *UserRepo {
+	return &UserRepo{UserRepository: inner, users: newEntries[int64, domain.User](ttl)}
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, uid int64) (domain.User, error) {
+	if u, ok := r.users.get(uid); ok {
+		return u, nil
+	}
+	u, err := r.UserRepository.GetByID(ctx, uid)
+	if err != nil {
+		return domain.User{}, err
+	}
+	u.PasswordHash = ""
+	r.users.put(uid, u)
+	return u, nil
+}
+
+// forget drops the cached user after a change, also when the change failed
+// part way, and passes on its error.
+func (r *UserRepo) forget(uid int64, err error) error {
+	r.users.delete(uid)
+	return err
+}
+
+func (r *UserRepo) UpdatePasswordHash(ctx context.Context, uid int64, hash string) error {
+	return r.forget(uid, r.UserRepository.UpdatePasswordHash(ctx, uid, hash))
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, uid int64, at time.Time) error {
+	return r.forget(uid, r.UserRepository.MarkEmailVerified(ctx, uid, at))
+}
+
+func (r *UserRepo) UpdateEmail(ctx context.Context, uid int64, email string) error {
+	return r.forget(uid, r.UserRepository.UpdateEmail(ctx, uid, email))
+}
+
+func (r *UserRepo) SetRole(ctx context.Context, uid int64, role string) error {
+	return r.forget(uid, r.UserRepository.SetRole(ctx, uid, role))
+}
+
+func (r *UserRepo) SetDisabled(ctx context.Context, uid int64, at *time.Time) error {
+	return r.forget(uid, r.UserRepository.SetDisabled(ctx, uid, at))
+}
+
+func (r *UserRepo) SetPasswordResetRequired(ctx context.Context, uid int64, required bool) error {
+	return r.forget(uid, r.UserRepository.SetPasswordResetRequired(ctx, uid, required))
+}
+
+func (r *UserRepo) SetSuspended(ctx context.Context, uid int64, until *time.Time) error {
+	return r.forget(uid, r.UserRepository.SetSuspended(ctx, uid, until))
+}
+
+func (r *UserRepo) Delete(ctx context.Context, uid int64) error {
+	return r.forget(uid, r.UserRepository.Delete(ctx, uid))
+}
@@ -0,0 +1,49 @@
+package cached_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/cached"
+)
+
+type countingUsers struct {
+	domain.UserRepository
+	users   map[int64]domain.User
+	lookups int
+}
+
+func (c *countingUsers) GetByID(ctx context.Context, uid int64) (domain.User, error) {
+	c.lookups++
+	return c.users[uid], nil
+}
+
+func (c *countingUsers) SetDisabled(ctx context.Context, uid int64, at *time.Time) error {
+	u := c.users[uid]
+	u.DisabledAt = at
+	c.users[uid] = u
+	return nil
+}
+
+func TestUserRepo_CachesUntilChanged(t *testing.T) {
+	inner := &countingUsers{users: map[int64]domain.User{1: {ID: 1, PasswordHash: "$argon2id$"}}}
+	repo := cached.NewUserRepo(inner, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if u, _ := repo.GetByID(ctx, 1); u.PasswordHash != "" {
+			t.Fatalf("password hashes must not be served from the cache")
+		}
+	}
+	if inner.lookups != 1 {
+		t.Fatalf("expected one backend lookup, got %d", inner.lookups)
+	}
+
+	now := time.Now()
+	_ = repo.SetDisabled(ctx, 1, &now)
+	if u, _ := repo.GetByID(ctx, 1); u.DisabledAt == nil {
+		t.Fatalf("changes made through the cache must apply immediately")
+	}
+}
@@ -0,0 +1,332 @@
+// Package encrypted decorates note storage with envelope encryption.
+//
+// Every user owns one or more data keys (AES-256) that are stored wrapped by a
+// master key. Note titles and content are sealed with the user's newest data
+// key before they are handed to the underlying repository, and the data key ID
+// is stored on the row so older ciphertext stays readable after new keys are
+// introduced.
+package encrypted
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+const (
+	fieldTitle   = "title"
+	fieldContent = "content"
+)
+
+type NoteRepo struct {
+	inner    domain.NoteRepository
+	dataKeys domain.DataKeyRepository
+	keys     security.KeyProvider
+
+	mu    sync.RWMutex
+	cache map[int64][]byte // data key ID -> unwrapped key
+}
+
+func NewNoteRepo(inner domain.NoteRepository, dataKeys domain.DataKeyRepository, keys security.KeyProvider) *NoteRepo {
+	return &NoteRepo{
+		inner:    inner,
+		dataKeys: dataKeys,
+		keys:     keys,
+		cache:    make(map[int64][]byte),
+	}
+}
+
+func (r *NoteRepo) Create(ctx context.Context, note domain.Note) (domain.Note, error) {
+	plain := note
+	if err := r.seal(ctx, &note); err != nil {
+		return domain.Note{}, err
+	}
+	created, err := r.inner.Create(ctx, note)
+	if err != nil {
+		return domain.Note{}, err
+	}
+	created.Title, created.Content = plain.Title, plain.Content
+	return created, nil
+}
+
+func (r *NoteRepo) List(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+	notes, err := r.inner.List(ctx, uid, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		if err = r.open(ctx, &notes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return notes, nil
+}
+
+func (r *NoteRepo) Update(ctx context.Context, note domain.Note) (int64, error) {
+	if err := r.seal(ctx, &note); err != nil {
+		return 0, err
+	}
+	return r.inner.Update(ctx, note)
+}
+
+func (r *NoteRepo) GetByID(ctx context.Context, noteID, uid int64) (domain.Note, error) {
+	note, err := r.inner.GetByID(ctx, noteID, uid)
+	if err != nil {
+		return domain.Note{}, err
+	}
+	if err = r.open(ctx, &note); err != nil {
+		return domain.Note{}, err
+	}
+	return note, nil
+}
+
+func (r *NoteRepo) RemoveByID(ctx context.Context, noteID, uid, version int64) error {
+	return r.inner.RemoveByID(ctx, noteID, uid, version)
+}
+
+func (r *NoteRepo) ListDeleted(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+	notes, err := r.inner.ListDeleted(ctx, uid, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		if err = r.open(ctx, &notes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return notes, nil
+}
+
+func (r *NoteRepo) Restore(ctx context.Context, noteID, uid int64) error {
+	return r.inner.Restore(ctx, noteID, uid)
+}
+
+func (r *NoteRepo) DeletePermanently(ctx context.Context, noteID, uid int64) error {
+	return r.inner.DeletePermanently(ctx, noteID, uid)
+}
+
+func (r *NoteRepo) ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]domain.NoteRevision, error) {
+	revs, err := r.inner.ListRevisions(ctx, noteID, uid, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revs {
+		if err = r.openRevision(ctx, &revs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+func (r *NoteRepo) GetRevision(ctx context.Context, noteID, revisionID, uid int64) (domain.NoteRevision, error) {
+	rev, err := r.inner.GetRevision(ctx, noteID, revisionID, uid)
+	if err != nil {
+		return domain.NoteRevision{}, err
+	}
+	if err = r.openRevision(ctx, &rev); err != nil {
+		return domain.NoteRevision{}, err
+	}
+	return rev, nil
+}
+
+func (r *NoteRepo) PruneRevisions(ctx context.Context, noteID, uid int64, keep int) error {
+	return r.inner.PruneRevisions(ctx, noteID, uid, keep)
+}
+
+func (r *NoteRepo) SetArchived(ctx context.Context, noteID, uid int64, archived bool) error {
+	return r.inner.SetArchived(ctx, noteID, uid, archived)
+}
+
+// TagCounts passes through: tags are not encrypted.
+func (r *NoteRepo) TagCounts(ctx context.Context, uid int64) ([]domain.TagCount, error) {
+	return r.inner.TagCounts(ctx, uid)
+}
+
+// Reseal moves a stored (still encrypted) note onto the owner's current data
+// key. Legacy plaintext rows are encrypted. It reports false when the row is
+// already sealed with the current key or was encrypted by the client.
+func (r *NoteRepo) Reseal(ctx context.Context, stored domain.Note) (domain.Note, bool, error) {
+	if stored.ClientEncryption != nil {
+		return stored, false, nil
+	}
+	current, _, err := r.currentKey(ctx, stored.UserID)
+	if err != nil {
+		return domain.Note{}, false, err
+	}
+	if stored.KeyID != nil && *stored.KeyID == current {
+		return stored, false, nil
+	}
+	if err = r.open(ctx, &stored); err != nil {
+		return domain.Note{}, false, err
+	}
+	if err = r.seal(ctx, &stored); err != nil {
+		return domain.Note{}, false, err
+	}
+	return stored, true, nil
+}
+
+// ResealRevision is Reseal for a stored revision row.
+func (r *NoteRepo) ResealRevision(ctx context.Context, stored domain.NoteRevision) (domain.NoteRevision, bool, error) {
+	note, changed, err := r.Reseal(ctx, domain.Note{
+		UserID:           stored.UserID,
+		Title:            stored.Title,
+		Content:          stored.Content,
+		KeyID:            stored.KeyID,
+		ClientEncryption: stored.ClientEncryption,
+	})
+	if err != nil || !changed {
+		return stored, false, err
+	}
+	stored.Title, stored.Content, stored.KeyID = note.Title, note.Content, note.KeyID
+	return stored, true, nil
+}
+
+// seal encrypts Title and Content in place with the user's current data key.
+// Client-encrypted notes are already opaque and are stored as-is.
+func (r *NoteRepo) seal(ctx context.Context, note *domain.Note) error {
+	if note.ClientEncryption != nil {
+		note.KeyID = nil
+		return nil
+	}
+	keyID, key, err := r.currentKey(ctx, note.UserID)
+	if err != nil {
+		return err
+	}
+	if note.Title, err = sealField(key, note.UserID, fieldTitle, note.Title); err != nil {
+		return err
+	}
+	if note.Content, err = sealField(key, note.UserID, fieldContent, note.Content); err != nil {
+		return err
+	}
+	note.KeyID = &keyID
+	return nil
+}
+
+// open decrypts Title and Content in place. Rows without a key ID predate
+// encryption and are returned untouched.
+func (r *NoteRepo) open(ctx context.Context, note *domain.Note) error {
+	if note.KeyID == nil {
+		return nil
+	}
+	key, err := r.key(ctx, *note.KeyID, note.UserID)
+	if err != nil {
+		return err
+	}
+	if note.Title, err = openField(key, note.UserID, fieldTitle, note.Title); err != nil {
+		return err
+	}
+	if note.Content, err = openField(key, note.UserID, fieldContent, note.Content); err != nil {
+		return err
+	}
+	return nil
+}
+
+// openRevision decrypts a revision. Revisions are copies of the sealed note
+// row, so they open exactly like one, with the key that sealed them even if
+// the note has since moved to a newer key.
+func (r *NoteRepo) openRevision(ctx context.Context, rev *domain.NoteRevision) error {
+	note := domain.Note{UserID: rev.UserID, Title: rev.Title, Content: rev.Content, KeyID: rev.KeyID}
+	if err := r.open(ctx, &note); err != nil {
+		return err
+	}
+	rev.Title, rev.Content = note.Title, note.Content
+	return nil
+}
+
+// currentKey returns the newest data key of the user, creating one on first use.
+func (r *NoteRepo) currentKey(ctx context.Context, uid int64) (int64, []byte, error) {
+	dk, err := r.dataKeys.Current(ctx, uid)
+	if err == nil {
+		key, err := r.unwrap(ctx, dk)
+		return dk.ID, key, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil, err
+	}
+
+	key, err := security.NewDataKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	masterID, wrapped, err := r.keys.Wrap(ctx, key)
+	if err != nil {
+		return 0, nil, err
+	}
+	dk, err = r.dataKeys.Create(ctx, domain.DataKey{
+		UserID:      uid,
+		MasterKeyID: masterID,
+		WrappedKey:  wrapped,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	r.remember(dk.ID, key)
+	return dk.ID, key, nil
+}
+
+func (r *NoteRepo) key(ctx context.Context, keyID, uid int64) ([]byte, error) {
+	r.mu.RLock()
+	key, ok := r.cache[keyID]
+	r.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	dk, err := r.dataKeys.GetByID(ctx, keyID, uid)
+	if err != nil {
+		return nil, err
+	}
+	return r.unwrap(ctx, dk)
+}
+
+func (r *NoteRepo) unwrap(ctx context.Context, dk domain.DataKey) ([]byte, error) {
+	r.mu.RLock()
+	key, ok := r.cache[dk.ID]
+	r.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	key, err := r.keys.Unwrap(ctx, dk.MasterKeyID, dk.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	r.remember(dk.ID, key)
+	return key, nil
+}
+
+func (r *NoteRepo) remember(keyID int64, key []byte) {
+	r.mu.Lock()
+	r.cache[keyID] = key
+	r.mu.Unlock()
+}
+
+// aad binds a ciphertext to its owner and column so sealed values cannot be
+// swapped between users or between title and content.
+func aad(uid int64, field string) []byte {
+	return []byte(fmt.Sprintf("note:%d:%s", uid, field))
+}
+
+func sealField(key []byte, uid int64, field, value string) (string, error) {
+	sealed, err := security.Seal(key, []byte(value), aad(uid, field))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openField(key []byte, uid int64, field, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", security.ErrDecrypt
+	}
+	plain, err := security.Open(key, sealed, aad(uid, field))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
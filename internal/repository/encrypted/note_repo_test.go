@@ -0,0 +1,423 @@
+package encrypted_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/encrypted"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+// memNoteRepo stores notes exactly as it receives them so tests can inspect
+// what would reach the database.
+type memNoteRepo struct {
+	nextID    int64
+	rows      map[int64]domain.Note
+	revisions []domain.NoteRevision
+}
+
+func newMemNoteRepo() *memNoteRepo {
+	return &memNoteRepo{rows: make(map[int64]domain.Note)}
+}
+
+func (m *memNoteRepo) Create(ctx context.Context, note domain.Note) (domain.Note, error) {
+	m.nextID++
+	note.ID = m.nextID
+	m.rows[note.ID] = note
+	m.record(note)
+	return note, nil
+}
+
+func (m *memNoteRepo) record(note domain.Note) {
+	m.revisions = append(m.revisions, domain.NoteRevision{
+		ID:      int64(len(m.revisions) + 1),
+		NoteID:  note.ID,
+		UserID:  note.UserID,
+		Title:   note.Title,
+		Content: note.Content,
+		KeyID:   note.KeyID,
+	})
+}
+
+func (m *memNoteRepo) ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]domain.NoteRevision, error) {
+	var out []domain.NoteRevision
+	for i := len(m.revisions) - 1; i >= 0; i-- {
+		if r := m.revisions[i]; r.NoteID == noteID && r.UserID == uid {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memNoteRepo) GetRevision(ctx context.Context, noteID, revisionID, uid int64) (domain.NoteRevision, error) {
+	for _, r := range m.revisions {
+		if r.ID == revisionID && r.NoteID == noteID && r.UserID == uid {
+			return r, nil
+		}
+	}
+	return domain.NoteRevision{}, gorm.ErrRecordNotFound
+}
+
+func (m *memNoteRepo) PruneRevisions(ctx context.Context, noteID, uid int64, keep int) error {
+	return nil
+}
+
+func (m *memNoteRepo) List(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+	var out []domain.Note
+	for id := m.nextID; id > 0; id-- {
+		if n, ok := m.rows[id]; ok && n.UserID == uid && n.DeletedAt == nil {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (m *memNoteRepo) Update(ctx context.Context, note domain.Note) (int64, error) {
+	old, ok := m.rows[note.ID]
+	if !ok || old.UserID != note.UserID {
+		return 0, gorm.ErrRecordNotFound
+	}
+	note.Version = old.Version + 1
+	m.rows[note.ID] = note
+	m.record(note)
+	return note.Version, nil
+}
+
+func (m *memNoteRepo) GetByID(ctx context.Context, noteID, uid int64) (domain.Note, error) {
+	n, ok := m.rows[noteID]
+	if !ok || n.UserID != uid || n.DeletedAt != nil {
+		return domain.Note{}, gorm.ErrRecordNotFound
+	}
+	return n, nil
+}
+
+func (m *memNoteRepo) RemoveByID(ctx context.Context, noteID, uid, version int64) error {
+	n, ok := m.rows[noteID]
+	if !ok || n.UserID != uid || n.DeletedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	n.DeletedAt = &now
+	m.rows[noteID] = n
+	return nil
+}
+
+func (m *memNoteRepo) ListDeleted(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+	var out []domain.Note
+	for id := m.nextID; id > 0; id-- {
+		if n, ok := m.rows[id]; ok && n.UserID == uid && n.DeletedAt != nil {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (m *memNoteRepo) Restore(ctx context.Context, noteID, uid int64) error {
+	n, ok := m.rows[noteID]
+	if !ok || n.UserID != uid || n.DeletedAt == nil {
+		return gorm.ErrRecordNotFound
+	}
+	n.DeletedAt = nil
+	m.rows[noteID] = n
+	return nil
+}
+
+func (m *memNoteRepo) DeletePermanently(ctx context.Context, noteID, uid int64) error {
+	n, ok := m.rows[noteID]
+	if !ok || n.UserID != uid || n.DeletedAt == nil {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.rows, noteID)
+	return nil
+}
+
+func (m *memNoteRepo) SetArchived(ctx context.Context, noteID, uid int64, archived bool) error {
+	n, ok := m.rows[noteID]
+	if !ok || n.UserID != uid {
+		return gorm.ErrRecordNotFound
+	}
+	n.IsArchived = archived
+	m.rows[noteID] = n
+	return nil
+}
+
+func (m *memNoteRepo) TagCounts(ctx context.Context, uid int64) ([]domain.TagCount, error) {
+	return nil, nil
+}
+
+type memKeyRepo struct {
+	keys []domain.DataKey
+}
+
+func (m *memKeyRepo) Create(ctx context.Context, key domain.DataKey) (domain.DataKey, error) {
+	key.ID = int64(len(m.keys) + 1)
+	m.keys = append(m.keys, key)
+	return key, nil
+}
+
+func (m *memKeyRepo) GetByID(ctx context.Context, keyID, uid int64) (domain.DataKey, error) {
+	for _, k := range m.keys {
+		if k.ID == keyID && k.UserID == uid {
+			return k, nil
+		}
+	}
+	return domain.DataKey{}, gorm.ErrRecordNotFound
+}
+
+func (m *memKeyRepo) Current(ctx context.Context, uid int64) (domain.DataKey, error) {
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].UserID == uid {
+			return m.keys[i], nil
+		}
+	}
+	return domain.DataKey{}, gorm.ErrRecordNotFound
+}
+
+func (m *memKeyRepo) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.DataKey, error) {
+	var out []domain.DataKey
+	for _, k := range m.keys {
+		if k.ID > afterID && len(out) < limit {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (m *memKeyRepo) CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error) {
+	var n int64
+	for _, k := range m.keys {
+		if k.MasterKeyID != masterKeyID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memKeyRepo) UserIDsAfter(ctx context.Context, afterUID int64, limit int) ([]int64, error) {
+	panic("not used")
+}
+
+func (m *memKeyRepo) Rewrap(ctx context.Context, key domain.DataKey) error {
+	m.keys[key.ID-1] = key
+	return nil
+}
+
+func newRing(t *testing.T) *security.Keyring {
+	t.Helper()
+	ring, err := security.NewKeyring("v1", map[string][]byte{"v1": bytes.Repeat([]byte{7}, security.DataKeySize)})
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	return ring
+}
+
+func TestNoteRepo_CreateStoresCiphertext(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+
+	created, err := repo.Create(context.Background(), domain.Note{UserID: 10, Title: "secret title", Content: "secret body"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Title != "secret title" || created.Content != "secret body" {
+		t.Fatalf("caller should get plaintext back, got %+v", created)
+	}
+
+	stored := inner.rows[created.ID]
+	if strings.Contains(stored.Title, "secret") || strings.Contains(stored.Content, "secret") {
+		t.Fatalf("plaintext reached storage: %+v", stored)
+	}
+	if stored.KeyID == nil || len(keys.keys) != 1 || *stored.KeyID != keys.keys[0].ID {
+		t.Fatalf("row not bound to the user's data key: %+v", stored)
+	}
+	if keys.keys[0].MasterKeyID != "v1" {
+		t.Fatalf("data key wrapped by %q, want v1", keys.keys[0].MasterKeyID)
+	}
+}
+
+func TestNoteRepo_RoundTrip(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	created, _ := repo.Create(ctx, domain.Note{UserID: 10, Title: "t1", Content: "c1"})
+	if _, err := repo.Update(ctx, domain.Note{ID: created.ID, UserID: 10, Title: "t2", Content: "c2"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, created.ID, 10)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Title != "t2" || got.Content != "c2" {
+		t.Fatalf("unexpected note: %+v", got)
+	}
+
+	// A second note reuses the existing data key.
+	_, _ = repo.Create(ctx, domain.Note{UserID: 10, Title: "t3", Content: "c3"})
+	list, err := repo.List(ctx, 10, domain.NoteFilter{}, 20, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 || list[0].Title != "t3" || list[1].Title != "t2" {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	if len(keys.keys) != 1 {
+		t.Fatalf("expected one data key per user, got %d", len(keys.keys))
+	}
+}
+
+func TestNoteRepo_RevisionsAreSealed(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	created, _ := repo.Create(ctx, domain.Note{UserID: 10, Title: "secret v1", Content: "body v1"})
+	if _, err := repo.Update(ctx, domain.Note{ID: created.ID, UserID: 10, Title: "secret v2", Content: "body v2"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	for _, stored := range inner.revisions {
+		if strings.Contains(stored.Title, "secret") || strings.Contains(stored.Content, "body") || stored.KeyID == nil {
+			t.Fatalf("revision stored in the clear: %+v", stored)
+		}
+	}
+
+	revs, err := repo.ListRevisions(ctx, created.ID, 10, 20, 0)
+	if err != nil {
+		t.Fatalf("list revisions: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Title != "secret v2" || revs[1].Content != "body v1" {
+		t.Fatalf("unexpected revisions: %+v", revs)
+	}
+	rev, err := repo.GetRevision(ctx, created.ID, revs[1].ID, 10)
+	if err != nil || rev.Title != "secret v1" {
+		t.Fatalf("get revision: %+v, %v", rev, err)
+	}
+}
+
+func TestNoteRepo_TrashIsDecrypted(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	created, _ := repo.Create(ctx, domain.Note{UserID: 10, Title: "t1", Content: "c1"})
+	if err := repo.RemoveByID(ctx, created.ID, 10, 0); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	trash, err := repo.ListDeleted(ctx, 10, 20, 0)
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Title != "t1" || trash[0].Content != "c1" {
+		t.Fatalf("unexpected trash: %+v", trash)
+	}
+}
+
+func TestNoteRepo_LegacyPlaintextPassthrough(t *testing.T) {
+	inner := newMemNoteRepo()
+	legacy, _ := inner.Create(context.Background(), domain.Note{UserID: 10, Title: "old", Content: "plain"})
+	repo := encrypted.NewNoteRepo(inner, &memKeyRepo{}, newRing(t))
+
+	got, err := repo.GetByID(context.Background(), legacy.ID, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Title != "old" || got.Content != "plain" {
+		t.Fatalf("legacy note altered: %+v", got)
+	}
+}
+
+func TestNoteRepo_SwappedCiphertextFails(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	created, _ := repo.Create(ctx, domain.Note{UserID: 10, Title: "title", Content: "content"})
+	row := inner.rows[created.ID]
+	row.Title, row.Content = row.Content, row.Title
+	inner.rows[created.ID] = row
+
+	if _, err := repo.GetByID(ctx, created.ID, 10); !errors.Is(err, security.ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt, got: %v", err)
+	}
+}
+
+func TestNoteRepo_ResealMovesToCurrentKey(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	legacy, _ := inner.Create(ctx, domain.Note{UserID: 10, Title: "old", Content: "plain"})
+	sealed, changed, err := repo.Reseal(ctx, inner.rows[legacy.ID])
+	if err != nil || !changed {
+		t.Fatalf("legacy row should be sealed: changed=%v err=%v", changed, err)
+	}
+	if sealed.KeyID == nil || sealed.Title == "old" {
+		t.Fatalf("row not encrypted: %+v", sealed)
+	}
+	inner.rows[legacy.ID] = sealed
+
+	if _, changed, _ = repo.Reseal(ctx, sealed); changed {
+		t.Fatalf("row already on the current key should be left alone")
+	}
+
+	// A newer data key makes the row stale again.
+	_, _ = keys.Create(ctx, domain.DataKey{UserID: 10, MasterKeyID: keys.keys[0].MasterKeyID, WrappedKey: keys.keys[0].WrappedKey})
+	resealed, changed, err := repo.Reseal(ctx, sealed)
+	if err != nil || !changed || *resealed.KeyID != 2 {
+		t.Fatalf("expected move to key 2: changed=%v err=%v note=%+v", changed, err, resealed)
+	}
+	inner.rows[legacy.ID] = resealed
+	got, err := repo.GetByID(ctx, legacy.ID, 10)
+	if err != nil || got.Title != "old" || got.Content != "plain" {
+		t.Fatalf("unexpected note after reseal: %+v %v", got, err)
+	}
+}
+
+func TestNoteRepo_ResealRevisionMovesToCurrentKey(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	created, _ := repo.Create(ctx, domain.Note{UserID: 10, Title: "t1", Content: "c1"})
+	stored := inner.revisions[0]
+	if _, changed, _ := repo.ResealRevision(ctx, stored); changed {
+		t.Fatalf("revision already on the current key should be left alone")
+	}
+
+	_, _ = keys.Create(ctx, domain.DataKey{UserID: 10, MasterKeyID: keys.keys[0].MasterKeyID, WrappedKey: keys.keys[0].WrappedKey})
+	resealed, changed, err := repo.ResealRevision(ctx, stored)
+	if err != nil || !changed || *resealed.KeyID != 2 || resealed.ID != stored.ID || resealed.NoteID != created.ID {
+		t.Fatalf("expected move to key 2: changed=%v err=%v rev=%+v", changed, err, resealed)
+	}
+	inner.revisions[0] = resealed
+	got, err := repo.GetRevision(ctx, created.ID, stored.ID, 10)
+	if err != nil || got.Title != "t1" || got.Content != "c1" {
+		t.Fatalf("unexpected revision after reseal: %+v %v", got, err)
+	}
+}
+
+func TestNoteRepo_ClientEncryptedStoredAsIs(t *testing.T) {
+	inner, keys := newMemNoteRepo(), &memKeyRepo{}
+	repo := encrypted.NewNoteRepo(inner, keys, newRing(t))
+	ctx := context.Background()
+
+	note := domain.Note{UserID: 10, Content: "b3BhcXVl", ClientEncryption: &domain.ClientEncryption{Algorithm: domain.AlgAES256GCM}}
+	created, err := repo.Create(ctx, note)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored := inner.rows[created.ID]
+	if stored.Content != "b3BhcXVl" || stored.KeyID != nil || len(keys.keys) != 0 {
+		t.Fatalf("opaque payload should bypass server-side encryption: %+v", stored)
+	}
+	if _, changed, _ := repo.Reseal(ctx, stored); changed {
+		t.Fatalf("reseal must skip client-encrypted notes")
+	}
+}
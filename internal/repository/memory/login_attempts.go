@@ -0,0 +1,62 @@
+// Package memory holds process-local stores for single-instance deployments
+// and tests.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+// LoginAttemptStore keeps login failure counters in memory. Counters are not
+// shared between instances and are lost on restart.
+type LoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempt
+}
+
+func NewLoginAttemptStore() *LoginAttemptStore {
+	return &LoginAttemptStore{attempts: make(map[string]domain.LoginAttempt)}
+}
+
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[key]
+	if !ok {
+		return domain.LoginAttempt{Key: key}, nil
+	}
+	return a, nil
+}
+
+func (s *LoginAttemptStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[key]
+	if !ok || a.LastFailureAt.Before(now.Add(-window)) {
+		a = domain.LoginAttempt{Key: key}
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	s.attempts[key] = a
+	return a, nil
+}
+
+func (s *LoginAttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.attempts[key]; ok {
+		a.BlockedUntil = &until
+		s.attempts[key] = a
+	}
+	return nil
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
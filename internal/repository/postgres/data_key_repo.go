@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+)
+
+type DataKeyRepo struct {
+	db *gorm.DB
+}
+
+func NewDataKeyRepo(db *gorm.DB) *DataKeyRepo {
+	return &DataKeyRepo{db: db}
+}
+
+func (r DataKeyRepo) Create(ctx context.Context, key domain.DataKey) (domain.DataKey, error) {
+	if err := r.db.WithContext(ctx).Create(&key).Error; err != nil {
+		return domain.DataKey{}, err
+	}
+	return key, nil
+}
+
+func (r DataKeyRepo) GetByID(ctx context.Context, keyID, uid int64) (domain.DataKey, error) {
+	var key domain.DataKey
+	if err := r.db.WithContext(ctx).First(&key, "id = ? and user_id = ?", keyID, uid).Error; err != nil {
+		return domain.DataKey{}, err
+	}
+	return key, nil
+}
+
+// Current returns the newest data key of the user.
+func (r DataKeyRepo) Current(ctx context.Context, uid int64) (domain.DataKey, error) {
+	var key domain.DataKey
+	if err := r.db.WithContext(ctx).Where("user_id = ?", uid).Order("id DESC").
+		First(&key).Error; err != nil {
+		return domain.DataKey{}, err
+	}
+	return key, nil
+}
+
+// ListAfter pages through the data keys of all users in ID order.
+func (r DataKeyRepo) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.DataKey, error) {
+	var keys []domain.DataKey
+	if err := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r DataKeyRepo) CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error) {
+	var n int64
+	if err := r.db.WithContext(ctx).Model(&domain.DataKey{}).Where("master_key_id <> ?", masterKeyID).
+		Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// UserIDsAfter pages through the distinct owners of data keys.
+func (r DataKeyRepo) UserIDsAfter(ctx context.Context, afterUID int64, limit int) ([]int64, error) {
+	var ids []int64
+	if err := r.db.WithContext(ctx).Model(&domain.DataKey{}).Distinct("user_id").Where("user_id > ?", afterUID).
+		Order("user_id ASC").Limit(limit).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Rewrap replaces the wrapped material of a key; the key itself is unchanged.
+func (r DataKeyRepo) Rewrap(ctx context.Context, key domain.DataKey) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.DataKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]any{
+			"master_key_id": key.MasterKeyID,
+			"wrapped_key":   key.WrappedKey,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type UserIdentityRepo struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepo(db *gorm.DB) *UserIdentityRepo {
+	return &UserIdentityRepo{db: db}
+}
+
+func (r UserIdentityRepo) Get(ctx context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	if err := r.db.WithContext(ctx).First(&identity, "issuer = ? and subject = ?", issuer, subject).Error; err != nil {
+		return domain.UserIdentity{}, err
+	}
+	return identity, nil
+}
+
+func (r UserIdentityRepo) Create(ctx context.Context, identity domain.UserIdentity) (domain.UserIdentity, error) {
+	if err := r.db.WithContext(ctx).Create(&identity).Error; err != nil {
+		return domain.UserIdentity{}, err
+	}
+	return identity, nil
+}
+
+type OIDCAuthRequestRepo struct {
+	db *gorm.DB
+}
+
+func NewOIDCAuthRequestRepo(db *gorm.DB) *OIDCAuthRequestRepo {
+	return &OIDCAuthRequestRepo{db: db}
+}
+
+func (r OIDCAuthRequestRepo) Create(ctx context.Context, req domain.OIDCAuthRequest) error {
+	return r.db.WithContext(ctx).Create(&req).Error
+}
+
+// Take deletes with RETURNING so two callbacks racing on one state cannot
+// both get the request.
+func (r OIDCAuthRequestRepo) Take(ctx context.Context, stateHash string) (domain.OIDCAuthRequest, error) {
+	var req domain.OIDCAuthRequest
+	tx := r.db.WithContext(ctx).Raw(`
+		DELETE FROM oidc_auth_requests WHERE state_hash = ?
+		RETURNING state_hash, nonce, code_verifier, expires_at, created_at`,
+		stateHash).Scan(&req)
+	if tx.Error != nil {
+		return domain.OIDCAuthRequest{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return domain.OIDCAuthRequest{}, gorm.ErrRecordNotFound
+	}
+	return req, nil
+}
+
+// PurgeExpired drops sign-ins that were started but never finished.
+func (r OIDCAuthRequestRepo) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	tx := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.OIDCAuthRequest{})
+	return tx.RowsAffected, tx.Error
+}
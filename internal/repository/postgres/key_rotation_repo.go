@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+)
+
+type KeyRotationRepo struct {
+	db *gorm.DB
+}
+
+func NewKeyRotationRepo(db *gorm.DB) *KeyRotationRepo {
+	return &KeyRotationRepo{db: db}
+}
+
+func (r KeyRotationRepo) Create(ctx context.Context, job domain.KeyRotationJob) (domain.KeyRotationJob, error) {
+	if err := r.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return domain.KeyRotationJob{}, err
+	}
+	return job, nil
+}
+
+// Unfinished returns the most recent job that has not reached the done phase.
+func (r KeyRotationRepo) Unfinished(ctx context.Context) (domain.KeyRotationJob, error) {
+	var job domain.KeyRotationJob
+	if err := r.db.WithContext(ctx).Where("finished_at IS NULL").Order("id DESC").
+		First(&job).Error; err != nil {
+		return domain.KeyRotationJob{}, err
+	}
+	return job, nil
+}
+
+func (r KeyRotationRepo) Save(ctx context.Context, job domain.KeyRotationJob) error {
+	return r.db.WithContext(ctx).Save(&job).Error
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type LoginAttemptRepo struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepo(db *gorm.DB) *LoginAttemptRepo {
+	return &LoginAttemptRepo{db: db}
+}
+
+func (r LoginAttemptRepo) Get(ctx context.Context, key string) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := r.db.WithContext(ctx).First(&attempt, "attempt_key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return domain.LoginAttempt{}, err
+	}
+	return attempt, nil
+}
+
+// Fail increments in a single upsert so concurrent failures are all counted.
+func (r LoginAttemptRepo) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING attempt_key, failures, last_failure_at, blocked_until`,
+		key, now, now.Add(-window)).Scan(&attempt).Error
+	if err != nil {
+		return domain.LoginAttempt{}, err
+	}
+	return attempt, nil
+}
+
+func (r LoginAttemptRepo) Block(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.LoginAttempt{}).
+		Where("attempt_key = ?", key).
+		Update("blocked_until", until).Error
+}
+
+func (r LoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Delete(&domain.LoginAttempt{}, "attempt_key = ?", key).Error
+}
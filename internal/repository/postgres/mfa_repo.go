@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type MFARepo struct {
+	db *gorm.DB
+}
+
+func NewMFARepo(db *gorm.DB) *MFARepo {
+	return &MFARepo{db: db}
+}
+
+func (r MFARepo) Get(ctx context.Context, uid int64) (domain.UserMFA, error) {
+	var mfa domain.UserMFA
+	if err := r.db.WithContext(ctx).First(&mfa, "user_id = ?", uid).Error; err != nil {
+		return domain.UserMFA{}, err
+	}
+	return mfa, nil
+}
+
+// Upsert never replaces an enabled enrollment; the conflict update only
+// applies while enabled_at is still NULL.
+func (r MFARepo) Upsert(ctx context.Context, mfa domain.UserMFA) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"secret_key_id", "secret_wrapped", "last_used_step", "created_at"}),
+			Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_mfa.enabled_at IS NULL"}}},
+		}).
+		Create(&mfa).Error
+}
+
+func (r MFARepo) Enable(ctx context.Context, uid int64, step int64) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.UserMFA{}).
+		Where("user_id = ?", uid).
+		Updates(map[string]any{"enabled_at": time.Now(), "last_used_step": step}).Error
+}
+
+func (r MFARepo) Delete(ctx context.Context, uid int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", uid).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", uid).Delete(&domain.UserMFA{}).Error
+	})
+}
+
+func (r MFARepo) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.UserMFA{}).
+		Where("user_id = ? and last_used_step < ?", uid, step).
+		Update("last_used_step", step)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return tx.RowsAffected == 1, nil
+}
+
+func (r MFARepo) ReplaceRecoveryCodes(ctx context.Context, uid int64, hashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", uid).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		codes := make([]domain.RecoveryCode, len(hashes))
+		for i, h := range hashes {
+			codes[i] = domain.RecoveryCode{UserID: uid, CodeHash: h}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// ListAfter pages through the enrollments of all users in user ID order.
+func (r MFARepo) ListAfter(ctx context.Context, afterUID int64, limit int) ([]domain.UserMFA, error) {
+	var rows []domain.UserMFA
+	if err := r.db.WithContext(ctx).Where("user_id > ?", afterUID).Order("user_id ASC").Limit(limit).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r MFARepo) CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error) {
+	var n int64
+	if err := r.db.WithContext(ctx).Model(&domain.UserMFA{}).Where("secret_key_id <> ?", masterKeyID).
+		Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r MFARepo) Rewrap(ctx context.Context, mfa domain.UserMFA, fromWrapped []byte) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.UserMFA{}).
+		Where("user_id = ? and secret_wrapped = ?", mfa.UserID, fromWrapped).
+		Updates(map[string]any{
+			"secret_key_id":  mfa.SecretKeyID,
+			"secret_wrapped": mfa.SecretWrapped,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r MFARepo) UseRecoveryCode(ctx context.Context, uid int64, hash string) (bool, error) {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.RecoveryCode{}).
+		Where("user_id = ? and code_hash = ? and used_at IS NULL", uid, hash).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return tx.RowsAffected > 0, nil
+}
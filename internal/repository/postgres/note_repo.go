@@ -2,8 +2,12 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"time"
+
 	"github.com/secure-notes/internal/domain"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NoteRepo struct {
@@ -14,18 +18,56 @@ func NewNoteRepo(db *gorm.DB) *NoteRepo {
 	return &NoteRepo{db: db}
 }
 
-func (r NoteRepo) List(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+// noteTag is a row of the note_tags join table.
+type noteTag struct {
+	NoteID int64
+	TagID  int64
+}
+
+func (noteTag) TableName() string { return "note_tags" }
+
+func (r NoteRepo) List(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+	q := r.db.WithContext(ctx).Where("user_id = ? AND deleted_at IS NULL", uid)
+	switch filter.Archived {
+	case domain.ArchivedHidden:
+		q = q.Where("is_archived = false")
+	case domain.ArchivedOnly:
+		q = q.Where("is_archived = true")
+	}
+	if len(filter.Tags) > 0 {
+		tagged := r.db.Table("note_tags").
+			Select("note_tags.note_id").
+			Joins("JOIN tags ON tags.id = note_tags.tag_id").
+			Where("tags.user_id = ? AND tags.name IN ?", uid, filter.Tags)
+		if filter.MatchAllTags {
+			tagged = tagged.Group("note_tags.note_id").Having("COUNT(*) = ?", len(filter.Tags))
+		}
+		q = q.Where("id IN (?)", tagged)
+	}
 	var notes []domain.Note
-	if err := r.db.WithContext(ctx).Where("user_id = ?", uid).Limit(limit).Offset(offset).Order("id DESC").
+	if err := q.Limit(limit).Offset(offset).Order("id DESC").
 		Find(&notes).Error; err != nil {
 
 		return nil, err
 	}
+	if err := r.loadTags(ctx, notes); err != nil {
+		return nil, err
+	}
 	return notes, nil
 }
 
 func (r NoteRepo) Create(ctx context.Context, note domain.Note) (domain.Note, error) {
-	if err := r.db.WithContext(ctx).Create(&note).Error; err != nil {
+	note.Version = 1
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, note); err != nil {
+			return err
+		}
+		return setTags(tx, note.ID, note.UserID, note.Tags)
+	})
+	if err != nil {
 		return domain.Note{}, err
 	}
 	return note, nil
@@ -33,20 +75,281 @@ func (r NoteRepo) Create(ctx context.Context, note domain.Note) (domain.Note, er
 
 func (r NoteRepo) GetByID(ctx context.Context, noteID, uid int64) (domain.Note, error) {
 	var note domain.Note
-	if err := r.db.WithContext(ctx).First(&note, "id = ? and user_id = ?", noteID, uid).Error; err != nil {
+	if err := r.db.WithContext(ctx).First(&note, "id = ? and user_id = ? and deleted_at IS NULL", noteID, uid).Error; err != nil {
 		return domain.Note{}, err
 	}
-	return note, nil
+	notes := []domain.Note{note}
+	if err := r.loadTags(ctx, notes); err != nil {
+		return domain.Note{}, err
+	}
+	return notes[0], nil
 }
-func (r NoteRepo) Update(ctx context.Context, note domain.Note) error {
+func (r NoteRepo) Update(ctx context.Context, note domain.Note) (int64, error) {
+	var updated domain.Note
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Model(&updated).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "version"}}}).
+			Where("id = ? and user_id = ? and deleted_at IS NULL", note.ID, note.UserID)
+		if note.Version > 0 {
+			q = q.Where("version = ?", note.Version)
+		}
+		res := q.Updates(map[string]any{
+			"title":             note.Title,
+			"content":           note.Content,
+			"key_id":            note.KeyID,
+			"client_encryption": clientEncryptionJSON(note.ClientEncryption),
+			"version":           gorm.Expr("version + 1"),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missOrConflict(tx, note.ID, note.UserID, note.Version)
+		}
+		if err := recordRevision(tx, note); err != nil {
+			return err
+		}
+		if note.Tags == nil {
+			return nil
+		}
+		return setTags(tx, note.ID, note.UserID, note.Tags)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated.Version, nil
+}
+
+func (r NoteRepo) SetArchived(ctx context.Context, noteID, uid int64, archived bool) error {
 	tx := r.db.WithContext(ctx).
 		Model(&domain.Note{}).
-		Where("id = ? and user_id = ? ", note.ID, note.UserID).
+		Where("id = ? and user_id = ? and deleted_at IS NULL", noteID, uid).
 		Updates(map[string]any{
-			"title":   note.Title,
-			"content": note.Content,
+			"is_archived": archived,
+			"version":     gorm.Expr("version + 1"),
 		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r NoteRepo) TagCounts(ctx context.Context, uid int64) ([]domain.TagCount, error) {
+	var counts []domain.TagCount
+	err := r.db.WithContext(ctx).
+		Table("tags").
+		Select("tags.name, COUNT(*) AS count").
+		Joins("JOIN note_tags ON note_tags.tag_id = tags.id").
+		Joins("JOIN notes ON notes.id = note_tags.note_id").
+		Where("tags.user_id = ? AND notes.deleted_at IS NULL", uid).
+		Group("tags.name").
+		Order("tags.name").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// recordRevision stores the title and content just written as they are,
+// already sealed by the caller.
+func recordRevision(tx *gorm.DB, note domain.Note) error {
+	return tx.Create(&domain.NoteRevision{
+		NoteID:           note.ID,
+		UserID:           note.UserID,
+		Title:            note.Title,
+		Content:          note.Content,
+		KeyID:            note.KeyID,
+		ClientEncryption: note.ClientEncryption,
+	}).Error
+}
+
+func (r NoteRepo) ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]domain.NoteRevision, error) {
+	if err := checkActive(r.db.WithContext(ctx), noteID, uid); err != nil {
+		return nil, err
+	}
+	var revs []domain.NoteRevision
+	if err := r.db.WithContext(ctx).
+		Where("note_id = ? AND user_id = ?", noteID, uid).
+		Limit(limit).Offset(offset).Order("id DESC").
+		Find(&revs).Error; err != nil {
+
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (r NoteRepo) GetRevision(ctx context.Context, noteID, revisionID, uid int64) (domain.NoteRevision, error) {
+	if err := checkActive(r.db.WithContext(ctx), noteID, uid); err != nil {
+		return domain.NoteRevision{}, err
+	}
+	var rev domain.NoteRevision
+	if err := r.db.WithContext(ctx).
+		First(&rev, "id = ? AND note_id = ? AND user_id = ?", revisionID, noteID, uid).Error; err != nil {
+		return domain.NoteRevision{}, err
+	}
+	return rev, nil
+}
+
+func (r NoteRepo) PruneRevisions(ctx context.Context, noteID, uid int64, keep int) error {
+	newest := r.db.Model(&domain.NoteRevision{}).
+		Select("id").
+		Where("note_id = ?", noteID).
+		Order("id DESC").
+		Limit(keep)
+	return r.db.WithContext(ctx).
+		Where("note_id = ? AND user_id = ? AND id NOT IN (?)", noteID, uid, newest).
+		Delete(&domain.NoteRevision{}).Error
+}
+
+// checkActive reports gorm.ErrRecordNotFound unless the user owns the note
+// and it is not in the trash.
+func checkActive(db *gorm.DB, noteID, uid int64) error {
+	var n int64
+	err := db.Model(&domain.Note{}).
+		Where("id = ? and user_id = ? and deleted_at IS NULL", noteID, uid).
+		Count(&n).Error
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// setTags replaces the tags of a note, creating the ones its owner has not
+// used before. Unused tags are kept; TagCounts skips them.
+func setTags(tx *gorm.DB, noteID, uid int64, names []string) error {
+	if err := tx.Where("note_id = ?", noteID).Delete(&noteTag{}).Error; err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	tags := make([]domain.Tag, len(names))
+	for i, name := range names {
+		tags[i] = domain.Tag{UserID: uid, Name: name}
+	}
+	// Updating the name to itself makes RETURNING report the ID of tags
+	// that already exist.
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name"}),
+	}).Create(&tags).Error
+	if err != nil {
+		return err
+	}
+	links := make([]noteTag, len(tags))
+	for i, t := range tags {
+		links[i] = noteTag{NoteID: noteID, TagID: t.ID}
+	}
+	return tx.Create(&links).Error
+}
+
+// loadTags fills in Tags, in name order, for a page of notes.
+func (r NoteRepo) loadTags(ctx context.Context, notes []domain.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	var rows []struct {
+		NoteID int64
+		Name   string
+	}
+	err := r.db.WithContext(ctx).
+		Table("note_tags").
+		Select("note_tags.note_id, tags.name").
+		Joins("JOIN tags ON tags.id = note_tags.tag_id").
+		Where("note_tags.note_id IN ?", ids).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	byNote := make(map[int64][]string, len(notes))
+	for _, row := range rows {
+		byNote[row.NoteID] = append(byNote[row.NoteID], row.Name)
+	}
+	for i := range notes {
+		notes[i].Tags = byNote[notes[i].ID]
+		if notes[i].Tags == nil {
+			notes[i].Tags = []string{}
+		}
+	}
+	return nil
+}
 
+func (r NoteRepo) RemoveByID(ctx context.Context, noteID, uid, version int64) error {
+	q := r.db.WithContext(ctx).
+		Model(&domain.Note{}).
+		Where("id = ? and user_id = ? and deleted_at IS NULL", noteID, uid)
+	if version > 0 {
+		q = q.Where("version = ?", version)
+	}
+	tx := q.Update("deleted_at", time.Now())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return missOrConflict(r.db.WithContext(ctx), noteID, uid, version)
+	}
+	return nil
+}
+
+// missOrConflict explains why a versioned write matched no row: the note
+// is gone, or it exists at another version.
+func missOrConflict(db *gorm.DB, noteID, uid, version int64) error {
+	if version == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := checkActive(db, noteID, uid); err != nil {
+		return err
+	}
+	return domain.ErrVersionConflict
+}
+
+func (r NoteRepo) ListDeleted(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+	var notes []domain.Note
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND deleted_at IS NOT NULL", uid).
+		Limit(limit).Offset(offset).Order("deleted_at DESC, id DESC").
+		Find(&notes).Error; err != nil {
+
+		return nil, err
+	}
+	if err := r.loadTags(ctx, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (r NoteRepo) Restore(ctx context.Context, noteID, uid int64) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.Note{}).
+		Where("id = ? and user_id = ? and deleted_at IS NOT NULL", noteID, uid).
+		Update("deleted_at", nil)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeletePermanently only matches notes in the trash, so a note is always
+// recoverable for a while after a single delete.
+func (r NoteRepo) DeletePermanently(ctx context.Context, noteID, uid int64) error {
+	tx := r.db.WithContext(ctx).
+		Where("id = ? and user_id = ? and deleted_at IS NOT NULL", noteID, uid).
+		Delete(&domain.Note{})
 	if tx.Error != nil {
 		return tx.Error
 	}
@@ -56,14 +359,137 @@ func (r NoteRepo) Update(ctx context.Context, note domain.Note) error {
 	return nil
 }
 
-func (r NoteRepo) RemoveByID(ctx context.Context, noteID, uid int64) error {
+// ScanAll pages through the notes of all users in ID order.
+func (r NoteRepo) ScanAll(ctx context.Context, afterID int64, limit int) ([]domain.Note, error) {
+	var notes []domain.Note
+	if err := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (r NoteRepo) CountAll(ctx context.Context) (int64, error) {
+	var n int64
+	if err := r.db.WithContext(ctx).Model(&domain.Note{}).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Load reads one note row by ID, whatever its owner and whether or not it is
+// in the trash.
+func (r NoteRepo) Load(ctx context.Context, noteID int64) (domain.Note, error) {
 	var note domain.Note
-	Rerr := r.db.WithContext(ctx).Delete(&note).Where("id = ? and user_id = ? ", noteID, uid)
-	if Rerr.Error != nil {
-		return Rerr.Error
+	if err := r.db.WithContext(ctx).First(&note, "id = ?", noteID).Error; err != nil {
+		return domain.Note{}, err
 	}
-	if Rerr.RowsAffected <= 0 {
+	return note, nil
+}
+
+// Rewrite stores re-encrypted title and content for a note. The version is
+// left alone: the note reads the same, so clients' ETags stay valid. It only
+// applies to the version the note was read at, so an edit made since is
+// never overwritten with older text.
+func (r NoteRepo) Rewrite(ctx context.Context, note domain.Note) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.Note{}).
+		Where("id = ? and user_id = ? and version = ?", note.ID, note.UserID, note.Version).
+		Updates(map[string]any{
+			"title":   note.Title,
+			"content": note.Content,
+			"key_id":  note.KeyID,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return staleOrGone(r.db.WithContext(ctx), &domain.Note{}, note.ID)
+	}
+	return nil
+}
+
+// staleOrGone explains a rewrite that matched no row: ErrRecordNotFound when
+// the row was deleted, ErrVersionConflict when it changed since it was read.
+func staleOrGone(db *gorm.DB, model any, id int64) error {
+	var n int64
+	if err := db.Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
 		return gorm.ErrRecordNotFound
 	}
+	return domain.ErrVersionConflict
+}
+
+// ScanRevisions pages through the revisions of all notes in ID order.
+func (r NoteRepo) ScanRevisions(ctx context.Context, afterID int64, limit int) ([]domain.NoteRevision, error) {
+	var revs []domain.NoteRevision
+	if err := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).
+		Find(&revs).Error; err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+func (r NoteRepo) CountRevisions(ctx context.Context) (int64, error) {
+	var n int64
+	if err := r.db.WithContext(ctx).Model(&domain.NoteRevision{}).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// LoadRevision reads one revision row by ID.
+func (r NoteRepo) LoadRevision(ctx context.Context, revisionID int64) (domain.NoteRevision, error) {
+	var rev domain.NoteRevision
+	if err := r.db.WithContext(ctx).First(&rev, "id = ?", revisionID).Error; err != nil {
+		return domain.NoteRevision{}, err
+	}
+	return rev, nil
+}
+
+// RewriteRevision stores re-encrypted title and content for a revision that
+// is still sealed with fromKeyID.
+func (r NoteRepo) RewriteRevision(ctx context.Context, rev domain.NoteRevision, fromKeyID *int64) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.NoteRevision{}).
+		Where("id = ? and user_id = ? and key_id IS NOT DISTINCT FROM ?", rev.ID, rev.UserID, fromKeyID).
+		Updates(map[string]any{
+			"title":   rev.Title,
+			"content": rev.Content,
+			"key_id":  rev.KeyID,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return staleOrGone(r.db.WithContext(ctx), &domain.NoteRevision{}, rev.ID)
+	}
 	return nil
 }
+
+// PurgeDeletedBefore removes, across all users, up to limit notes trashed
+// before cutoff. Tag links go with them through the foreign key cascade.
+func (r NoteRepo) PurgeDeletedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	expired := r.db.Model(&domain.Note{}).
+		Select("id").
+		Where("deleted_at < ?", cutoff).
+		Order("id").
+		Limit(limit)
+	tx := r.db.WithContext(ctx).Where("id IN (?)", expired).Delete(&domain.Note{})
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return tx.RowsAffected, nil
+}
+
+// clientEncryptionJSON encodes the metadata for map-based updates, which
+// bypass the struct serializer.
+func clientEncryptionJSON(ce *domain.ClientEncryption) any {
+	if ce == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(ce)
+	return string(raw)
+}
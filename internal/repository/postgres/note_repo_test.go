@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/secure-notes/internal/domain"
+	pgdriver "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// countDriver answers every query with a single count column, enough for
+// the existence checks behind missOrConflict.
+type countDriver struct {
+	count   int64
+	queries []string
+}
+
+func (d *countDriver) Open(string) (driver.Conn, error) { return countConn{d}, nil }
+
+type countConn struct{ d *countDriver }
+
+func (c countConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c countConn) Close() error                        { return nil }
+func (c countConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c countConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.queries = append(c.d.queries, query)
+	return &countRows{count: c.d.count}, nil
+}
+
+type countRows struct {
+	count int64
+	done  bool
+}
+
+func (r *countRows) Columns() []string { return []string{"count"} }
+func (r *countRows) Close() error      { return nil }
+
+func (r *countRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.count
+	return nil
+}
+
+func newCountDB(t *testing.T, d *countDriver) *gorm.DB {
+	t.Helper()
+	name := "count-" + t.Name()
+	sql.Register(name, d)
+	db, err := gorm.Open(pgdriver.New(pgdriver.Config{DriverName: name}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func TestMissOrConflict(t *testing.T) {
+	cases := map[string]struct {
+		version int64
+		count   int64
+		want    error
+		queries int
+	}{
+		"unconditional write": {version: 0, count: 1, want: gorm.ErrRecordNotFound, queries: 0},
+		"note is gone":        {version: 3, count: 0, want: gorm.ErrRecordNotFound, queries: 1},
+		"note has moved on":   {version: 3, count: 1, want: domain.ErrVersionConflict, queries: 1},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := &countDriver{count: tc.count}
+			db := newCountDB(t, d)
+
+			err := missOrConflict(db, 1, 10, tc.version)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got: %v", tc.want, err)
+			}
+			if len(d.queries) != tc.queries {
+				t.Fatalf("expected %d queries, got %v", tc.queries, d.queries)
+			}
+		})
+	}
+}
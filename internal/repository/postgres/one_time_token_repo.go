@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OneTimeTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewOneTimeTokenRepo(db *gorm.DB) *OneTimeTokenRepo {
+	return &OneTimeTokenRepo{db: db}
+}
+
+func (r OneTimeTokenRepo) Create(ctx context.Context, token domain.OneTimeToken) (domain.OneTimeToken, error) {
+	if err := r.db.WithContext(ctx).Create(&token).Error; err != nil {
+		return domain.OneTimeToken{}, err
+	}
+	return token, nil
+}
+
+func (r OneTimeTokenRepo) GetByHash(ctx context.Context, purpose, hash string) (domain.OneTimeToken, error) {
+	var token domain.OneTimeToken
+	if err := r.db.WithContext(ctx).First(&token, "purpose = ? and token_hash = ?", purpose, hash).Error; err != nil {
+		return domain.OneTimeToken{}, err
+	}
+	return token, nil
+}
+
+func (r OneTimeTokenRepo) Consume(ctx context.Context, id int64) (bool, error) {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.OneTimeToken{}).
+		Where("id = ? and used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return tx.RowsAffected == 1, nil
+}
+
+func (r OneTimeTokenRepo) InvalidateForUser(ctx context.Context, uid int64, purpose string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.OneTimeToken{}).
+		Where("user_id = ? and purpose = ? and used_at IS NULL", uid, purpose).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type PersonalTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewPersonalTokenRepo(db *gorm.DB) *PersonalTokenRepo {
+	return &PersonalTokenRepo{db: db}
+}
+
+func (r PersonalTokenRepo) Create(ctx context.Context, token domain.PersonalAccessToken) (domain.PersonalAccessToken, error) {
+	if err := r.db.WithContext(ctx).Create(&token).Error; err != nil {
+		return domain.PersonalAccessToken{}, err
+	}
+	return token, nil
+}
+
+func (r PersonalTokenRepo) GetByHash(ctx context.Context, hash string) (domain.PersonalAccessToken, error) {
+	var token domain.PersonalAccessToken
+	if err := r.db.WithContext(ctx).First(&token, "token_hash = ?", hash).Error; err != nil {
+		return domain.PersonalAccessToken{}, err
+	}
+	return token, nil
+}
+
+func (r PersonalTokenRepo) ListByUser(ctx context.Context, uid int64) ([]domain.PersonalAccessToken, error) {
+	var tokens []domain.PersonalAccessToken
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", uid).
+		Order("id").
+		Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r PersonalTokenRepo) Delete(ctx context.Context, id, uid int64) error {
+	tx := r.db.WithContext(ctx).
+		Where("id = ? and user_id = ?", id, uid).
+		Delete(&domain.PersonalAccessToken{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r PersonalTokenRepo) DeleteAllForUser(ctx context.Context, uid int64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", uid).Delete(&domain.PersonalAccessToken{}).Error
+}
+
+func (r PersonalTokenRepo) Touch(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
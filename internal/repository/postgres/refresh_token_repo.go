@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type RefreshTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepo(db *gorm.DB) *RefreshTokenRepo {
+	return &RefreshTokenRepo{db: db}
+}
+
+func (r RefreshTokenRepo) Create(ctx context.Context, token domain.RefreshToken) (domain.RefreshToken, error) {
+	if err := r.db.WithContext(ctx).Create(&token).Error; err != nil {
+		return domain.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+func (r RefreshTokenRepo) GetByHash(ctx context.Context, hash string) (domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	if err := r.db.WithContext(ctx).First(&token, "token_hash = ?", hash).Error; err != nil {
+		return domain.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+func (r RefreshTokenRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.RefreshToken{}).
+		Where("id = ? and used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return tx.RowsAffected == 1, nil
+}
+
+func (r RefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.RefreshToken{}).
+		Where("family_id = ? and revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r RefreshTokenRepo) RevokeAllForUser(ctx context.Context, uid int64) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.RefreshToken{}).
+		Where("user_id = ? and revoked_at IS NULL", uid).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type RevocationRepo struct {
+	db *gorm.DB
+}
+
+func NewRevocationRepo(db *gorm.DB) *RevocationRepo {
+	return &RevocationRepo{db: db}
+}
+
+func (r RevocationRepo) RevokeToken(ctx context.Context, jti string, uid int64, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.RevokedToken{JTI: jti, UserID: uid, ExpiresAt: expiresAt, RevokedAt: time.Now()}).Error
+}
+
+func (r RevocationRepo) RevokeAllForUser(ctx context.Context, uid int64, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"revoked_before"}),
+		}).
+		Create(&domain.UserRevocation{UserID: uid, RevokedBefore: before}).Error
+}
+
+func (r RevocationRepo) IsRevoked(ctx context.Context, jti string, uid int64, issuedAt time.Time) (bool, error) {
+	revoked, err := r.IsTokenRevoked(ctx, jti)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	cutoff, err := r.RevokedBefore(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	return domain.RevokedByCutoff(issuedAt, cutoff), nil
+}
+
+// PurgeExpired drops deny-list entries for tokens that have expired; those
+// are rejected on their expiry alone.
+func (r RevocationRepo) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	tx := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.RevokedToken{})
+	return tx.RowsAffected, tx.Error
+}
+
+// RevokedBefore returns the user's "log out everywhere" cutoff, or the zero time.
+func (r RevocationRepo) RevokedBefore(ctx context.Context, uid int64) (time.Time, error) {
+	var rows []domain.UserRevocation
+	if err := r.db.WithContext(ctx).Where("user_id = ?", uid).Limit(1).Find(&rows).Error; err != nil {
+		return time.Time{}, err
+	}
+	if len(rows) == 0 {
+		return time.Time{}, nil
+	}
+	return rows[0].RevokedBefore, nil
+}
+
+// IsTokenRevoked reports whether a single jti is on the deny list.
+func (r RevocationRepo) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var n int64
+	if err := r.db.WithContext(ctx).Model(&domain.RevokedToken{}).Where("jti = ?", jti).
+		Count(&n).Error; err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SessionRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionRepo(db *gorm.DB) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+func (r SessionRepo) Create(ctx context.Context, session domain.Session) (domain.Session, error) {
+	if err := r.db.WithContext(ctx).Create(&session).Error; err != nil {
+		return domain.Session{}, err
+	}
+	return session, nil
+}
+
+func (r SessionRepo) Get(ctx context.Context, id string) (domain.Session, error) {
+	var session domain.Session
+	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
+		return domain.Session{}, err
+	}
+	return session, nil
+}
+
+func (r SessionRepo) ListActive(ctx context.Context, uid int64, now time.Time) ([]domain.Session, error) {
+	var sessions []domain.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? and revoked_at IS NULL and expires_at > ?", uid, now).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r SessionRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
+
+func (r SessionRepo) Renew(ctx context.Context, id string, at, expiresAt time.Time) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"last_used_at": at, "expires_at": expiresAt})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r SessionRepo) Revoke(ctx context.Context, id string, uid int64) error {
+	tx := r.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("id = ? and user_id = ? and revoked_at IS NULL", id, uid).
+		Update("revoked_at", time.Now())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r SessionRepo) RevokeAllForUser(ctx context.Context, uid int64) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.Session{}).
+		Where("user_id = ? and revoked_at IS NULL", uid).
+		Update("revoked_at", time.Now()).Error
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/secure-notes/internal/domain"
 	"gorm.io/gorm"
+	"time"
 )
 
 type UserRepo struct {
@@ -32,3 +33,84 @@ func (r UserRepo) GetByEmail(ctx context.Context, email string) (domain.User, er
 	}
 	return user, nil
 }
+
+func (r UserRepo) GetByID(ctx context.Context, uid int64) (domain.User, error) {
+	var user domain.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", uid).Error; err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (r UserRepo) UpdatePasswordHash(ctx context.Context, uid int64, hash string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("password_hash", hash).Error
+}
+
+func (r UserRepo) MarkEmailVerified(ctx context.Context, uid int64, at time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("email_verified_at", at).Error
+}
+
+func (r UserRepo) UpdateEmail(ctx context.Context, uid int64, email string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Updates(map[string]any{"email": email, "email_verified_at": nil}).Error
+}
+
+func (r UserRepo) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	var users []domain.User
+	err := r.db.WithContext(ctx).
+		Order("id").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r UserRepo) SetRole(ctx context.Context, uid int64, role string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("role", role).Error
+}
+
+func (r UserRepo) SetDisabled(ctx context.Context, uid int64, at *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("disabled_at", at).Error
+}
+
+func (r UserRepo) SetPasswordResetRequired(ctx context.Context, uid int64, required bool) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("password_reset_required", required).Error
+}
+
+func (r UserRepo) SetSuspended(ctx context.Context, uid int64, until *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ?", uid).
+		Update("suspended_until", until).Error
+}
+
+func (r UserRepo) Delete(ctx context.Context, uid int64) error {
+	res := r.db.WithContext(ctx).Delete(&domain.User{}, "id = ?", uid)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
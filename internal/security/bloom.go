@@ -0,0 +1,102 @@
+package security
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter encoding")
+
+// bloomMagic starts the binary encoding so a wrong file is caught early.
+const bloomMagic = "BLM1"
+
+// BloomFilter is a set membership test that never misses a member and
+// wrongly reports a non-member with a small, chosen probability. It stores
+// no members, only bits, which keeps large password lists compact.
+type BloomFilter struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint32 // hash functions per item
+}
+
+// NewBloomFilter sizes a filter for n items with false positive rate fp.
+func NewBloomFilter(n int, fp float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (f *BloomFilter) Add(item string) {
+	h1, h2 := bloomHashes(item)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether item may have been added.
+func (f *BloomFilter) Contains(item string) bool {
+	h1, h2 := bloomHashes(item)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the k probe positions by double hashing the two
+// halves of a 128-bit FNV-1a digest. The encoding depends on it, so it must
+// not change without a new bloomMagic.
+func bloomHashes(item string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(item))
+	sum := h.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	h2 := binary.BigEndian.Uint64(sum[8:]) | 1 // odd, so probes do not collapse
+	return h1, h2
+}
+
+// MarshalBinary encodes the filter as magic, k, m and the bit words, all
+// little endian.
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, len(bloomMagic)+12+8*len(f.bits))
+	out = append(out, bloomMagic...)
+	out = binary.LittleEndian.AppendUint32(out, f.k)
+	out = binary.LittleEndian.AppendUint64(out, f.m)
+	for _, w := range f.bits {
+		out = binary.LittleEndian.AppendUint64(out, w)
+	}
+	return out, nil
+}
+
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	header := len(bloomMagic) + 12
+	if len(data) < header || string(data[:len(bloomMagic)]) != bloomMagic {
+		return ErrInvalidBloomFilter
+	}
+	k := binary.LittleEndian.Uint32(data[len(bloomMagic):])
+	m := binary.LittleEndian.Uint64(data[len(bloomMagic)+4:])
+	words := data[header:]
+	if k == 0 || m == 0 || uint64(len(words)) != (m+63)/64*8 {
+		return ErrInvalidBloomFilter
+	}
+	bits := make([]uint64, len(words)/8)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(words[i*8:])
+	}
+	f.bits, f.m, f.k = bits, m, k
+	return nil
+}
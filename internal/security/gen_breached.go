@@ -0,0 +1,51 @@
+//go:build ignore
+
+// gen_breached builds breached_passwords.bloom from breached_passwords.txt,
+// one password per line. Run it with go generate after editing the list.
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/secure-notes/internal/security"
+)
+
+// falsePositiveRate is the share of acceptable passwords wrongly refused.
+const falsePositiveRate = 1e-6
+
+func main() {
+	in, err := os.Open("breached_passwords.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	var words []string
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		w := strings.TrimSpace(sc.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		words = append(words, strings.ToLower(w))
+	}
+	if err = sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	f := security.NewBloomFilter(len(words), falsePositiveRate)
+	for _, w := range words {
+		f.Add(w)
+	}
+	out, err := f.MarshalBinary()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile("breached_passwords.bloom", out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d passwords, %d bytes", len(words), len(out))
+}
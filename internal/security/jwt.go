@@ -3,6 +3,7 @@ package security
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,12 +12,30 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrMissingToken = errors.New("missing token")
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrNoSigningKey = errors.New("no signing key configured")
 )
 
+// JWTManager signs access tokens with the current key and verifies tokens
+// signed by any key it knows. Asymmetric keys carry a kid header; tokens
+// without one are legacy HS256 tokens verified with Secret.
 type JWTManager struct {
 	Secret []byte
 	Issuer string
 	TTL    time.Duration
+
+	current     string
+	keys        map[string]SigningKey
+	legacyUntil time.Time // with asymmetric keys, HS256 is refused from then on
+}
+
+// LegacyHS256 lets a manager with asymmetric keys verify kid-less HS256
+// tokens signed with Secret until Until, so tokens issued before the switch
+// keep working while they expire. The zero value refuses them, as anyone
+// holding the shared secret could mint tokens.
+type LegacyHS256 struct {
+	Secret string
+	Until  time.Time
 }
 
 func NewJWTManager(secret, issuer string, ttl time.Duration) *JWTManager {
@@ -27,57 +46,239 @@ func NewJWTManager(secret, issuer string, ttl time.Duration) *JWTManager {
 	}
 }
 
-// Sign creates a JWT for a user ID and returns token + expiry time.
+// NewJWTManagerWithKeys signs with keys[current] and verifies with any key in
+// keys, and legacy HS256 tokens only as legacy allows.
+func NewJWTManagerWithKeys(issuer string, ttl time.Duration, current string, keys []SigningKey, legacy LegacyHS256) (*JWTManager, error) {
+	m := NewJWTManager("", issuer, ttl)
+	if !legacy.Until.IsZero() {
+		m.Secret, m.legacyUntil = []byte(legacy.Secret), legacy.Until
+	}
+	m.keys = make(map[string]SigningKey, len(keys))
+	for _, k := range keys {
+		m.keys[k.ID] = k
+	}
+	if k, ok := m.keys[current]; !ok || k.Private == nil {
+		return nil, ErrNoSigningKey
+	}
+	m.current = current
+	return m, nil
+}
+
+// Token uses. Access tokens carry no "use" claim for compatibility.
+const (
+	tokenUseMFA = "mfa"
+	audienceMFA = "secure-notes/mfa"
+)
+
+// tokenClaims is the JWT payload.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Use       string `json:"use,omitempty"`
+	Scope     string `json:"scope,omitempty"` // space-separated, as in RFC 8693
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// Claims are the verified contents of an access token.
+type Claims struct {
+	UserID    int64
+	TokenID   string // jti, used to revoke a single token
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Scopes    []string // nil for tokens issued without a scope claim
+	SessionID string   // sid, empty for tokens issued outside a login session
+	Role      string   // empty for tokens issued without a role claim
+}
+
+// Sign creates a JWT for a user ID and returns token + expiry time. The token
+// carries no scope, session or role claim.
 func (m *JWTManager) Sign(userID int64) (tokenString string, expiresAt time.Time, err error) {
-	now := time.Now()
+	return m.SignClaims(Claims{UserID: userID})
+}
+
+// SignClaims creates a JWT carrying c. TokenID and ExpiresAt are ignored: a
+// fresh jti is drawn and the expiry is IssuedAt plus the TTL. IssuedAt
+// defaults to now. The iat claim has one-second resolution, so a token that
+// must outlive a revocation cutoff taken in the same second is issued at the
+// start of the next one.
+func (m *JWTManager) SignClaims(c Claims) (tokenString string, expiresAt time.Time, err error) {
+	now := c.IssuedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
 	expiresAt = now.Add(m.TTL)
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    m.Issuer,
-		Subject:   strconv.FormatInt(userID, 10), // user id in sub
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", time.Time{}, err
 	}
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    m.Issuer,
+			Subject:   strconv.FormatInt(c.UserID, 10), // user id in sub
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Scope:     strings.Join(c.Scopes, " "),
+		SessionID: c.SessionID,
+		Role:      c.Role,
+	}
+	tokenString, err = m.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
 
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err = t.SignedString(m.Secret)
+// SignChallenge creates a short-lived token proving the password step of a
+// login that still needs a second factor. It is rejected as an access token.
+func (m *JWTManager) SignChallenge(userID int64, ttl time.Duration) (tokenString string, expiresAt time.Time, err error) {
+	now := time.Now()
+	expiresAt = now.Add(ttl)
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.Issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{audienceMFA},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Use: tokenUseMFA,
+	}
+	tokenString, err = m.sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 	return tokenString, expiresAt, nil
 }
 
+// ParseChallenge verifies a token created by SignChallenge and returns the user ID.
+func (m *JWTManager) ParseChallenge(tokenString string) (int64, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if claims.Use != tokenUseMFA {
+		return 0, ErrInvalidToken
+	}
+	return subjectID(claims)
+}
+
+func (m *JWTManager) sign(claims tokenClaims) (string, error) {
+	if m.current == "" {
+		t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return t.SignedString(m.Secret)
+	}
+	key := m.keys[m.current]
+	t := jwt.NewWithClaims(key.Method, claims)
+	t.Header["kid"] = key.ID
+	return t.SignedString(key.Private)
+}
+
 // Parse verifies a token and extracts userID from "sub".
 func (m *JWTManager) Parse(tokenString string) (int64, error) {
+	claims, err := m.ParseClaims(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseClaims verifies an access token and returns its claims.
+func (m *JWTManager) ParseClaims(tokenString string) (Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Use != "" {
+		return Claims{}, ErrInvalidToken
+	}
+	uid, err := subjectID(claims)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	out := Claims{
+		UserID:    uid,
+		TokenID:   claims.ID,
+		Scopes:    strings.Fields(claims.Scope),
+		SessionID: claims.SessionID,
+		Role:      claims.Role,
+	}
+	if len(out.Scopes) == 0 {
+		out.Scopes = nil
+	}
+	if claims.IssuedAt != nil {
+		out.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		out.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return out, nil
+}
+
+func (m *JWTManager) parse(tokenString string) (*tokenClaims, error) {
 	if tokenString == "" {
-		return 0, ErrMissingToken
+		return nil, ErrMissingToken
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		// Enforce HS256
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, ErrInvalidToken
-		}
-		return m.Secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, m.verificationKey)
 	if err != nil {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*tokenClaims)
 	if !ok || !token.Valid {
-		return 0, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
+	// Optional strict issuer check
+	if m.Issuer != "" && claims.Issuer != m.Issuer {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func subjectID(claims *tokenClaims) (int64, error) {
 	uid, err := strconv.ParseInt(claims.Subject, 10, 64)
 	if err != nil || uid <= 0 {
 		return 0, ErrInvalidToken
 	}
+	return uid, nil
+}
 
-	// Optional strict issuer check
-	if m.Issuer != "" && claims.Issuer != m.Issuer {
-		return 0, ErrInvalidToken
+// verificationKey picks the key for a token by kid and pins the algorithm to
+// the one registered for that key, so a token cannot choose its own algorithm.
+func (m *JWTManager) verificationKey(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		// Legacy tokens: enforce HS256 with the shared secret, and once keys
+		// are configured only during the transition.
+		if t.Method != jwt.SigningMethodHS256 || len(m.Secret) == 0 {
+			return nil, ErrInvalidToken
+		}
+		if m.current != "" && !time.Now().Before(m.legacyUntil) {
+			return nil, ErrInvalidToken
+		}
+		return m.Secret, nil
+	}
+	key, ok := m.keys[kid]
+	if !ok || t.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidToken
 	}
+	return key.Public, nil
+}
 
-	return uid, nil
+// JWKS returns the public keys that verify tokens issued by this manager.
+// Symmetric keys are never published.
+func (m *JWTManager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range m.keys {
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sortJWKs(set.Keys)
+	return set
 }
@@ -0,0 +1,187 @@
+package security_test
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/secure-notes/internal/security"
+)
+
+func writeKey(t *testing.T, dir, kid, alg string, keepPrivate bool) {
+	t.Helper()
+	priv, pub, err := security.GenerateSigningKeyPEM(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keepPrivate {
+		if err = os.WriteFile(filepath.Join(dir, kid+".pem"), priv, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.WriteFile(filepath.Join(dir, kid+".pub.pem"), pub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newAsymmetricManager(t *testing.T, dir, current string) *security.JWTManager {
+	t.Helper()
+	return newTransitionManager(t, dir, current, security.LegacyHS256{})
+}
+
+func newTransitionManager(t *testing.T, dir, current string, legacy security.LegacyHS256) *security.JWTManager {
+	t.Helper()
+	keys, err := security.LoadSigningKeys(dir)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	m, err := security.NewJWTManagerWithKeys("secure-notes", time.Hour, current, keys, legacy)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	return m
+}
+
+func TestJWTManager_RotationKeepsOldKeysVerifiable(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", security.AlgEdDSA, true)
+	old := newAsymmetricManager(t, dir, "k1")
+	oldToken, _, err := old.Sign(42)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// Rotate: k2 signs, k1 is kept only as a public key.
+	if err = os.Remove(filepath.Join(dir, "k1.pem")); err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "k2", security.AlgRS256, true)
+	m := newAsymmetricManager(t, dir, "k2")
+
+	newToken, _, err := m.Sign(42)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	for _, tok := range []string{oldToken, newToken} {
+		if uid, err := m.Parse(tok); err != nil || uid != 42 {
+			t.Fatalf("parse: uid=%d err=%v", uid, err)
+		}
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["kid"] != "k2" || parsed.Method.Alg() != "RS256" {
+		t.Fatalf("unexpected header: %v", parsed.Header)
+	}
+
+	jwks := m.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "k1" || jwks.Keys[0].Kty != "OKP" || jwks.Keys[1].Kty != "RSA" {
+		t.Fatalf("unexpected jwks: %+v", jwks)
+	}
+}
+
+func TestJWTManager_RejectsAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", security.AlgEdDSA, true)
+	m := newAsymmetricManager(t, dir, "k1")
+	keys, _ := security.LoadSigningKeys(dir)
+
+	// HS256 token that names the Ed25519 kid and uses its public key as secret.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject: "1", Issuer: "secure-notes", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	forged.Header["kid"] = "k1"
+	raw, err := forged.SignedString([]byte(keys[0].Public.(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Parse(raw); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got: %v", err)
+	}
+}
+
+func TestJWTManager_LegacyHS256OnlyDuringTransition(t *testing.T) {
+	legacy := security.NewJWTManager("legacy-secret", "secure-notes", time.Hour)
+	tok, _, err := legacy.Sign(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeKey(t, dir, "k1", security.AlgEdDSA, true)
+	m := newTransitionManager(t, dir, "k1", security.LegacyHS256{Secret: "legacy-secret", Until: time.Now().Add(time.Hour)})
+	if uid, err := m.Parse(tok); err != nil || uid != 7 {
+		t.Fatalf("legacy token: uid=%d err=%v", uid, err)
+	}
+	if len(m.JWKS().Keys) != 1 {
+		t.Fatalf("the shared secret must never be published")
+	}
+
+	for name, l := range map[string]security.LegacyHS256{
+		"no transition":      {Secret: "legacy-secret"},
+		"transition over":    {Secret: "legacy-secret", Until: time.Now().Add(-time.Second)},
+		"nothing configured": {},
+	} {
+		m = newTransitionManager(t, dir, "k1", l)
+		if _, err = m.Parse(tok); !errors.Is(err, security.ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got: %v", name, err)
+		}
+	}
+}
+
+func TestJWTManager_ChallengeTokensAreNotAccessTokens(t *testing.T) {
+	m := security.NewJWTManager("secret", "secure-notes", time.Hour)
+	challenge, _, err := m.SignChallenge(9, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Parse(challenge); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("challenge accepted as access token: %v", err)
+	}
+	if uid, err := m.ParseChallenge(challenge); err != nil || uid != 9 {
+		t.Fatalf("parse challenge: uid=%d err=%v", uid, err)
+	}
+
+	access, _, _ := m.Sign(9)
+	if _, err = m.ParseChallenge(access); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("access token accepted as challenge: %v", err)
+	}
+}
+
+func TestJWTManager_ScopesRoundTrip(t *testing.T) {
+	m := security.NewJWTManager("secret", "secure-notes", time.Hour)
+	tok, _, err := m.SignClaims(security.Claims{UserID: 3, Scopes: []string{"notes:read", "account"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := m.ParseClaims(tok)
+	if err != nil || len(claims.Scopes) != 2 || claims.Scopes[0] != "notes:read" {
+		t.Fatalf("unexpected claims: %+v %v", claims, err)
+	}
+
+	legacy, _, _ := m.Sign(3)
+	if claims, _ = m.ParseClaims(legacy); claims.Scopes != nil {
+		t.Fatalf("tokens without a scope claim must report nil scopes: %v", claims.Scopes)
+	}
+}
+
+func TestJWTManager_SessionAndRole(t *testing.T) {
+	m := security.NewJWTManager("secret", "secure-notes", time.Hour)
+	tok, _, err := m.SignClaims(security.Claims{UserID: 3, SessionID: "abc123", Role: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := m.ParseClaims(tok); err != nil || claims.SessionID != "abc123" || claims.Role != "admin" {
+		t.Fatalf("unexpected claims: %+v %v", claims, err)
+	}
+
+	plain, _, _ := m.Sign(3)
+	if claims, _ := m.ParseClaims(plain); claims.SessionID != "" {
+		t.Fatalf("Sign must not set a session: %q", claims.SessionID)
+	}
+	if claims, _ := m.ParseClaims(plain); claims.Role != "" {
+		t.Fatalf("Sign must not set a role: %q", claims.Role)
+	}
+}
@@ -0,0 +1,75 @@
+package security
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrKeyNotExportable  = errors.New("master key cannot be exported from this provider")
+	ErrRotateUnsupported = errors.New("key provider cannot create new master keys")
+)
+
+// KeyProvider manages versioned master keys. Data keys are wrapped under the
+// current version and unwrapped with whichever version wrapped them, so a
+// provider backed by a remote KMS never has to hand out raw key material.
+type KeyProvider interface {
+	CurrentKeyID(ctx context.Context) (string, error)
+	// GetKey returns raw key material; remote providers return ErrKeyNotExportable.
+	GetKey(ctx context.Context, keyID string) ([]byte, error)
+	Wrap(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyRotator is implemented by providers that can introduce a new master key
+// version themselves. The new version becomes current; older versions remain
+// available for Unwrap.
+type KeyRotator interface {
+	Rotate(ctx context.Context) (keyID string, err error)
+}
+
+// NewEnvKeyProvider builds a keyring from environment variables:
+// MASTER_KEY_ID names the current version and MASTER_KEYS lists
+// comma-separated "id:base64" pairs. A lone MASTER_KEY is accepted as the
+// material for MASTER_KEY_ID.
+func NewEnvKeyProvider(getenv func(string) string) (*Keyring, error) {
+	current := strings.TrimSpace(getenv("MASTER_KEY_ID"))
+	encoded := make(map[string]string)
+	for _, pair := range strings.Split(getenv("MASTER_KEYS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, ErrInvalidKeyEnc
+		}
+		encoded[id] = key
+	}
+	if single := strings.TrimSpace(getenv("MASTER_KEY")); single != "" {
+		encoded[current] = single
+	}
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("%w: set MASTER_KEY, e.g. to the output of `openssl rand -base64 32`", ErrNoCurrentKey)
+	}
+	keys, err := decodeKeys(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(current, keys)
+}
+
+func decodeKeys(encoded map[string]string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(encoded))
+	for id, enc := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+		if err != nil {
+			return nil, ErrInvalidKeyEnc
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
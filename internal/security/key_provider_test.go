@@ -0,0 +1,153 @@
+package security_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secure-notes/internal/security"
+)
+
+func b64Key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, security.DataKeySize))
+}
+
+func TestFileKeyProvider_OldVersionsStayReadable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.json")
+	ctx := context.Background()
+
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"current":"v1","keys":{"v1":"` + b64Key(1) + `"}}`)
+	v1, err := security.NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	dek := bytes.Repeat([]byte{9}, security.DataKeySize)
+	id, wrapped, err := v1.Wrap(ctx, dek)
+	if err != nil || id != "v1" {
+		t.Fatalf("wrap: id=%q err=%v", id, err)
+	}
+
+	write(`{"current":"v2","keys":{"v1":"` + b64Key(1) + `","v2":"` + b64Key(2) + `"}}`)
+	v2, err := security.NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if cur, _ := v2.CurrentKeyID(ctx); cur != "v2" {
+		t.Fatalf("expected current v2, got %q", cur)
+	}
+	got, err := v2.Unwrap(ctx, id, wrapped)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("unwrap with old version: %v", err)
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	env := map[string]string{
+		"MASTER_KEY_ID": "v2",
+		"MASTER_KEYS":   "v1:" + b64Key(1) + ", v2:" + b64Key(2),
+	}
+	p, err := security.NewEnvKeyProvider(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = p.GetKey(context.Background(), "v1"); err != nil {
+		t.Fatalf("v1 should be loaded: %v", err)
+	}
+	if _, err = p.GetKey(context.Background(), "v3"); !errors.Is(err, security.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got: %v", err)
+	}
+
+	delete(env, "MASTER_KEYS")
+	if _, err = security.NewEnvKeyProvider(func(k string) string { return env[k] }); !errors.Is(err, security.ErrNoCurrentKey) {
+		t.Fatalf("expected ErrNoCurrentKey, got: %v", err)
+	}
+	// The placeholder in .env leaves MASTER_KEY empty.
+	env["MASTER_KEY"] = " "
+	if _, err = security.NewEnvKeyProvider(func(k string) string { return env[k] }); !errors.Is(err, security.ErrNoCurrentKey) {
+		t.Fatalf("empty MASTER_KEY: expected ErrNoCurrentKey, got: %v", err)
+	}
+}
+
+func TestKMSClient_AgainstStandIn(t *testing.T) {
+	ring, err := security.NewKeyring("v1", map[string][]byte{"v1": bytes.Repeat([]byte{1}, security.DataKeySize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(security.NewKMSHandler(ring, "s3cret"))
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := security.NewKMSClient(srv.URL, "s3cret")
+	if cur, err := client.CurrentKeyID(ctx); err != nil || cur != "v1" {
+		t.Fatalf("current: %q %v", cur, err)
+	}
+	dek := bytes.Repeat([]byte{5}, security.DataKeySize)
+	id, wrapped, err := client.Wrap(ctx, dek)
+	if err != nil {
+		t.Fatalf("wrap: %v", err)
+	}
+	got, err := client.Unwrap(ctx, id, wrapped)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("unwrap: %v", err)
+	}
+	if _, err = client.Unwrap(ctx, "v9", wrapped); !errors.Is(err, security.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got: %v", err)
+	}
+	if _, err = client.GetKey(ctx, "v1"); !errors.Is(err, security.ErrKeyNotExportable) {
+		t.Fatalf("expected ErrKeyNotExportable, got: %v", err)
+	}
+
+	if _, err = security.NewKMSClient(srv.URL, "wrong").CurrentKeyID(ctx); !errors.Is(err, security.ErrKMSUnavailable) {
+		t.Fatalf("expected auth failure, got: %v", err)
+	}
+
+	open := httptest.NewServer(security.NewKMSHandler(ring, ""))
+	defer open.Close()
+	if _, err = security.NewKMSClient(open.URL, "").CurrentKeyID(ctx); !errors.Is(err, security.ErrKMSUnavailable) {
+		t.Fatalf("stand-in without a token must refuse requests, got: %v", err)
+	}
+}
+
+func TestFileKeyProvider_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := os.WriteFile(path, []byte(`{"current":"v1","keys":{"v1":"`+b64Key(1)+`"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	server, err := security.NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := security.NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := cli.Rotate(ctx)
+	if err != nil || id != "v2" {
+		t.Fatalf("rotate: id=%q err=%v", id, err)
+	}
+	_, wrapped, err := cli.Wrap(ctx, bytes.Repeat([]byte{3}, security.DataKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A process that loaded the file before rotation picks up v2 on demand.
+	if _, err = server.Unwrap(ctx, "v2", wrapped); err != nil {
+		t.Fatalf("stale provider should reload the keyring: %v", err)
+	}
+	if _, err = server.GetKey(ctx, "v1"); err != nil {
+		t.Fatalf("old version must be kept: %v", err)
+	}
+}
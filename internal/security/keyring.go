@@ -0,0 +1,66 @@
+package security
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnknownKey    = errors.New("unknown master key")
+	ErrNoCurrentKey  = errors.New("current master key is not configured")
+	ErrInvalidKeyEnc = errors.New("master key must be base64 encoded")
+)
+
+// Keyring is an in-memory KeyProvider holding versioned master keys.
+// Old versions stay in the ring so previously wrapped keys remain readable.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if current == "" {
+		return nil, ErrNoCurrentKey
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, ErrNoCurrentKey
+	}
+	ring := &Keyring{current: current, keys: make(map[string][]byte, len(keys))}
+	for id, k := range keys {
+		if len(k) != DataKeySize {
+			return nil, ErrInvalidKeySize
+		}
+		ring.keys[id] = append([]byte(nil), k...)
+	}
+	return ring, nil
+}
+
+func (k *Keyring) CurrentKeyID(ctx context.Context) (string, error) {
+	return k.current, nil
+}
+
+func (k *Keyring) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return append([]byte(nil), key...), nil
+}
+
+// Wrap encrypts a data key under the current master key.
+func (k *Keyring) Wrap(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error) {
+	wrapped, err = Seal(k.keys[k.current], dek, []byte(k.current))
+	if err != nil {
+		return "", nil, err
+	}
+	return k.current, wrapped, nil
+}
+
+// Unwrap decrypts a data key wrapped by the given master key version.
+func (k *Keyring) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return Open(master, wrapped, []byte(keyID))
+}
@@ -0,0 +1,160 @@
+package security
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// keyringFile is the on-disk layout read by NewFileKeyProvider:
+//
+//	{"current": "v2", "keys": {"v1": "<base64>", "v2": "<base64>"}}
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// FileKeyring is a Keyring persisted in a local JSON file. Unknown key
+// versions trigger a reload so a running server picks up versions added by
+// rotate-keys without a restart.
+type FileKeyring struct {
+	path string
+
+	mu   sync.RWMutex
+	ring *Keyring
+}
+
+// NewFileKeyProvider loads a keyring from a local JSON file.
+func NewFileKeyProvider(path string) (*FileKeyring, error) {
+	f := &FileKeyring{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileKeyring) CurrentKeyID(ctx context.Context) (string, error) {
+	return f.keyring().CurrentKeyID(ctx)
+}
+
+func (f *FileKeyring) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	key, err := f.keyring().GetKey(ctx, keyID)
+	if errors.Is(err, ErrUnknownKey) && f.reload() == nil {
+		return f.keyring().GetKey(ctx, keyID)
+	}
+	return key, err
+}
+
+func (f *FileKeyring) Wrap(ctx context.Context, dek []byte) (string, []byte, error) {
+	return f.keyring().Wrap(ctx, dek)
+}
+
+func (f *FileKeyring) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	dek, err := f.keyring().Unwrap(ctx, keyID, wrapped)
+	if errors.Is(err, ErrUnknownKey) && f.reload() == nil {
+		return f.keyring().Unwrap(ctx, keyID, wrapped)
+	}
+	return dek, err
+}
+
+// Rotate generates a new master key, makes it current and rewrites the file.
+// Versions are named v1, v2, ... following the highest existing number.
+func (f *FileKeyring) Rotate(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	next := 0
+	keys := make(map[string][]byte, len(f.ring.keys)+1)
+	for id, k := range f.ring.keys {
+		keys[id] = k
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, "v")); err == nil && n > next {
+			next = n
+		}
+	}
+	id := "v" + strconv.Itoa(next+1)
+	key, err := NewDataKey()
+	if err != nil {
+		return "", err
+	}
+	keys[id] = key
+
+	ring, err := NewKeyring(id, keys)
+	if err != nil {
+		return "", err
+	}
+	if err = writeKeyringFile(f.path, ring); err != nil {
+		return "", err
+	}
+	f.ring = ring
+	return id, nil
+}
+
+func (f *FileKeyring) keyring() *Keyring {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ring
+}
+
+func (f *FileKeyring) reload() error {
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var kf keyringFile
+	if err = json.Unmarshal(raw, &kf); err != nil {
+		return fmt.Errorf("keyring file %s: %w", f.path, err)
+	}
+	keys, err := decodeKeys(kf.Keys)
+	if err != nil {
+		return err
+	}
+	ring, err := NewKeyring(kf.Current, keys)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.ring = ring
+	f.mu.Unlock()
+	return nil
+}
+
+// writeKeyringFile replaces path atomically so a crash never leaves a
+// truncated keyring behind.
+func writeKeyringFile(path string, ring *Keyring) error {
+	kf := keyringFile{Current: ring.current, Keys: make(map[string]string, len(ring.keys))}
+	for id, k := range ring.keys {
+		kf.Keys[id] = base64.StdEncoding.EncodeToString(k)
+	}
+	raw, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,222 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The KMS wire format is a small JSON-over-HTTP API shaped like a cloud KMS:
+//
+//	GET  /v1/keys/current -> {"key_id"}
+//	POST /v1/keys/rotate  -> {"key_id"}
+//	POST /v1/wrap   {"plaintext"}              -> {"key_id", "ciphertext"}
+//	POST /v1/unwrap {"key_id", "ciphertext"}   -> {"plaintext"}
+//
+// Byte fields are base64 encoded by encoding/json. Requests carry a bearer token.
+const (
+	kmsPathCurrent = "/v1/keys/current"
+	kmsPathRotate  = "/v1/keys/rotate"
+	kmsPathWrap    = "/v1/wrap"
+	kmsPathUnwrap  = "/v1/unwrap"
+)
+
+var ErrKMSUnavailable = errors.New("kms request failed")
+
+type kmsKeyResp struct {
+	KeyID string `json:"key_id"`
+}
+
+type kmsWrapReq struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type kmsWrapResp struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type kmsUnwrapReq struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type kmsUnwrapResp struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type kmsErrorResp struct {
+	Error string `json:"error"`
+}
+
+// KMSClient is a KeyProvider that delegates wrapping to a remote KMS.
+type KMSClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewKMSClient(baseURL, token string) *KMSClient {
+	return &KMSClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *KMSClient) CurrentKeyID(ctx context.Context) (string, error) {
+	var resp kmsKeyResp
+	if err := c.do(ctx, http.MethodGet, kmsPathCurrent, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.KeyID, nil
+}
+
+func (c *KMSClient) Rotate(ctx context.Context) (string, error) {
+	var resp kmsKeyResp
+	if err := c.do(ctx, http.MethodPost, kmsPathRotate, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.KeyID, nil
+}
+
+func (c *KMSClient) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	return nil, ErrKeyNotExportable
+}
+
+func (c *KMSClient) Wrap(ctx context.Context, dek []byte) (string, []byte, error) {
+	var resp kmsWrapResp
+	if err := c.do(ctx, http.MethodPost, kmsPathWrap, kmsWrapReq{Plaintext: dek}, &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.KeyID, resp.Ciphertext, nil
+}
+
+func (c *KMSClient) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	var resp kmsUnwrapResp
+	req := kmsUnwrapReq{KeyID: keyID, Ciphertext: wrapped}
+	if err := c.do(ctx, http.MethodPost, kmsPathUnwrap, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+func (c *KMSClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKMSUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e kmsErrorResp
+		_ = json.NewDecoder(res.Body).Decode(&e)
+		switch e.Error {
+		case ErrUnknownKey.Error():
+			return ErrUnknownKey
+		case ErrRotateUnsupported.Error():
+			return ErrRotateUnsupported
+		}
+		return fmt.Errorf("%w: %s %s: %d %s", ErrKMSUnavailable, method, path, res.StatusCode, e.Error)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// NewKMSHandler serves the KMS wire format on top of any KeyProvider. It is a
+// local stand-in for a managed KMS so the KMSClient code path can run without
+// a cloud dependency. Every request must carry token; an empty token refuses
+// them all rather than serving keys to anyone.
+func NewKMSHandler(p KeyProvider, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+kmsPathCurrent, func(w http.ResponseWriter, r *http.Request) {
+		id, err := p.CurrentKeyID(r.Context())
+		if err != nil {
+			kmsError(w, http.StatusInternalServerError, err)
+			return
+		}
+		kmsJSON(w, kmsKeyResp{KeyID: id})
+	})
+	mux.HandleFunc("POST "+kmsPathRotate, func(w http.ResponseWriter, r *http.Request) {
+		rotator, ok := p.(KeyRotator)
+		if !ok {
+			kmsError(w, http.StatusNotImplemented, ErrRotateUnsupported)
+			return
+		}
+		id, err := rotator.Rotate(r.Context())
+		if err != nil {
+			kmsError(w, http.StatusInternalServerError, err)
+			return
+		}
+		kmsJSON(w, kmsKeyResp{KeyID: id})
+	})
+	mux.HandleFunc("POST "+kmsPathWrap, func(w http.ResponseWriter, r *http.Request) {
+		var req kmsWrapReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			kmsError(w, http.StatusBadRequest, err)
+			return
+		}
+		id, wrapped, err := p.Wrap(r.Context(), req.Plaintext)
+		if err != nil {
+			kmsError(w, http.StatusInternalServerError, err)
+			return
+		}
+		kmsJSON(w, kmsWrapResp{KeyID: id, Ciphertext: wrapped})
+	})
+	mux.HandleFunc("POST "+kmsPathUnwrap, func(w http.ResponseWriter, r *http.Request) {
+		var req kmsUnwrapReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			kmsError(w, http.StatusBadRequest, err)
+			return
+		}
+		plain, err := p.Unwrap(r.Context(), req.KeyID, req.Ciphertext)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, ErrUnknownKey) && !errors.Is(err, ErrDecrypt) {
+				status = http.StatusInternalServerError
+			}
+			kmsError(w, status, err)
+			return
+		}
+		kmsJSON(w, kmsUnwrapResp{Plaintext: plain})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			kmsError(w, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func kmsJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func kmsError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(kmsErrorResp{Error: err.Error()})
+}
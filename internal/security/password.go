@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 	"strings"
+	"sync"
 )
 
 var (
@@ -48,12 +50,34 @@ func HashPassword(password string, p Argon2Params) (string, error) {
 	return encoded, nil
 }
 
+// Hash variants. Only argon2id is produced; argon2i and bcrypt hashes from
+// older deployments or imports still verify and are upgraded on login.
+const (
+	variantArgon2id = "argon2id"
+	variantArgon2i  = "argon2i"
+)
+
 func VerifyPassword(password, encodedHash string) (bool, error) {
-	p, salt, hash, err := decodeHash(encodedHash)
+	if isBcrypt(encodedHash) {
+		err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, ErrInvalidHash
+		}
+		return true, nil
+	}
+	variant, p, salt, hash, err := decodeHash(encodedHash)
 	if err != nil {
 		return false, err
 	}
-	otherHash := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	var otherHash []byte
+	if variant == variantArgon2i {
+		otherHash = argon2.Key([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	} else {
+		otherHash = argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	}
 
 	if subtle.ConstantTimeCompare(hash, otherHash) == 1 {
 		return true, nil
@@ -61,41 +85,82 @@ func VerifyPassword(password, encodedHash string) (bool, error) {
 	return false, nil
 }
 
-func decodeHash(encodedHash string) (Argon2Params, []byte, []byte, error) {
+// dummyHash is a hash of a random password with the current parameters, for
+// VerifyDummyPassword.
+var dummyHash = sync.OnceValue(func() string {
+	password := make([]byte, 16)
+	_, _ = rand.Read(password)
+	hash, _ := HashPassword(string(password), DefaultArgon2Params())
+	return hash
+})
+
+// VerifyDummyPassword does the work of verifying password against a current
+// hash and discards the result. Call it when there is no stored hash to
+// check, so that an unknown account takes as long to reject as a wrong
+// password.
+func VerifyDummyPassword(password string) {
+	_, _ = VerifyPassword(password, dummyHash())
+}
+
+// NeedsRehash reports whether encodedHash uses a deprecated algorithm or any
+// parameter weaker than p. Call it only after VerifyPassword succeeded.
+func NeedsRehash(encodedHash string, p Argon2Params) bool {
+	variant, cur, _, _, err := decodeHash(encodedHash)
+	if err != nil || variant != variantArgon2id {
+		return true
+	}
+	return cur.Memory < p.Memory ||
+		cur.Iterations < p.Iterations ||
+		cur.Parallelism < p.Parallelism ||
+		cur.SaltLength < p.SaltLength ||
+		cur.KeyLength < p.KeyLength
+}
+
+func isBcrypt(encodedHash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encodedHash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeHash(encodedHash string) (string, Argon2Params, []byte, []byte, error) {
 	parts := strings.Split(encodedHash, "$")
 	if len(parts) != 6 {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
-	if parts[1] != "argon2id" {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+	variant := parts[1]
+	if variant != variantArgon2id && variant != variantArgon2i {
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
 
 	var version int
 	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
 	if err != nil {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
 	if version != argon2.Version {
-		return Argon2Params{}, nil, nil, ErrIncompatibleVersion
+		return "", Argon2Params{}, nil, nil, ErrIncompatibleVersion
 	}
 
 	p := Argon2Params{}
 	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
 	if err != nil {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
 
 	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
 	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return Argon2Params{}, nil, nil, ErrInvalidHash
+		return "", Argon2Params{}, nil, nil, ErrInvalidHash
 	}
 
 	p.SaltLength = uint32(len(salt))
 	p.KeyLength = uint32(len(hash))
 
-	return p, salt, hash, nil
+	return variant, p, salt, hash, nil
 }
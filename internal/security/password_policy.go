@@ -0,0 +1,178 @@
+package security
+
+import (
+	_ "embed"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:generate go run gen_breached.go
+
+// breachedBloom is built from breached_passwords.txt by gen_breached.go.
+//
+//go:embed breached_passwords.bloom
+var breachedBloom []byte
+
+var (
+	ErrPasswordTooShort      = errors.New("password is too short")
+	ErrPasswordTooWeak       = errors.New("password is too easy to guess")
+	ErrPasswordBreached      = errors.New("password appears in a list of common or breached passwords")
+	ErrPasswordContainsEmail = errors.New("password must not contain the email address")
+)
+
+// PasswordPolicyError lists every rule a password broke, so the user can fix
+// them all at once. errors.Is matches each of the rule errors above.
+type PasswordPolicyError struct {
+	Violations []error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() []error { return e.Violations }
+
+// PasswordPolicy decides which new passwords are acceptable. Existing
+// passwords are never re-checked, so tightening it does not lock anyone out.
+type PasswordPolicy struct {
+	MinLength int // in characters
+	// MinEntropyBits is compared with EstimateEntropy; zero disables it.
+	MinEntropyBits float64
+	// Breached holds lower-cased passwords to refuse; nil skips the check.
+	Breached *BloomFilter
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      16,
+		MinEntropyBits: 50,
+		Breached:       BundledBreachedPasswords(),
+	}
+}
+
+// Check returns nil or a *PasswordPolicyError. email is the account's
+// address; it and its local part must not appear in the password.
+func (p PasswordPolicy) Check(password, email string) error {
+	var violations []error
+	if utf8.RuneCountInString(strings.TrimSpace(password)) < p.MinLength {
+		violations = append(violations, ErrPasswordTooShort)
+	}
+	if p.MinEntropyBits > 0 && EstimateEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, ErrPasswordTooWeak)
+	}
+	lower := strings.ToLower(password)
+	if p.Breached != nil && p.Breached.Contains(lower) {
+		violations = append(violations, ErrPasswordBreached)
+	}
+	if containsEmail(lower, strings.ToLower(strings.TrimSpace(email))) {
+		violations = append(violations, ErrPasswordContainsEmail)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &PasswordPolicyError{Violations: violations}
+}
+
+// minLocalPart keeps short mailbox names like "jo" from ruling out every
+// password that happens to contain them.
+const minLocalPart = 4
+
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return utf8.RuneCountInString(local) >= minLocalPart && strings.Contains(password, local)
+}
+
+// EstimateEntropy is a rough guess, in bits, of how hard password is to brute
+// force. Each character is assumed to come from the union of the character
+// classes the password uses. Characters that repeat the previous one or
+// continue a run such as "abc" or "321" earn one bit, and characters used
+// before earn half, since guessers try those patterns first. It does not know
+// about words; the breached password list covers the common ones.
+func EstimateEntropy(password string) float64 {
+	runes := []rune(password)
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	seen := make(map[rune]bool, len(runes))
+	bits := 0.0
+	for i, r := range runes {
+		switch {
+		case i > 0 && r == runes[i-1]:
+			bits++
+		case i > 1 && abs(r-runes[i-1]) == 1 && r-runes[i-1] == runes[i-1]-runes[i-2]:
+			bits++
+		case seen[r]:
+			bits += perChar / 2
+		default:
+			bits += perChar
+		}
+		seen[r] = true
+	}
+	return bits
+}
+
+func abs(r rune) rune {
+	if r < 0 {
+		return -r
+	}
+	return r
+}
+
+var (
+	bundledOnce   sync.Once
+	bundledFilter *BloomFilter
+)
+
+// BundledBreachedPasswords returns the filter compiled into the binary. It
+// holds common passwords from public breach corpora, lower-cased, so no
+// network lookup is needed at registration.
+func BundledBreachedPasswords() *BloomFilter {
+	bundledOnce.Do(func() {
+		f := &BloomFilter{}
+		if err := f.UnmarshalBinary(breachedBloom); err != nil {
+			panic("security: bundled breached password filter: " + err.Error())
+		}
+		bundledFilter = f
+	})
+	return bundledFilter
+}
@@ -0,0 +1,102 @@
+package security_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/secure-notes/internal/security"
+)
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := security.DefaultPasswordPolicy()
+	cases := []struct {
+		password string
+		want     []error
+	}{
+		{"correct horse battery staple", nil},
+		{"short", []error{security.ErrPasswordTooShort, security.ErrPasswordTooWeak}},
+		{"aaaaaaaaaaaaaaaaaaaa", []error{security.ErrPasswordTooWeak}},
+		{"PasswordPassword", []error{security.ErrPasswordBreached}},
+		{"my email is alice@example.com", []error{security.ErrPasswordContainsEmail}},
+		{"Alice likes long passphrases", []error{security.ErrPasswordContainsEmail}},
+	}
+	for _, tc := range cases {
+		err := policy.Check(tc.password, "alice@example.com")
+		if tc.want == nil {
+			if err != nil {
+				t.Fatalf("%q: unexpected error %v", tc.password, err)
+			}
+			continue
+		}
+		var perr *security.PasswordPolicyError
+		if !errors.As(err, &perr) || len(perr.Violations) != len(tc.want) {
+			t.Fatalf("%q: got %v, want %v", tc.password, err, tc.want)
+		}
+		for _, w := range tc.want {
+			if !errors.Is(err, w) {
+				t.Fatalf("%q: %v does not match %v", tc.password, err, w)
+			}
+		}
+	}
+
+	// Short mailbox names are not treated as part of the address.
+	if err := policy.Check("joyful mountain rivers at dusk", "jo@example.com"); err != nil {
+		t.Fatalf("short local part: %v", err)
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	runs := security.EstimateEntropy("abcdefghijklmnop")
+	random := security.EstimateEntropy("qmzvkwjxtrhpsnyb")
+	if runs >= random {
+		t.Fatalf("sequential run scored %.1f bits, random %.1f", runs, random)
+	}
+	if mixed := security.EstimateEntropy("qmzV9k!wjxTrh2pS"); mixed <= random {
+		t.Fatalf("more character classes should score higher: %.1f <= %.1f", mixed, random)
+	}
+	if security.EstimateEntropy("") != 0 {
+		t.Fatal("empty password should have no entropy")
+	}
+}
+
+func TestBloomFilter_RoundTrip(t *testing.T) {
+	f := security.NewBloomFilter(1000, 1e-4)
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("member-%d", i))
+	}
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g security.BloomFilter
+	if err = g.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !g.Contains(fmt.Sprintf("member-%d", i)) {
+			t.Fatalf("member-%d missing after round trip", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if g.Contains(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 10 {
+		t.Fatalf("%d false positives in 10000, expected about 1", falsePositives)
+	}
+	if err = g.UnmarshalBinary(data[:10]); !errors.Is(err, security.ErrInvalidBloomFilter) {
+		t.Fatalf("expected ErrInvalidBloomFilter, got: %v", err)
+	}
+}
+
+func TestBundledBreachedPasswords(t *testing.T) {
+	f := security.BundledBreachedPasswords()
+	for _, pw := range []string{"password", "123456", "qwertyuiopasdfgh", "iloveyouiloveyou"} {
+		if !f.Contains(pw) {
+			t.Fatalf("%q should be in the bundled list", pw)
+		}
+	}
+}
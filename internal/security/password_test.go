@@ -0,0 +1,50 @@
+package security_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/secure-notes/internal/security"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func weakParams() security.Argon2Params {
+	p := security.DefaultArgon2Params()
+	p.Memory, p.Iterations = 8*1024, 1
+	return p
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current := security.DefaultArgon2Params()
+	strong, _ := security.HashPassword("pw", current)
+	weak, _ := security.HashPassword("pw", weakParams())
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+
+	cases := map[string]bool{strong: false, weak: true, string(legacy): true, "garbage": true}
+	for hash, want := range cases {
+		if got := security.NeedsRehash(hash, current); got != want {
+			t.Fatalf("NeedsRehash(%q) = %v, want %v", hash, got, want)
+		}
+	}
+}
+
+func TestVerifyPassword_DeprecatedAlgorithms(t *testing.T) {
+	b, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+
+	p := weakParams()
+	salt := []byte("0123456789abcdef")
+	key := argon2.Key([]byte("pw"), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	argon2i := fmt.Sprintf("$argon2i$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	for _, hash := range []string{string(b), argon2i} {
+		if ok, err := security.VerifyPassword("pw", hash); err != nil || !ok {
+			t.Fatalf("%s: ok=%v err=%v", hash, ok, err)
+		}
+		if ok, _ := security.VerifyPassword("nope", hash); ok {
+			t.Fatalf("%s: wrong password accepted", hash)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported signing key type")
+
+// SigningKey is one entry of the JWT keyset. Private is nil for keys kept
+// only to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private any // ed25519.PrivateKey or *rsa.PrivateKey
+	Public  any // ed25519.PublicKey or *rsa.PublicKey
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k SigningKey) JWK() (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: k.ID, Use: "sig", Alg: AlgEdDSA, Crv: "Ed25519", X: b64(pub)}, true
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: k.ID, Use: "sig", Alg: AlgRS256,
+			N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}, true
+	}
+	return JWK{}, false
+}
+
+// PublicKey decodes an RS256 or EdDSA key published by another issuer.
+func (k JWK) PublicKey() (jwt.SigningMethod, any, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch {
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == AlgRS256):
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, nil, ErrUnsupportedKey
+		}
+		return jwt.SigningMethodRS256, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, nil, ErrUnsupportedKey
+		}
+		return jwt.SigningMethodEdDSA, ed25519.PublicKey(x), nil
+	}
+	return nil, nil, ErrUnsupportedKey
+}
+
+func sortJWKs(keys []JWK) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+}
+
+// LoadSigningKeys reads a directory of PEM files. "<kid>.pem" holds a private
+// key (PKCS#8 Ed25519 or RSA, or PKCS#1 RSA); "<kid>.pub.pem" holds a public
+// key kept after rotation so older tokens still verify.
+func LoadSigningKeys(dir string) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]SigningKey)
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+		key, err := parseSigningKeyPEM(kid, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// A private key also verifies; never let a .pub file shadow it.
+		if existing, ok := keys[kid]; ok && existing.Private != nil {
+			continue
+		}
+		keys[kid] = key
+	}
+	out := make([]SigningKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func parseSigningKeyPEM(kid string, raw []byte) (SigningKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return SigningKey{}, ErrUnsupportedKey
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, ErrUnsupportedKey
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	case *rsa.PrivateKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	}
+	return SigningKey{}, ErrUnsupportedKey
+}
+
+// GenerateSigningKeyPEM creates a new private key for alg (EdDSA or RS256)
+// and returns the PKCS#8 private and PKIX public PEM encodings.
+func GenerateSigningKeyPEM(alg string) (private, public []byte, err error) {
+	var priv, pub any
+	switch alg {
+	case AlgEdDSA:
+		pub, priv, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		var k *rsa.PrivateKey
+		k, err = rsa.GenerateKey(rand.Reader, 3072)
+		if err == nil {
+			priv, pub = k, &k.PublicKey
+		}
+	default:
+		return nil, nil, ErrUnsupportedKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
@@ -0,0 +1,56 @@
+package security_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/security"
+)
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	// RFC 6238 appendix B (SHA1), truncated to 6 digits.
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := security.TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Fatalf("t=%d: got %q err=%v, want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestValidateTOTP_AllowsOneStepOfSkew(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	prev, _ := security.TOTPCode(secret, now.Add(-30*time.Second))
+	old, _ := security.TOTPCode(secret, now.Add(-90*time.Second))
+
+	if step, ok := security.ValidateTOTP(secret, prev, now); !ok || step != now.Unix()/30-1 {
+		t.Fatalf("previous step should validate: step=%d ok=%v", step, ok)
+	}
+	if _, ok := security.ValidateTOTP(secret, old, now); ok {
+		t.Fatalf("codes older than one step must be rejected")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	codes, err := security.NewRecoveryCodes(2)
+	if err != nil || len(codes) != 2 || codes[0] == codes[1] {
+		t.Fatalf("unexpected codes: %v %v", codes, err)
+	}
+	if got := security.NormalizeRecoveryCode(" ABCDE fghij "); got != "abcde-fghij" {
+		t.Fatalf("got %q", got)
+	}
+	if got := security.NormalizeRecoveryCode(codes[0]); got != codes[0] {
+		t.Fatalf("normalizing a generated code changed it: %q -> %q", codes[0], got)
+	}
+}
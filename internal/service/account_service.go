@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/mail"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+var ErrSameEmail = errors.New("new email matches the current one")
+
+// ChangePassword replaces the caller's password after checking the current
+// one. Every other session is signed out and personal access tokens are
+// deleted; the returned tokens replace the caller's.
+func (u *UserAuth) ChangePassword(ctx context.Context, uid int64, current, next string) (LoginResult, error) {
+	user, err := u.checkCurrentPassword(ctx, uid, current)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err = u.passwords.Check(next, user.Email); err != nil {
+		return LoginResult{}, err
+	}
+	hash, err := security.HashPassword(next, security.DefaultArgon2Params())
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err = u.setPassword(ctx, uid, hash); err != nil {
+		return LoginResult{}, err
+	}
+	if u.tokens != nil {
+		if err = u.tokens.InvalidateForUser(ctx, uid, domain.TokenPurposePasswordReset); err != nil {
+			return LoginResult{}, err
+		}
+	}
+	if err = u.revokePersonalTokens(ctx, uid); err != nil {
+		return LoginResult{}, err
+	}
+	return u.reissueAfterRevoke(ctx, uid)
+}
+
+// ChangeEmail moves the account to a new address after checking the current
+// password. The new address starts unverified and gets a verification link;
+// the old address is told about the change. Reset links already mailed to
+// the old address stop working.
+func (u *UserAuth) ChangeEmail(ctx context.Context, uid int64, password, email string) (LoginResult, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return LoginResult{}, ErrInvalidEmail
+	}
+	user, err := u.checkCurrentPassword(ctx, uid, password)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return LoginResult{}, ErrSameEmail
+	}
+	if _, err = u.repo.GetByEmail(ctx, email); err == nil {
+		return LoginResult{}, ErrEmailAlreadyExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return LoginResult{}, err
+	}
+	if err = u.repo.UpdateEmail(ctx, uid, email); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return LoginResult{}, ErrEmailAlreadyExists
+		}
+		return LoginResult{}, err
+	}
+	if u.tokens != nil {
+		if err = u.tokens.InvalidateForUser(ctx, uid, domain.TokenPurposePasswordReset); err != nil {
+			return LoginResult{}, err
+		}
+	}
+
+	if u.mailer != nil {
+		// As in Register, delivery problems do not undo the change; the user
+		// can ask for another verification link.
+		_ = u.mailer.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "Your secure-notes email address was changed",
+			Body: fmt.Sprintf("The email address on your secure-notes account was changed to %s.\n\n"+
+				"If you did not do this, reset your password and contact support.", email),
+		})
+		user.Email = email
+		_ = u.sendVerification(ctx, user)
+	}
+	return u.reissueAfterRevoke(ctx, uid)
+}
+
+// DeleteAccount permanently deletes the caller's account after checking the
+// password. Notes, keys, sessions and tokens are removed with it, and access
+// tokens already issued stop working because their owner is gone. Accounts
+// created through single sign-on must set a password first.
+func (u *UserAuth) DeleteAccount(ctx context.Context, uid int64, password string) error {
+	if _, err := u.checkCurrentPassword(ctx, uid, password); err != nil {
+		return err
+	}
+	return u.repo.Delete(ctx, uid)
+}
+
+// checkCurrentPassword re-authenticates a signed-in user. Failures count
+// against the same throttle as Login, so a stolen access token cannot be used
+// to guess the password.
+func (u *UserAuth) checkCurrentPassword(ctx context.Context, uid int64, password string) (domain.User, error) {
+	user, err := u.fresh.GetByID(ctx, uid)
+	if err != nil {
+		return domain.User{}, err
+	}
+	keys := u.loginKeys(ctx, user.Email)
+	if err = u.checkThrottle(ctx, keys); err != nil {
+		return domain.User{}, err
+	}
+	ok, err := security.VerifyPassword(password, user.PasswordHash)
+	if err != nil || !ok {
+		if err := u.recordFailure(ctx, keys); err != nil {
+			return domain.User{}, err
+		}
+		return domain.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// reissueAfterRevoke signs out every session of uid and returns tokens for a
+// new one.
+func (u *UserAuth) reissueAfterRevoke(ctx context.Context, uid int64) (LoginResult, error) {
+	if err := u.revokeAllBefore(ctx, uid, time.Now()); err != nil {
+		return LoginResult{}, err
+	}
+	return u.startSession(ctx, uid)
+}
@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/cached"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func newAccountAuth(t *testing.T) (*service.UserAuth, *fakeUserRepo, *fakeOneTimeTokenRepo, *fakeMailer) {
+	t.Helper()
+	tokens, mailer := &fakeOneTimeTokenRepo{}, &fakeMailer{}
+	svc, users := newTestAuth(t,
+		service.WithRefreshTokens(&fakeRefreshRepo{}, time.Hour),
+		service.WithRevocation(newFakeRevocationStore()),
+		service.WithSessions(&fakeSessionRepo{}),
+		service.WithMailer(tokens, mailer, "https://notes.example.com"))
+	return svc, users, tokens, mailer
+}
+
+func TestUserAuth_ChangePassword(t *testing.T) {
+	svc, _, _, _ := newAccountAuth(t)
+	ctx := context.Background()
+	other := login(t, svc)
+
+	if _, err := svc.ChangePassword(ctx, 1, "wrong password entirely", newPassword); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+	if _, err := svc.ChangePassword(ctx, 1, testPassword, "short"); !errors.Is(err, service.ErrPasswordTooShort) {
+		t.Fatalf("expected ErrPasswordTooShort, got: %v", err)
+	}
+	res, err := svc.ChangePassword(ctx, 1, testPassword, newPassword)
+	if err != nil {
+		t.Fatalf("change: %v", err)
+	}
+
+	if _, err = svc.Authenticate(ctx, other.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("other sessions must be revoked, got: %v", err)
+	}
+	if _, err = svc.Refresh(ctx, other.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("other refresh tokens must be revoked, got: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, res.AccessToken); err != nil {
+		t.Fatalf("the returned token must stay valid: %v", err)
+	}
+	if _, err = svc.Refresh(ctx, res.RefreshToken); err != nil {
+		t.Fatalf("the returned refresh token must stay valid: %v", err)
+	}
+	if _, err = svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: newPassword}); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+}
+
+func TestUserAuth_ChangePassword_IgnoresCachedHash(t *testing.T) {
+	users := newFakeUserRepo()
+	svc := service.NewUserAuth(cached.NewUserRepo(users, time.Minute),
+		security.NewJWTManager("test-secret", "secure-notes", time.Hour), service.WithUncachedUsers(users))
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	login(t, svc) // caches the user
+
+	// Another instance resets the password.
+	hash, err := security.HashPassword(newPassword, security.DefaultArgon2Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = users.UpdatePasswordHash(ctx, 1, hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.ChangePassword(ctx, 1, testPassword, testPassword+" again"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("the old password must be refused, got: %v", err)
+	}
+	if _, err = svc.ChangePassword(ctx, 1, newPassword, testPassword+" again"); err != nil {
+		t.Fatalf("the new password must be accepted: %v", err)
+	}
+}
+
+func TestUserAuth_ChangeEmail(t *testing.T) {
+	svc, users, tokens, mailer := newAccountAuth(t)
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, domain.User{Email: "taken@example.com", PasswordHash: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+	verified := time.Now()
+	u := users.users[1]
+	u.EmailVerifiedAt = &verified
+	users.users[1] = u
+
+	if _, err := svc.ChangeEmail(ctx, 1, "wrong password entirely", "new@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+	if _, err := svc.ChangeEmail(ctx, 1, testPassword, "taken@example.com"); !errors.Is(err, service.ErrEmailAlreadyExists) {
+		t.Fatalf("expected ErrEmailAlreadyExists, got: %v", err)
+	}
+	if err := svc.ForgotPassword(ctx, "a@example.com"); err != nil {
+		t.Fatalf("forgot: %v", err)
+	}
+	oldReset := mailer.lastToken()
+	res, err := svc.ChangeEmail(ctx, 1, testPassword, "new@example.com")
+	if err != nil || res.AccessToken == "" {
+		t.Fatalf("change: %+v %v", res, err)
+	}
+	if users.users[1].Email != "new@example.com" || users.users[1].EmailVerifiedAt != nil {
+		t.Fatalf("email must change and need re-verification: %+v", users.users[1])
+	}
+
+	notice, link := mailer.sent[len(mailer.sent)-2], mailer.sent[len(mailer.sent)-1]
+	if notice.To != "a@example.com" || !strings.Contains(notice.Body, "new@example.com") {
+		t.Fatalf("old address must be notified: %+v", notice)
+	}
+	if link.To != "new@example.com" {
+		t.Fatalf("verification must go to the new address: %+v", link)
+	}
+
+	// A link mailed to the old address must not verify the new one.
+	_, _ = tokens.Create(ctx, domain.OneTimeToken{UserID: 1, Purpose: domain.TokenPurposeVerifyEmail,
+		Email: "a@example.com", TokenHash: security.HashToken("stale"), ExpiresAt: time.Now().Add(time.Hour)})
+	if err = svc.VerifyEmail(ctx, "stale"); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Fatalf("expected ErrInvalidVerificationToken, got: %v", err)
+	}
+	if err = svc.VerifyEmail(ctx, mailer.lastToken()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// Nor may a reset link, whether mailed before the change or left over.
+	if err = svc.ResetPassword(ctx, oldReset, newPassword); !errors.Is(err, service.ErrInvalidResetToken) {
+		t.Fatalf("reset links must be invalidated, got: %v", err)
+	}
+	_, _ = tokens.Create(ctx, domain.OneTimeToken{UserID: 1, Purpose: domain.TokenPurposePasswordReset,
+		Email: "a@example.com", TokenHash: security.HashToken("stale-reset"), ExpiresAt: time.Now().Add(time.Hour)})
+	if err = svc.ResetPassword(ctx, "stale-reset", newPassword); !errors.Is(err, service.ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken, got: %v", err)
+	}
+}
+
+func TestUserAuth_DeleteAccount(t *testing.T) {
+	svc, users, _, _ := newAccountAuth(t)
+	ctx := context.Background()
+	res := login(t, svc)
+
+	if err := svc.DeleteAccount(ctx, 1, "wrong password entirely"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+	if _, ok := users.users[1]; !ok {
+		t.Fatal("a failed re-authentication must not delete the account")
+	}
+	if err := svc.DeleteAccount(ctx, 1, testPassword); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := users.users[1]; ok {
+		t.Fatal("account should be gone")
+	}
+	if _, err := svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("tokens of a deleted account must be revoked, got: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrInvalidRole       = errors.New("role must be user or admin")
+	ErrCannotModifySelf  = errors.New("administrators cannot disable, suspend or demote themselves")
+	ErrInvalidSuspension = errors.New("suspension must end in the future")
+)
+
+// ListUsers returns a page of accounts ordered by ID.
+func (u *UserAuth) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	return u.repo.List(ctx, limit, offset)
+}
+
+// DisableUser blocks every way into the account and signs it out
+// everywhere. actorID is the administrator making the change.
+func (u *UserAuth) DisableUser(ctx context.Context, actorID, uid int64) error {
+	if actorID == uid {
+		return ErrCannotModifySelf
+	}
+	if _, err := u.getUser(ctx, uid); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := u.repo.SetDisabled(ctx, uid, &now); err != nil {
+		return err
+	}
+	return u.revokeAllBefore(ctx, uid, now)
+}
+
+// EnableUser lifts DisableUser. The user has to sign in again.
+func (u *UserAuth) EnableUser(ctx context.Context, uid int64) error {
+	if _, err := u.getUser(ctx, uid); err != nil {
+		return err
+	}
+	return u.repo.SetDisabled(ctx, uid, nil)
+}
+
+// SuspendUser blocks sign-in and every outstanding token until the given
+// time. Sessions are kept, so they work again once the suspension ends or is
+// lifted. actorID is the administrator making the change.
+func (u *UserAuth) SuspendUser(ctx context.Context, actorID, uid int64, until time.Time) error {
+	if actorID == uid {
+		return ErrCannotModifySelf
+	}
+	if !until.After(time.Now()) {
+		return ErrInvalidSuspension
+	}
+	if _, err := u.getUser(ctx, uid); err != nil {
+		return err
+	}
+	return u.repo.SetSuspended(ctx, uid, &until)
+}
+
+// UnsuspendUser lifts SuspendUser early.
+func (u *UserAuth) UnsuspendUser(ctx context.Context, uid int64) error {
+	if _, err := u.getUser(ctx, uid); err != nil {
+		return err
+	}
+	return u.repo.SetSuspended(ctx, uid, nil)
+}
+
+// ForcePasswordReset signs the user out everywhere, deletes their personal
+// access tokens and refuses password logins until a new password is set. A reset link is mailed when mail is
+// configured; otherwise the user can request one with ForgotPassword.
+func (u *UserAuth) ForcePasswordReset(ctx context.Context, uid int64) error {
+	user, err := u.getUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if err = u.repo.SetPasswordResetRequired(ctx, uid, true); err != nil {
+		return err
+	}
+	if err = u.revokeAllBefore(ctx, uid, time.Now()); err != nil {
+		return err
+	}
+	if err = u.revokePersonalTokens(ctx, uid); err != nil {
+		return err
+	}
+	if u.mailer == nil {
+		return nil
+	}
+	return u.sendForcedReset(ctx, user)
+}
+
+// SetRole changes the user's role. Outstanding tokens carry the old role, so
+// the user is signed out everywhere. actorID is 0 for command-line use.
+func (u *UserAuth) SetRole(ctx context.Context, actorID, uid int64, role string) error {
+	if !domain.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if actorID == uid && role != domain.RoleAdmin {
+		return ErrCannotModifySelf
+	}
+	if _, err := u.getUser(ctx, uid); err != nil {
+		return err
+	}
+	if err := u.repo.SetRole(ctx, uid, role); err != nil {
+		return err
+	}
+	return u.revokeAllBefore(ctx, uid, time.Now())
+}
+
+// UserIDByEmail looks up an account for administrative tools.
+func (u *UserAuth) UserIDByEmail(ctx context.Context, email string) (int64, error) {
+	user, err := u.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+func (u *UserAuth) getUser(ctx context.Context, uid int64) (domain.User, error) {
+	user, err := u.repo.GetByID(ctx, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,162 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func TestUserAuth_RoleInToken(t *testing.T) {
+	svc, users := newTestAuth(t)
+	ctx := context.Background()
+
+	p, err := svc.Authenticate(ctx, login(t, svc).AccessToken)
+	if err != nil || p.Role != domain.RoleUser {
+		t.Fatalf("new accounts should be users: %+v %v", p, err)
+	}
+	if users.users[1].Role != domain.RoleUser {
+		t.Fatalf("register should store the user role, got %q", users.users[1].Role)
+	}
+
+	if err = svc.SetRole(ctx, 0, 1, "root"); !errors.Is(err, service.ErrInvalidRole) {
+		t.Fatalf("expected ErrInvalidRole, got: %v", err)
+	}
+	if err = svc.SetRole(ctx, 0, 1, domain.RoleAdmin); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	p, err = svc.Authenticate(ctx, login(t, svc).AccessToken)
+	if err != nil || p.Role != domain.RoleAdmin {
+		t.Fatalf("expected an admin token: %+v %v", p, err)
+	}
+	if err = svc.SetRole(ctx, 1, 1, domain.RoleUser); !errors.Is(err, service.ErrCannotModifySelf) {
+		t.Fatalf("admins must not demote themselves, got: %v", err)
+	}
+}
+
+func TestUserAuth_DisableUser(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	personal := &fakePersonalTokenRepo{}
+	svc, _ := newTestAuth(t,
+		service.WithRefreshTokens(refresh, time.Hour),
+		service.WithRevocation(newFakeRevocationStore()),
+		service.WithPersonalTokens(personal))
+	ctx := context.Background()
+
+	res := login(t, svc)
+	_, pat, err := svc.CreatePersonalToken(ctx, 1, "ci", []string{domain.ScopeNotesRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = svc.DisableUser(ctx, 1, 1); !errors.Is(err, service.ErrCannotModifySelf) {
+		t.Fatalf("expected ErrCannotModifySelf, got: %v", err)
+	}
+	if err = svc.DisableUser(ctx, 99, 42); !errors.Is(err, service.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got: %v", err)
+	}
+	if err = svc.DisableUser(ctx, 99, 1); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+
+	if _, err = svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("access token should be revoked, got: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, pat); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("personal token should stop working, got: %v", err)
+	}
+	if _, err = svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); !errors.Is(err, service.ErrAccountDisabled) {
+		t.Fatalf("expected ErrAccountDisabled, got: %v", err)
+	}
+	if _, err = svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: "wrong password, long enough"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("status must not leak without the password, got: %v", err)
+	}
+
+	if err = svc.EnableUser(ctx, 1); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	login(t, svc)
+	if _, err = svc.Authenticate(ctx, pat); err != nil {
+		t.Fatalf("personal token should work again: %v", err)
+	}
+}
+
+func TestUserAuth_ForcePasswordReset(t *testing.T) {
+	svc, _, mailer, _ := newResetAuth(t, service.WithPersonalTokens(&fakePersonalTokenRepo{}))
+	ctx := context.Background()
+	before := login(t, svc)
+	_, pat, err := svc.CreatePersonalToken(ctx, 1, "ci", []string{domain.ScopeNotesRead}, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	if err := svc.ForcePasswordReset(ctx, 1); err != nil {
+		t.Fatalf("force reset: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, before.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("sessions should be signed out, got: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, pat); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("personal tokens should be deleted, got: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); !errors.Is(err, service.ErrPasswordResetRequired) {
+		t.Fatalf("expected ErrPasswordResetRequired, got: %v", err)
+	}
+	raw := mailer.lastToken()
+	if raw == "" {
+		t.Fatalf("expected a reset email, got %+v", mailer.sent)
+	}
+	if err := svc.ResetPassword(ctx, raw, newPassword); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: newPassword}); err != nil {
+		t.Fatalf("login after reset: %v", err)
+	}
+}
+
+func TestUserAuth_SuspendUser(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	svc, users := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour))
+	ctx := context.Background()
+	res := login(t, svc)
+
+	if err := svc.SuspendUser(ctx, 99, 1, time.Now().Add(-time.Minute)); !errors.Is(err, service.ErrInvalidSuspension) {
+		t.Fatalf("expected ErrInvalidSuspension, got: %v", err)
+	}
+	if err := svc.SuspendUser(ctx, 1, 1, time.Now().Add(time.Hour)); !errors.Is(err, service.ErrCannotModifySelf) {
+		t.Fatalf("expected ErrCannotModifySelf, got: %v", err)
+	}
+	if err := svc.SuspendUser(ctx, 99, 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+
+	if _, err := svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, service.ErrAccountSuspended) {
+		t.Fatalf("outstanding tokens should be blocked, got: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, res.RefreshToken); !errors.Is(err, service.ErrAccountSuspended) {
+		t.Fatalf("refresh should be blocked, got: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); !errors.Is(err, service.ErrAccountSuspended) {
+		t.Fatalf("expected ErrAccountSuspended, got: %v", err)
+	}
+
+	// An expired suspension needs no cleanup.
+	past := time.Now().Add(-time.Second)
+	u := users.users[1]
+	u.SuspendedUntil = &past
+	users.users[1] = u
+	if _, err := svc.Authenticate(ctx, res.AccessToken); err != nil {
+		t.Fatalf("session should work once the suspension ends: %v", err)
+	}
+
+	if err := svc.SuspendUser(ctx, 99, 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	if err := svc.UnsuspendUser(ctx, 1); err != nil {
+		t.Fatalf("unsuspend: %v", err)
+	}
+	login(t, svc)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/mail"
 	"github.com/secure-notes/internal/security"
 	"gorm.io/gorm"
 	"strings"
@@ -11,20 +12,85 @@ import (
 )
 
 type UserAuth struct {
-	repo domain.UserRepository
-	jwt  *security.JWTManager
+	repo       domain.UserRepository
+	fresh      domain.UserRepository // reads credentials; repo may cache
+	jwt        *security.JWTManager
+	refresh    domain.RefreshTokenRepository
+	refreshTTL time.Duration
+	revoked    domain.RevocationStore
+	mfa        domain.MFARepository
+	mfaKeys    security.KeyProvider
+	mfaIssuer  string
+	attempts   domain.LoginAttemptStore
+	throttle   LoginThrottlePolicy
+	tokens     domain.OneTimeTokenRepository
+	mailer     mail.Mailer
+	baseURL    string
+	personal   domain.PersonalAccessTokenRepository
+	sessions   domain.SessionRepository
+	passwords  security.PasswordPolicy
+
+	oidc         OIDCProvider
+	identities   domain.UserIdentityRepository
+	oidcRequests domain.OIDCAuthRequestRepository
 }
 
 var (
 	ErrInvalidEmail       = errors.New("invalid email")
 	ErrInvalidPassword    = errors.New("invalid password")
-	ErrPasswordTooShort   = errors.New("password is short")
+	ErrPasswordTooShort   = security.ErrPasswordTooShort
 	ErrEmailAlreadyExists = errors.New("email already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	ErrAccountDisabled       = errors.New("account is disabled")
+	ErrAccountSuspended      = domain.ErrAccountSuspended
+	ErrPasswordResetRequired = errors.New("password must be reset before signing in")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrRefreshDisabled     = errors.New("refresh tokens are not enabled")
 )
 
-func NewUserAuth(repo domain.UserRepository, jwtm *security.JWTManager) *UserAuth {
-	return &UserAuth{repo: repo, jwt: jwtm}
+type AuthOption func(*UserAuth)
+
+// WithRefreshTokens makes Login issue single-use refresh tokens valid for ttl.
+func WithRefreshTokens(repo domain.RefreshTokenRepository, ttl time.Duration) AuthOption {
+	return func(u *UserAuth) {
+		u.refresh = repo
+		u.refreshTTL = ttl
+	}
+}
+
+// WithRevocation enables logout by checking access tokens against store.
+func WithRevocation(store domain.RevocationStore) AuthOption {
+	return func(u *UserAuth) {
+		u.revoked = store
+	}
+}
+
+// WithPasswordPolicy replaces security.DefaultPasswordPolicy for new
+// passwords.
+func WithPasswordPolicy(policy security.PasswordPolicy) AuthOption {
+	return func(u *UserAuth) {
+		u.passwords = policy
+	}
+}
+
+// WithUncachedUsers gives password checks a user repository that always
+// reads the database, for when the one passed to NewUserAuth caches users and
+// so may hold a password hash another instance has already replaced.
+func WithUncachedUsers(repo domain.UserRepository) AuthOption {
+	return func(u *UserAuth) {
+		u.fresh = repo
+	}
+}
+
+func NewUserAuth(repo domain.UserRepository, jwtm *security.JWTManager, opts ...AuthOption) *UserAuth {
+	u := &UserAuth{repo: repo, fresh: repo, jwt: jwtm, passwords: security.DefaultPasswordPolicy()}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
 }
 func (u *UserAuth) Register(ctx context.Context, user domain.User) (domain.User, error) {
 	if strings.TrimSpace(user.Email) == "" {
@@ -33,27 +99,41 @@ func (u *UserAuth) Register(ctx context.Context, user domain.User) (domain.User,
 	if strings.TrimSpace(user.PasswordHash) == "" {
 		return domain.User{}, ErrInvalidPassword
 	}
-	if len(strings.TrimSpace(user.PasswordHash)) < 16 {
-		return domain.User{}, ErrPasswordTooShort
+	if err := u.passwords.Check(user.PasswordHash, user.Email); err != nil {
+		return domain.User{}, err
 	}
+	user.Role = domain.RoleUser
 	var err error
 	user.PasswordHash, err = security.HashPassword(user.PasswordHash, security.DefaultArgon2Params())
 	if err != nil {
 		return domain.User{}, ErrInvalidCredentials
 	}
-	_, err = u.repo.Register(ctx, user)
+	created, err := u.repo.Register(ctx, user)
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return domain.User{}, ErrEmailAlreadyExists
 		}
 		return domain.User{}, err
 	}
+	if u.mailer != nil {
+		// The account exists either way; a lost email can be re-sent with
+		// ResendVerification, so delivery errors do not fail registration.
+		_ = u.sendVerification(ctx, created)
+	}
 	return domain.User{}, nil
 }
 
 type LoginResult struct {
-	AccessToken string
-	ExpiresAt   time.Time
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string // empty when refresh tokens are disabled
+	RefreshExpiresAt time.Time
+
+	// MFARequired means no tokens were issued; the caller must pass
+	// ChallengeToken and a second factor to VerifyMFA.
+	MFARequired        bool
+	ChallengeToken     string
+	ChallengeExpiresAt time.Time
 }
 
 func (u *UserAuth) Login(ctx context.Context, user domain.User) (LoginResult, error) {
@@ -63,21 +143,309 @@ func (u *UserAuth) Login(ctx context.Context, user domain.User) (LoginResult, er
 	if strings.TrimSpace(user.PasswordHash) == "" {
 		return LoginResult{}, ErrInvalidPassword
 	}
-	if len(strings.TrimSpace(user.PasswordHash)) < 16 {
-		return LoginResult{}, ErrPasswordTooShort
+	keys := u.loginKeys(ctx, user.Email)
+	if err := u.checkThrottle(ctx, keys); err != nil {
+		return LoginResult{}, err
 	}
 	dbUser, err := u.repo.GetByEmail(ctx, user.Email)
-
-	status, err := security.VerifyPassword(user.PasswordHash, dbUser.PasswordHash)
-	if err != nil || !status {
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return LoginResult{}, err
+	}
+	var status bool
+	if err != nil || dbUser.PasswordHash == "" {
+		// Unknown accounts and accounts without a password are rejected
+		// after the same Argon2 work as a wrong password, so response times
+		// do not tell them apart.
+		security.VerifyDummyPassword(user.PasswordHash)
+	} else if status, err = security.VerifyPassword(user.PasswordHash, dbUser.PasswordHash); err != nil {
+		return LoginResult{}, err
+	}
+	if !status {
+		if err := u.recordFailure(ctx, keys); err != nil {
+			return LoginResult{}, err
+		}
 		return LoginResult{}, ErrInvalidCredentials
 	}
-	token, exp, err := u.jwt.Sign(dbUser.ID)
+	if err := u.resetThrottle(ctx, keys); err != nil {
+		return LoginResult{}, err
+	}
+	// Status is only revealed to callers who know the password.
+	if err := accountStatus(dbUser, time.Now()); err != nil {
+		return LoginResult{}, err
+	}
+	if dbUser.PasswordResetRequired {
+		return LoginResult{}, ErrPasswordResetRequired
+	}
+	u.upgradePasswordHash(ctx, dbUser, user.PasswordHash)
+	if challenge, ok, err := u.mfaChallenge(ctx, dbUser.ID); err != nil || ok {
+		return challenge, err
+	}
+	return u.startSession(ctx, dbUser.ID)
+}
+
+// upgradePasswordHash rehashes a verified password whose stored hash is
+// weaker than the current policy. It is best effort: a failure leaves the old
+// hash in place and is retried on the next login.
+func (u *UserAuth) upgradePasswordHash(ctx context.Context, user domain.User, password string) {
+	params := security.DefaultArgon2Params()
+	if !security.NeedsRehash(user.PasswordHash, params) {
+		return
+	}
+	hash, err := security.HashPassword(password, params)
+	if err != nil {
+		return
+	}
+	_ = u.repo.UpdatePasswordHash(ctx, user.ID, hash)
+}
+
+// setPassword stores a new password hash chosen by the user, which also
+// satisfies a forced reset.
+func (u *UserAuth) setPassword(ctx context.Context, uid int64, hash string) error {
+	if err := u.repo.UpdatePasswordHash(ctx, uid, hash); err != nil {
+		return err
+	}
+	return u.repo.SetPasswordResetRequired(ctx, uid, false)
+}
+
+// activeUser loads uid and fails if the account is disabled or suspended.
+func (u *UserAuth) activeUser(ctx context.Context, uid int64) (domain.User, error) {
+	user, err := u.repo.GetByID(ctx, uid)
 	if err != nil {
+		return domain.User{}, err
+	}
+	if err = accountStatus(user, time.Now()); err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// accountStatus reports why user may not sign in at now, if anything.
+func accountStatus(user domain.User, now time.Time) error {
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	if user.SuspendedUntil != nil && now.Before(*user.SuspendedUntil) {
+		return ErrAccountSuspended
+	}
+	return nil
+}
+
+// tokenOwnerError maps an activeUser failure for the owner of a presented
+// token. Tokens of deleted and disabled accounts are simply revoked; a
+// suspension is reported so the client can tell the user.
+func tokenOwnerError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrAccountDisabled) {
+		return security.ErrTokenRevoked
+	}
+	return err
+}
+
+// startSession issues tokens for a fully authenticated login, starting a new
+// session and refresh token family.
+func (u *UserAuth) startSession(ctx context.Context, uid int64) (LoginResult, error) {
+	now := time.Now()
+	user, err := u.activeUser(ctx, uid)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	sessionID, err := security.NewTokenID()
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err = u.createSession(ctx, uid, sessionID, now); err != nil {
 		return LoginResult{}, err
 	}
-	return LoginResult{
+	return u.issue(ctx, user, sessionID, now)
+}
+
+// Refresh redeems a refresh token for a new access token and a new refresh
+// token in the same family. Each refresh token works once: presenting a used
+// one means it leaked, so the whole family is revoked.
+func (u *UserAuth) Refresh(ctx context.Context, refreshToken string) (LoginResult, error) {
+	if u.refresh == nil {
+		return LoginResult{}, ErrRefreshDisabled
+	}
+	if strings.TrimSpace(refreshToken) == "" {
+		return LoginResult{}, ErrInvalidRefreshToken
+	}
+	stored, err := u.refresh.GetByHash(ctx, security.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return LoginResult{}, ErrInvalidRefreshToken
+		}
+		return LoginResult{}, err
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return LoginResult{}, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return LoginResult{}, u.revokeReused(ctx, stored.FamilyID)
+	}
+	ok, err := u.refresh.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !ok {
+		return LoginResult{}, u.revokeReused(ctx, stored.FamilyID)
+	}
+	user, err := u.activeUser(ctx, stored.UserID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	now := time.Now()
+	if err = u.renewSession(ctx, stored.UserID, stored.FamilyID, now); err != nil {
+		return LoginResult{}, err
+	}
+	return u.issue(ctx, user, stored.FamilyID, now)
+}
+
+func (u *UserAuth) revokeReused(ctx context.Context, familyID string) error {
+	if err := u.refresh.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issue signs an access token for sessionID issued at now and, when enabled,
+// a refresh token in the session's family. The token carries the user's role.
+func (u *UserAuth) issue(ctx context.Context, user domain.User, sessionID string, now time.Time) (LoginResult, error) {
+	uid := user.ID
+	token, exp, err := u.jwt.SignClaims(security.Claims{
+		UserID:    uid,
+		SessionID: sessionID,
+		IssuedAt:  now,
+		Scopes:    domain.SessionScopes,
+		Role:      roleOf(user),
+	})
+	if err != nil {
+		return LoginResult{}, err
+	}
+	res := LoginResult{
 		AccessToken: token,
 		ExpiresAt:   exp,
+	}
+	if u.refresh == nil {
+		return res, nil
+	}
+
+	raw, hash, err := security.NewOpaqueToken()
+	if err != nil {
+		return LoginResult{}, err
+	}
+	rt, err := u.refresh.Create(ctx, domain.RefreshToken{
+		UserID:    uid,
+		FamilyID:  sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(u.refreshTTL),
+	})
+	if err != nil {
+		return LoginResult{}, err
+	}
+	res.RefreshToken = raw
+	res.RefreshExpiresAt = rt.ExpiresAt
+	return res, nil
+}
+
+// Authenticate verifies an access token and checks neither it nor its session
+// has been revoked and that its account is still active. Personal access
+// tokens are accepted too when enabled.
+func (u *UserAuth) Authenticate(ctx context.Context, token string) (domain.Principal, error) {
+	if isPersonalToken(token) {
+		return u.authenticatePersonal(ctx, token)
+	}
+	claims, err := u.jwt.ParseClaims(token)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	if u.revoked != nil {
+		revoked, err := u.revoked.IsRevoked(ctx, claims.TokenID, claims.UserID, claims.IssuedAt)
+		if err != nil {
+			return domain.Principal{}, err
+		}
+		if revoked {
+			return domain.Principal{}, security.ErrTokenRevoked
+		}
+	}
+	if err = u.checkSession(ctx, claims); err != nil {
+		return domain.Principal{}, err
+	}
+	if _, err = u.activeUser(ctx, claims.UserID); err != nil {
+		return domain.Principal{}, tokenOwnerError(err)
+	}
+	scopes := claims.Scopes
+	if scopes == nil {
+		// Issued before tokens carried scopes; those were all sessions.
+		scopes = domain.SessionScopes
+	}
+	role := claims.Role
+	if role == "" {
+		role = domain.RoleUser
+	}
+	return domain.Principal{
+		UserID:    claims.UserID,
+		TokenID:   claims.TokenID,
+		SessionID: claims.SessionID,
+		ExpiresAt: claims.ExpiresAt,
+		Scopes:    scopes,
+		Role:      role,
 	}, nil
 }
+
+// Logout revokes the caller's access token and session and, if given, the
+// refresh token family it was issued with.
+func (u *UserAuth) Logout(ctx context.Context, p domain.Principal, refreshToken string) error {
+	if u.revoked != nil && p.TokenID != "" {
+		if err := u.revoked.RevokeToken(ctx, p.TokenID, p.UserID, p.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	if u.sessions != nil && p.SessionID != "" {
+		if err := u.RevokeSession(ctx, p.UserID, p.SessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	if u.refresh == nil || strings.TrimSpace(refreshToken) == "" {
+		return nil
+	}
+	stored, err := u.refresh.GetByHash(ctx, security.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != p.UserID {
+		return nil
+	}
+	return u.refresh.RevokeFamily(ctx, stored.FamilyID)
+}
+
+// LogoutAll revokes every session, access and refresh token the user holds.
+func (u *UserAuth) LogoutAll(ctx context.Context, uid int64) error {
+	return u.revokeAllBefore(ctx, uid, time.Now())
+}
+
+func (u *UserAuth) revokeAllBefore(ctx context.Context, uid int64, cutoff time.Time) error {
+	if u.revoked != nil {
+		if err := u.revoked.RevokeAllForUser(ctx, uid, cutoff); err != nil {
+			return err
+		}
+	}
+	if u.sessions != nil {
+		if err := u.sessions.RevokeAllForUser(ctx, uid); err != nil {
+			return err
+		}
+	}
+	if u.refresh != nil {
+		return u.refresh.RevokeAllForUser(ctx, uid)
+	}
+	return nil
+}
+
+// roleOf treats accounts created before roles existed as plain users.
+func roleOf(user domain.User) string {
+	if user.Role == "" {
+		return domain.RoleUser
+	}
+	return user.Role
+}
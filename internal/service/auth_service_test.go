@@ -0,0 +1,198 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+const testPassword = "correct horse battery staple"
+
+func newTestAuth(t *testing.T, opts ...service.AuthOption) (*service.UserAuth, *fakeUserRepo) {
+	t.Helper()
+	users := newFakeUserRepo()
+	svc := service.NewUserAuth(users, security.NewJWTManager("test-secret", "secure-notes", time.Hour), opts...)
+	if _, err := svc.Register(context.Background(), domain.User{Email: "a@example.com", PasswordHash: testPassword}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return svc, users
+}
+
+func login(t *testing.T, svc *service.UserAuth) service.LoginResult {
+	t.Helper()
+	res, err := svc.Login(context.Background(), domain.User{Email: "a@example.com", PasswordHash: testPassword})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return res
+}
+
+// --- Refresh tests ---
+
+func TestUserAuth_Login_IssuesRefreshToken(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour))
+
+	res := login(t, svc)
+	if res.AccessToken == "" || res.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", res)
+	}
+	if len(refresh.tokens) != 1 || refresh.tokens[0].TokenHash == res.RefreshToken {
+		t.Fatalf("refresh token must be stored hashed: %+v", refresh.tokens)
+	}
+}
+
+func TestUserAuth_Refresh_RotatesWithinFamily(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour))
+	first := login(t, svc)
+
+	second, err := svc.Refresh(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a new refresh token")
+	}
+	if refresh.tokens[0].UsedAt == nil || refresh.tokens[1].FamilyID != refresh.tokens[0].FamilyID {
+		t.Fatalf("rotation did not stay in the family: %+v", refresh.tokens)
+	}
+	if _, err = svc.Refresh(context.Background(), second.RefreshToken); err != nil {
+		t.Fatalf("rotated token should work: %v", err)
+	}
+}
+
+func TestUserAuth_Refresh_ReuseRevokesFamily(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour))
+	first := login(t, svc)
+	other := login(t, svc) // a second, unrelated login
+
+	second, _ := svc.Refresh(context.Background(), first.RefreshToken)
+
+	_, err := svc.Refresh(context.Background(), first.RefreshToken)
+	if !errors.Is(err, service.ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got: %v", err)
+	}
+	if _, err = svc.Refresh(context.Background(), second.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("descendant token must be revoked, got: %v", err)
+	}
+	if _, err = svc.Refresh(context.Background(), other.RefreshToken); err != nil {
+		t.Fatalf("other families must survive: %v", err)
+	}
+}
+
+func TestUserAuth_Refresh_Expired(t *testing.T) {
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour))
+	res := login(t, svc)
+	refresh.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+
+	if _, err := svc.Refresh(context.Background(), res.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got: %v", err)
+	}
+	if _, err := svc.Refresh(context.Background(), "bogus"); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got: %v", err)
+	}
+}
+
+// --- Logout tests ---
+
+func TestUserAuth_Logout_RevokesAccessAndRefresh(t *testing.T) {
+	refresh, revoked := &fakeRefreshRepo{}, newFakeRevocationStore()
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour), service.WithRevocation(revoked))
+	ctx := context.Background()
+	res := login(t, svc)
+
+	p, err := svc.Authenticate(ctx, res.AccessToken)
+	if err != nil || p.TokenID == "" {
+		t.Fatalf("authenticate: %+v %v", p, err)
+	}
+	if err = svc.Logout(ctx, p, res.RefreshToken); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked, got: %v", err)
+	}
+	if _, err = svc.Refresh(ctx, res.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("refresh family should be revoked, got: %v", err)
+	}
+}
+
+func TestUserAuth_LogoutAll(t *testing.T) {
+	refresh, revoked := &fakeRefreshRepo{}, newFakeRevocationStore()
+	svc, _ := newTestAuth(t, service.WithRefreshTokens(refresh, time.Hour), service.WithRevocation(revoked),
+		service.WithSessions(&fakeSessionRepo{}))
+	ctx := context.Background()
+	a, b := login(t, svc), login(t, svc)
+
+	p, _ := svc.Authenticate(ctx, a.AccessToken)
+	if err := svc.LogoutAll(ctx, p.UserID); err != nil {
+		t.Fatalf("logout all: %v", err)
+	}
+	for _, res := range []service.LoginResult{a, b} {
+		if _, err := svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+			t.Fatalf("expected ErrTokenRevoked, got: %v", err)
+		}
+		if _, err := svc.Refresh(ctx, res.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+			t.Fatalf("expected refresh revoked, got: %v", err)
+		}
+	}
+}
+
+// --- Rehash tests ---
+
+func TestUserAuth_Login_UpgradesWeakHash(t *testing.T) {
+	svc, users := newTestAuth(t)
+	weak := security.DefaultArgon2Params()
+	weak.Memory, weak.Iterations = 8*1024, 1
+	hash, _ := security.HashPassword(testPassword, weak)
+	u := users.users[1]
+	u.PasswordHash = hash
+	users.users[1] = u
+
+	login(t, svc)
+	upgraded := users.users[1].PasswordHash
+	if upgraded == hash || security.NeedsRehash(upgraded, security.DefaultArgon2Params()) {
+		t.Fatalf("hash was not upgraded: %s", upgraded)
+	}
+	if ok, _ := security.VerifyPassword(testPassword, upgraded); !ok {
+		t.Fatalf("upgraded hash must verify")
+	}
+
+	login(t, svc)
+	if users.users[1].PasswordHash != upgraded {
+		t.Fatalf("a current hash must not be rewritten")
+	}
+}
+
+// --- Password policy tests ---
+
+func TestUserAuth_Register_PasswordPolicy(t *testing.T) {
+	svc, _ := newTestAuth(t)
+	ctx := context.Background()
+
+	_, err := svc.Register(ctx, domain.User{Email: "bob.smith@example.com", PasswordHash: "bob.smith@example.com rules"})
+	if !errors.Is(err, security.ErrPasswordContainsEmail) {
+		t.Fatalf("expected ErrPasswordContainsEmail, got: %v", err)
+	}
+	_, err = svc.Register(ctx, domain.User{Email: "bob@example.com", PasswordHash: "passwordpassword"})
+	if !errors.Is(err, security.ErrPasswordBreached) {
+		t.Fatalf("expected ErrPasswordBreached, got: %v", err)
+	}
+
+	// A policy only applies to new passwords; Login just checks credentials.
+	lax := service.NewUserAuth(newFakeUserRepo(), security.NewJWTManager("test-secret", "secure-notes", time.Hour),
+		service.WithPasswordPolicy(security.PasswordPolicy{MinLength: 4}))
+	if _, err = lax.Register(ctx, domain.User{Email: "c@example.com", PasswordHash: "hunter"}); err != nil {
+		t.Fatalf("register under a custom policy: %v", err)
+	}
+	if _, err = lax.Login(ctx, domain.User{Email: "c@example.com", PasswordHash: "hunter"}); err != nil {
+		t.Fatalf("short passwords must still log in: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/mail"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// ResendVerification mails a new verification link, invalidating older ones.
+func (u *UserAuth) ResendVerification(ctx context.Context, uid int64) error {
+	if u.mailer == nil {
+		return ErrMailDisabled
+	}
+	user, err := u.repo.GetByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return u.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the address the token was sent to as verified. A link
+// mailed to an address the account no longer uses is rejected.
+func (u *UserAuth) VerifyEmail(ctx context.Context, token string) error {
+	if u.tokens == nil {
+		return ErrMailDisabled
+	}
+	stored, err := u.redeemOneTimeToken(ctx, domain.TokenPurposeVerifyEmail, token)
+	if err == nil {
+		err = u.checkTokenAddress(ctx, stored)
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidOneTimeToken) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	return u.repo.MarkEmailVerified(ctx, stored.UserID, time.Now())
+}
+
+func (u *UserAuth) sendVerification(ctx context.Context, user domain.User) error {
+	if err := u.tokens.InvalidateForUser(ctx, user.ID, domain.TokenPurposeVerifyEmail); err != nil {
+		return err
+	}
+	raw, err := u.newOneTimeToken(ctx, user, domain.TokenPurposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return u.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your secure-notes email address",
+		Body: fmt.Sprintf("Confirm that this address belongs to your secure-notes account:\n%s\n\n"+
+			"The link expires in %d hours. If you did not sign up, ignore this email.",
+			u.link("/verify-email", raw), int(emailVerificationTTL.Hours())),
+	})
+}
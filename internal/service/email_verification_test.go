@@ -0,0 +1,55 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/service"
+)
+
+func TestUserAuth_VerifyEmail(t *testing.T) {
+	tokens, mailer := &fakeOneTimeTokenRepo{}, &fakeMailer{}
+	svc, users := newTestAuth(t, service.WithMailer(tokens, mailer, "https://notes.example.com"))
+	ctx := context.Background()
+
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "a@example.com" {
+		t.Fatalf("registration should send a verification email: %+v", mailer.sent)
+	}
+	first := mailer.lastToken()
+
+	if err := svc.ResendVerification(ctx, 1); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	second := mailer.lastToken()
+	if err := svc.VerifyEmail(ctx, first); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Fatalf("resending must invalidate older links, got: %v", err)
+	}
+	if _, err := svc.Register(ctx, domain.User{Email: "b@example.com", PasswordHash: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if users.users[1].EmailVerifiedAt == nil || users.users[2].EmailVerifiedAt != nil {
+		t.Fatalf("only the token's account should be verified")
+	}
+	if err := svc.ResendVerification(ctx, 1); !errors.Is(err, service.ErrEmailAlreadyVerified) {
+		t.Fatalf("expected ErrEmailAlreadyVerified, got: %v", err)
+	}
+}
+
+func TestUserAuth_VerifyEmail_LegacyLink(t *testing.T) {
+	tokens, mailer := &fakeOneTimeTokenRepo{}, &fakeMailer{}
+	svc, users := newTestAuth(t, service.WithMailer(tokens, mailer, "https://notes.example.com"))
+	// Links sent before tokens recorded the address have an empty one.
+	tokens.tokens[len(tokens.tokens)-1].Email = ""
+
+	if err := svc.VerifyEmail(context.Background(), mailer.lastToken()); err != nil {
+		t.Fatalf("legacy link: %v", err)
+	}
+	if users.users[1].EmailVerifiedAt == nil {
+		t.Fatalf("the account should be verified")
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+// ExpiryPurger deletes rows that have expired, such as deny-list entries of
+// tokens past their own expiry, so such tables stay bounded.
+type ExpiryPurger struct {
+	store domain.ExpiredPurger
+	now   func() time.Time
+}
+
+func NewExpiryPurger(store domain.ExpiredPurger) *ExpiryPurger {
+	return &ExpiryPurger{store: store, now: time.Now}
+}
+
+func (p *ExpiryPurger) PurgeOnce(ctx context.Context) (int64, error) {
+	return p.store.PurgeExpired(ctx, p.now())
+}
+
+// Run purges once and then every interval until ctx is cancelled, like
+// TrashPurger.Run.
+func (p *ExpiryPurger) Run(ctx context.Context, interval time.Duration, report func(purged int64, err error)) {
+	runEvery(ctx, interval, p.PurgeOnce, report)
+}
+
+// runEvery runs pass once and then every interval until ctx is cancelled.
+// report, when set, is told the outcome of each pass; a failed pass is
+// retried on the next tick.
+func runEvery(ctx context.Context, interval time.Duration, pass func(context.Context) (int64, error), report func(int64, error)) {
+	if report == nil {
+		report = func(int64, error) {}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report(pass(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/service"
+)
+
+type fakeExpiredStore struct {
+	expiresAt []time.Time
+}
+
+func (f *fakeExpiredStore) PurgeExpired(_ context.Context, now time.Time) (int64, error) {
+	var kept []time.Time
+	for _, at := range f.expiresAt {
+		if !at.Before(now) {
+			kept = append(kept, at)
+		}
+	}
+	purged := int64(len(f.expiresAt) - len(kept))
+	f.expiresAt = kept
+	return purged, nil
+}
+
+func TestExpiryPurger_PurgeOnce(t *testing.T) {
+	now := time.Now()
+	store := &fakeExpiredStore{expiresAt: []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour)}}
+
+	purged, err := service.NewExpiryPurger(store).PurgeOnce(context.Background())
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 2 || len(store.expiresAt) != 1 {
+		t.Fatalf("purged %d, %d left; want 2 purged and 1 left", purged, len(store.expiresAt))
+	}
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+// ErrRotationInProgress is returned when options ask for work an unfinished
+// job was not started with. Resume it as it is, or pass Restart.
+var ErrRotationInProgress = errors.New("an unfinished rotation job exists with different options; resume it without them or restart")
+
+// NoteResealer re-encrypts a stored note or revision row under its owner's
+// current data key.
+type NoteResealer interface {
+	Reseal(ctx context.Context, stored domain.Note) (domain.Note, bool, error)
+	ResealRevision(ctx context.Context, stored domain.NoteRevision) (domain.NoteRevision, bool, error)
+}
+
+type RotationOptions struct {
+	NewMasterKey   bool // ask the key provider for a new master key version first
+	NewDataKeys    bool // issue a fresh data key to every user
+	ReencryptNotes bool // move every note and note revision onto its owner's current data key
+	BatchSize      int
+	Restart        bool // ignore an unfinished job instead of resuming it
+}
+
+type RotationProgress struct {
+	JobID     int64
+	Phase     string
+	Processed int64
+	Total     int64
+	Resumed   bool
+}
+
+// KeyRotation rewraps data keys and TOTP secrets under the current master key
+// and optionally re-encrypts notes. Progress is checkpointed after every batch so an
+// interrupted run resumes where it stopped.
+type KeyRotation struct {
+	keys     security.KeyProvider
+	dataKeys domain.DataKeyRepository
+	mfa      domain.MFASecretRepository
+	notes    domain.NoteMaintenanceRepository
+	resealer NoteResealer
+	jobs     domain.KeyRotationRepository
+}
+
+func NewKeyRotation(keys security.KeyProvider, dataKeys domain.DataKeyRepository, mfa domain.MFASecretRepository,
+	notes domain.NoteMaintenanceRepository, resealer NoteResealer, jobs domain.KeyRotationRepository) *KeyRotation {
+	return &KeyRotation{keys: keys, dataKeys: dataKeys, mfa: mfa, notes: notes, resealer: resealer, jobs: jobs}
+}
+
+const defaultRotationBatch = 500
+
+func (k *KeyRotation) Run(ctx context.Context, opts RotationOptions, progress func(RotationProgress)) (domain.KeyRotationJob, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRotationBatch
+	}
+	if progress == nil {
+		progress = func(RotationProgress) {}
+	}
+
+	job, resumed, err := k.start(ctx, opts)
+	if err != nil {
+		return domain.KeyRotationJob{}, err
+	}
+	progress(RotationProgress{JobID: job.ID, Phase: job.Phase, Processed: job.Processed, Resumed: resumed})
+
+	for job.Phase != domain.RotationPhaseDone {
+		if err = ctx.Err(); err != nil {
+			return job, err
+		}
+		var done bool
+		switch job.Phase {
+		case domain.RotationPhaseRewrap:
+			done, err = k.rewrapBatch(ctx, &job, opts.BatchSize)
+		case domain.RotationPhaseMFASecrets:
+			done, err = k.mfaSecretsBatch(ctx, &job, opts.BatchSize)
+		case domain.RotationPhaseDataKeys:
+			done, err = k.dataKeysBatch(ctx, &job, opts.BatchSize)
+		case domain.RotationPhaseNotes:
+			done, err = k.notesBatch(ctx, &job, opts.BatchSize)
+		case domain.RotationPhaseRevisions:
+			done, err = k.revisionsBatch(ctx, &job, opts.BatchSize)
+		}
+		if err != nil {
+			return job, err
+		}
+		if done {
+			k.advance(&job)
+		}
+		job.UpdatedAt = time.Now()
+		if err = k.jobs.Save(ctx, job); err != nil {
+			return job, err
+		}
+		total, _ := k.total(ctx, job)
+		progress(RotationProgress{JobID: job.ID, Phase: job.Phase, Processed: job.Processed, Total: total})
+	}
+	return job, nil
+}
+
+// start resumes the latest unfinished job, or creates a new one targeting the
+// provider's current master key. Options the resumed job lacks would be
+// dropped without notice, so they are refused instead.
+func (k *KeyRotation) start(ctx context.Context, opts RotationOptions) (domain.KeyRotationJob, bool, error) {
+	if !opts.Restart {
+		job, err := k.jobs.Unfinished(ctx)
+		if err == nil {
+			if opts.NewMasterKey || opts.NewDataKeys && !job.NewDataKeys || opts.ReencryptNotes && !job.ReencryptNotes {
+				return domain.KeyRotationJob{}, false, fmt.Errorf("%w (job %d)", ErrRotationInProgress, job.ID)
+			}
+			return job, true, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.KeyRotationJob{}, false, err
+		}
+	}
+
+	if opts.NewMasterKey {
+		rotator, ok := k.keys.(security.KeyRotator)
+		if !ok {
+			return domain.KeyRotationJob{}, false, security.ErrRotateUnsupported
+		}
+		if _, err := rotator.Rotate(ctx); err != nil {
+			return domain.KeyRotationJob{}, false, err
+		}
+	}
+	current, err := k.keys.CurrentKeyID(ctx)
+	if err != nil {
+		return domain.KeyRotationJob{}, false, err
+	}
+
+	now := time.Now()
+	job, err := k.jobs.Create(ctx, domain.KeyRotationJob{
+		MasterKeyID:    current,
+		NewDataKeys:    opts.NewDataKeys,
+		ReencryptNotes: opts.ReencryptNotes,
+		Phase:          domain.RotationPhaseRewrap,
+		StartedAt:      now,
+		UpdatedAt:      now,
+	})
+	return job, false, err
+}
+
+func (k *KeyRotation) advance(job *domain.KeyRotationJob) {
+	job.Cursor, job.Processed = 0, 0
+	switch {
+	case job.Phase == domain.RotationPhaseRewrap:
+		job.Phase = domain.RotationPhaseMFASecrets
+	case job.Phase == domain.RotationPhaseMFASecrets && job.NewDataKeys:
+		job.Phase = domain.RotationPhaseDataKeys
+	case job.Phase == domain.RotationPhaseNotes:
+		job.Phase = domain.RotationPhaseRevisions
+	case job.Phase != domain.RotationPhaseRevisions && job.ReencryptNotes:
+		job.Phase = domain.RotationPhaseNotes
+	default:
+		now := time.Now()
+		job.Phase = domain.RotationPhaseDone
+		job.FinishedAt = &now
+	}
+}
+
+func (k *KeyRotation) total(ctx context.Context, job domain.KeyRotationJob) (int64, error) {
+	switch job.Phase {
+	case domain.RotationPhaseRewrap:
+		stale, err := k.dataKeys.CountNotWrappedBy(ctx, job.MasterKeyID)
+		return stale + job.Processed, err
+	case domain.RotationPhaseMFASecrets:
+		stale, err := k.mfa.CountNotWrappedBy(ctx, job.MasterKeyID)
+		return stale + job.Processed, err
+	case domain.RotationPhaseNotes:
+		return k.notes.CountAll(ctx)
+	case domain.RotationPhaseRevisions:
+		return k.notes.CountRevisions(ctx)
+	}
+	return 0, nil
+}
+
+func (k *KeyRotation) rewrapBatch(ctx context.Context, job *domain.KeyRotationJob, limit int) (bool, error) {
+	keys, err := k.dataKeys.ListAfter(ctx, job.Cursor, limit)
+	if err != nil {
+		return false, err
+	}
+	for _, dk := range keys {
+		if dk.MasterKeyID != job.MasterKeyID {
+			plain, err := k.keys.Unwrap(ctx, dk.MasterKeyID, dk.WrappedKey)
+			if err != nil {
+				return false, err
+			}
+			if dk.MasterKeyID, dk.WrappedKey, err = k.keys.Wrap(ctx, plain); err != nil {
+				return false, err
+			}
+			if err = k.dataKeys.Rewrap(ctx, dk); err != nil {
+				return false, err
+			}
+			job.Processed++
+		}
+		job.Cursor = dk.ID
+	}
+	return len(keys) < limit, nil
+}
+
+func (k *KeyRotation) mfaSecretsBatch(ctx context.Context, job *domain.KeyRotationJob, limit int) (bool, error) {
+	rows, err := k.mfa.ListAfter(ctx, job.Cursor, limit)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range rows {
+		if m.SecretKeyID != job.MasterKeyID {
+			plain, err := k.keys.Unwrap(ctx, m.SecretKeyID, m.SecretWrapped)
+			if err != nil {
+				return false, err
+			}
+			rewrapped := m
+			if rewrapped.SecretKeyID, rewrapped.SecretWrapped, err = k.keys.Wrap(ctx, plain); err != nil {
+				return false, err
+			}
+			if err = ignoreGone(k.mfa.Rewrap(ctx, rewrapped, m.SecretWrapped)); err != nil {
+				return false, err
+			}
+			job.Processed++
+		}
+		job.Cursor = m.UserID
+	}
+	return len(rows) < limit, nil
+}
+
+func (k *KeyRotation) dataKeysBatch(ctx context.Context, job *domain.KeyRotationJob, limit int) (bool, error) {
+	uids, err := k.dataKeys.UserIDsAfter(ctx, job.Cursor, limit)
+	if err != nil {
+		return false, err
+	}
+	for _, uid := range uids {
+		dek, err := security.NewDataKey()
+		if err != nil {
+			return false, err
+		}
+		masterID, wrapped, err := k.keys.Wrap(ctx, dek)
+		if err != nil {
+			return false, err
+		}
+		if _, err = k.dataKeys.Create(ctx, domain.DataKey{UserID: uid, MasterKeyID: masterID, WrappedKey: wrapped}); err != nil {
+			return false, err
+		}
+		job.Cursor = uid
+		job.Processed++
+	}
+	return len(uids) < limit, nil
+}
+
+func (k *KeyRotation) notesBatch(ctx context.Context, job *domain.KeyRotationJob, limit int) (bool, error) {
+	notes, err := k.notes.ScanAll(ctx, job.Cursor, limit)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range notes {
+		if err = k.resealNote(ctx, n); err != nil {
+			return false, err
+		}
+		job.Cursor = n.ID
+		job.Processed++
+	}
+	return len(notes) < limit, nil
+}
+
+func (k *KeyRotation) revisionsBatch(ctx context.Context, job *domain.KeyRotationJob, limit int) (bool, error) {
+	revs, err := k.notes.ScanRevisions(ctx, job.Cursor, limit)
+	if err != nil {
+		return false, err
+	}
+	for _, rev := range revs {
+		if err = k.resealRevision(ctx, rev); err != nil {
+			return false, err
+		}
+		job.Cursor = rev.ID
+		job.Processed++
+	}
+	return len(revs) < limit, nil
+}
+
+// maxResealAttempts bounds how often a row that keeps changing under the
+// rotation is re-read. The batch fails after that and is retried on resume.
+const maxResealAttempts = 3
+
+// resealNote rewrites a note under its owner's current data key. When the
+// user edited it since it was scanned, the stored row is re-read and resealed
+// rather than overwritten. Notes deleted in the meantime are skipped.
+func (k *KeyRotation) resealNote(ctx context.Context, n domain.Note) error {
+	for attempt := 1; ; attempt++ {
+		resealed, changed, err := k.resealer.Reseal(ctx, n)
+		if err != nil || !changed {
+			return err
+		}
+		err = k.notes.Rewrite(ctx, resealed)
+		if !errors.Is(err, domain.ErrVersionConflict) || attempt == maxResealAttempts {
+			return ignoreGone(err)
+		}
+		if n, err = k.notes.Load(ctx, n.ID); err != nil {
+			return ignoreGone(err)
+		}
+	}
+}
+
+// resealRevision is resealNote for a revision row.
+func (k *KeyRotation) resealRevision(ctx context.Context, rev domain.NoteRevision) error {
+	for attempt := 1; ; attempt++ {
+		resealed, changed, err := k.resealer.ResealRevision(ctx, rev)
+		if err != nil || !changed {
+			return err
+		}
+		err = k.notes.RewriteRevision(ctx, resealed, rev.KeyID)
+		if !errors.Is(err, domain.ErrVersionConflict) || attempt == maxResealAttempts {
+			return ignoreGone(err)
+		}
+		if rev, err = k.notes.LoadRevision(ctx, rev.ID); err != nil {
+			return ignoreGone(err)
+		}
+	}
+}
+
+func ignoreGone(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
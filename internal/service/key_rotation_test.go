@@ -0,0 +1,378 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+	"gorm.io/gorm"
+)
+
+type memDataKeyRepo struct {
+	keys      []domain.DataKey
+	failAfter int // Rewrap fails once this many rewraps succeeded; 0 disables
+	rewraps   int
+}
+
+func (m *memDataKeyRepo) Create(ctx context.Context, key domain.DataKey) (domain.DataKey, error) {
+	key.ID = int64(len(m.keys) + 1)
+	m.keys = append(m.keys, key)
+	return key, nil
+}
+
+func (m *memDataKeyRepo) GetByID(ctx context.Context, keyID, uid int64) (domain.DataKey, error) {
+	panic("not used")
+}
+
+func (m *memDataKeyRepo) Current(ctx context.Context, uid int64) (domain.DataKey, error) {
+	panic("not used")
+}
+
+func (m *memDataKeyRepo) ListAfter(ctx context.Context, afterID int64, limit int) ([]domain.DataKey, error) {
+	var out []domain.DataKey
+	for _, k := range m.keys {
+		if k.ID > afterID && len(out) < limit {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (m *memDataKeyRepo) CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error) {
+	var n int64
+	for _, k := range m.keys {
+		if k.MasterKeyID != masterKeyID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memDataKeyRepo) UserIDsAfter(ctx context.Context, afterUID int64, limit int) ([]int64, error) {
+	seen := map[int64]bool{}
+	var out []int64
+	for _, k := range m.keys {
+		if k.UserID > afterUID && !seen[k.UserID] && len(out) < limit {
+			seen[k.UserID] = true
+			out = append(out, k.UserID)
+		}
+	}
+	return out, nil
+}
+
+func (m *memDataKeyRepo) Rewrap(ctx context.Context, key domain.DataKey) error {
+	if m.failAfter > 0 && m.rewraps == m.failAfter {
+		return errors.New("connection reset")
+	}
+	m.rewraps++
+	m.keys[key.ID-1] = key
+	return nil
+}
+
+type memRotationJobs struct {
+	jobs []domain.KeyRotationJob
+}
+
+func (m *memRotationJobs) Create(ctx context.Context, job domain.KeyRotationJob) (domain.KeyRotationJob, error) {
+	job.ID = int64(len(m.jobs) + 1)
+	m.jobs = append(m.jobs, job)
+	return job, nil
+}
+
+func (m *memRotationJobs) Unfinished(ctx context.Context) (domain.KeyRotationJob, error) {
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		if m.jobs[i].FinishedAt == nil {
+			return m.jobs[i], nil
+		}
+	}
+	return domain.KeyRotationJob{}, gorm.ErrRecordNotFound
+}
+
+func (m *memRotationJobs) Save(ctx context.Context, job domain.KeyRotationJob) error {
+	m.jobs[job.ID-1] = job
+	return nil
+}
+
+type memNoteStore struct {
+	rows               []domain.Note
+	revisions          []domain.NoteRevision
+	rewritten          []int64
+	rewrittenRevisions []int64
+	purgeCalls         int
+}
+
+func (m *memNoteStore) ScanAll(ctx context.Context, afterID int64, limit int) ([]domain.Note, error) {
+	var out []domain.Note
+	for _, n := range m.rows {
+		if n.ID > afterID && len(out) < limit {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (m *memNoteStore) CountAll(ctx context.Context) (int64, error) {
+	return int64(len(m.rows)), nil
+}
+
+func (m *memNoteStore) Load(ctx context.Context, noteID int64) (domain.Note, error) {
+	for _, n := range m.rows {
+		if n.ID == noteID {
+			return n, nil
+		}
+	}
+	return domain.Note{}, gorm.ErrRecordNotFound
+}
+
+func (m *memNoteStore) Rewrite(ctx context.Context, note domain.Note) error {
+	for i, n := range m.rows {
+		if n.ID == note.ID {
+			if n.Version != note.Version {
+				return domain.ErrVersionConflict
+			}
+			m.rows[i] = note
+			m.rewritten = append(m.rewritten, note.ID)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memNoteStore) PurgeDeletedBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	var kept []domain.Note
+	var purged int64
+	for _, n := range m.rows {
+		if n.DeletedAt != nil && n.DeletedAt.Before(cutoff) && purged < int64(limit) {
+			purged++
+			continue
+		}
+		kept = append(kept, n)
+	}
+	m.rows = kept
+	m.purgeCalls++
+	return purged, nil
+}
+
+func (m *memNoteStore) ScanRevisions(ctx context.Context, afterID int64, limit int) ([]domain.NoteRevision, error) {
+	var out []domain.NoteRevision
+	for _, r := range m.revisions {
+		if r.ID > afterID && len(out) < limit {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memNoteStore) CountRevisions(ctx context.Context) (int64, error) {
+	return int64(len(m.revisions)), nil
+}
+
+func (m *memNoteStore) LoadRevision(ctx context.Context, revisionID int64) (domain.NoteRevision, error) {
+	for _, r := range m.revisions {
+		if r.ID == revisionID {
+			return r, nil
+		}
+	}
+	return domain.NoteRevision{}, gorm.ErrRecordNotFound
+}
+
+func (m *memNoteStore) RewriteRevision(ctx context.Context, rev domain.NoteRevision, fromKeyID *int64) error {
+	m.rewrittenRevisions = append(m.rewrittenRevisions, rev.ID)
+	return nil
+}
+
+// oddResealer pretends every odd note and revision ID is on a stale key.
+type oddResealer struct{}
+
+func (oddResealer) Reseal(ctx context.Context, stored domain.Note) (domain.Note, bool, error) {
+	return stored, stored.ID%2 == 1, nil
+}
+
+func (oddResealer) ResealRevision(ctx context.Context, stored domain.NoteRevision) (domain.NoteRevision, bool, error) {
+	return stored, stored.ID%2 == 1, nil
+}
+
+// editingResealer stands in for a user editing note 1 while the rotation is
+// resealing it: the first reseal bumps the stored version under it.
+type editingResealer struct {
+	oddResealer
+	store  *memNoteStore
+	edited bool
+}
+
+func (r *editingResealer) Reseal(ctx context.Context, stored domain.Note) (domain.Note, bool, error) {
+	if stored.ID == 1 && !r.edited {
+		r.edited = true
+		r.store.rows[0].Title, r.store.rows[0].Version = "edited", stored.Version+1
+	}
+	return r.oddResealer.Reseal(ctx, stored)
+}
+
+func testKeyring(t *testing.T, current string) *security.Keyring {
+	t.Helper()
+	ring, err := security.NewKeyring(current, map[string][]byte{
+		"v1": bytes.Repeat([]byte{1}, security.DataKeySize),
+		"v2": bytes.Repeat([]byte{2}, security.DataKeySize),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func seedDataKeys(t *testing.T, repo *memDataKeyRepo, n int) {
+	t.Helper()
+	v1 := testKeyring(t, "v1")
+	for i := 0; i < n; i++ {
+		id, wrapped, err := v1.Wrap(context.Background(), bytes.Repeat([]byte{byte(i)}, security.DataKeySize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = repo.Create(context.Background(), domain.DataKey{UserID: int64(i + 1), MasterKeyID: id, WrappedKey: wrapped})
+	}
+}
+
+func TestKeyRotation_RewrapsAndReencrypts(t *testing.T) {
+	ctx := context.Background()
+	ring := testKeyring(t, "v2")
+	dataKeys := &memDataKeyRepo{}
+	seedDataKeys(t, dataKeys, 5)
+	notes := &memNoteStore{
+		rows:      []domain.Note{{ID: 1}, {ID: 2}, {ID: 3}},
+		revisions: []domain.NoteRevision{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}},
+	}
+	mfa := newFakeMFARepo()
+	secretKeyID, secretWrapped, err := testKeyring(t, "v1").Wrap(ctx, []byte("JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa.rows[2] = domain.UserMFA{UserID: 2, SecretKeyID: secretKeyID, SecretWrapped: secretWrapped}
+	jobs := &memRotationJobs{}
+	svc := service.NewKeyRotation(ring, dataKeys, mfa, notes, oddResealer{}, jobs)
+
+	var phases []string
+	job, err := svc.Run(ctx, service.RotationOptions{ReencryptNotes: true, BatchSize: 2}, func(p service.RotationProgress) {
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Phase != domain.RotationPhaseDone || job.FinishedAt == nil {
+		t.Fatalf("job not finished: %+v", job)
+	}
+	want := []string{domain.RotationPhaseRewrap, domain.RotationPhaseMFASecrets, domain.RotationPhaseNotes, domain.RotationPhaseRevisions, domain.RotationPhaseDone}
+	if len(phases) != len(want) {
+		t.Fatalf("phases = %v, want %v", phases, want)
+	}
+	for i, k := range dataKeys.keys {
+		if k.MasterKeyID != "v2" {
+			t.Fatalf("key %d still wrapped by %s", i+1, k.MasterKeyID)
+		}
+		dek, err := ring.Unwrap(ctx, k.MasterKeyID, k.WrappedKey)
+		if err != nil || !bytes.Equal(dek, bytes.Repeat([]byte{byte(i)}, security.DataKeySize)) {
+			t.Fatalf("key %d changed during rewrap: %v", i+1, err)
+		}
+	}
+	m := mfa.rows[2]
+	if secret, err := ring.Unwrap(ctx, m.SecretKeyID, m.SecretWrapped); m.SecretKeyID != "v2" || err != nil || string(secret) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("TOTP secret not rewrapped: key %s, %v", m.SecretKeyID, err)
+	}
+	if len(notes.rewritten) != 2 || notes.rewritten[0] != 1 || notes.rewritten[1] != 3 {
+		t.Fatalf("unexpected rewritten notes: %v", notes.rewritten)
+	}
+	if got := notes.rewrittenRevisions; len(got) != 3 || got[0] != 1 || got[1] != 3 || got[2] != 5 {
+		t.Fatalf("unexpected rewritten revisions: %v", got)
+	}
+}
+
+func TestKeyRotation_ResealsConcurrentEdits(t *testing.T) {
+	notes := &memNoteStore{rows: []domain.Note{{ID: 1, Title: "old", Version: 1}, {ID: 3, Title: "other", Version: 1}}}
+	resealer := &editingResealer{store: notes}
+	svc := service.NewKeyRotation(testKeyring(t, "v1"), &memDataKeyRepo{}, newFakeMFARepo(), notes, resealer, &memRotationJobs{})
+
+	if _, err := svc.Run(context.Background(), service.RotationOptions{ReencryptNotes: true}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := notes.rows[0]; got.Title != "edited" || got.Version != 2 {
+		t.Fatalf("the concurrent edit was overwritten: %+v", got)
+	}
+	if len(notes.rewritten) != 2 || notes.rewritten[0] != 1 {
+		t.Fatalf("unexpected rewritten notes: %v", notes.rewritten)
+	}
+}
+
+func TestKeyRotation_ResumesAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	dataKeys := &memDataKeyRepo{failAfter: 3}
+	seedDataKeys(t, dataKeys, 5)
+	jobs := &memRotationJobs{}
+	svc := service.NewKeyRotation(testKeyring(t, "v2"), dataKeys, newFakeMFARepo(), &memNoteStore{}, oddResealer{}, jobs)
+
+	if _, err := svc.Run(ctx, service.RotationOptions{BatchSize: 2}, nil); err == nil {
+		t.Fatalf("expected the injected failure")
+	}
+	checkpoint := jobs.jobs[0]
+	if checkpoint.FinishedAt != nil || checkpoint.Cursor != 2 {
+		t.Fatalf("expected checkpoint after the first batch, got %+v", checkpoint)
+	}
+
+	dataKeys.failAfter = 0
+	var resumed bool
+	job, err := svc.Run(ctx, service.RotationOptions{BatchSize: 2}, func(p service.RotationProgress) {
+		resumed = resumed || p.Resumed
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resumed || job.ID != checkpoint.ID || len(jobs.jobs) != 1 {
+		t.Fatalf("expected job %d to resume, got %+v (jobs=%d)", checkpoint.ID, job, len(jobs.jobs))
+	}
+	if n, _ := dataKeys.CountNotWrappedBy(ctx, "v2"); n != 0 {
+		t.Fatalf("%d keys left on the old master key", n)
+	}
+}
+
+func TestKeyRotation_ResumeRefusesNewOptions(t *testing.T) {
+	ctx := context.Background()
+	dataKeys := &memDataKeyRepo{failAfter: 3}
+	seedDataKeys(t, dataKeys, 5)
+	jobs := &memRotationJobs{}
+	svc := service.NewKeyRotation(testKeyring(t, "v2"), dataKeys, newFakeMFARepo(), &memNoteStore{}, oddResealer{}, jobs)
+
+	if _, err := svc.Run(ctx, service.RotationOptions{BatchSize: 2}, nil); err == nil {
+		t.Fatalf("expected the injected failure")
+	}
+	dataKeys.failAfter = 0
+	for _, opts := range []service.RotationOptions{
+		{NewMasterKey: true},
+		{NewDataKeys: true},
+		{ReencryptNotes: true},
+	} {
+		if _, err := svc.Run(ctx, opts, nil); !errors.Is(err, service.ErrRotationInProgress) {
+			t.Fatalf("%+v: expected ErrRotationInProgress, got: %v", opts, err)
+		}
+	}
+	if len(jobs.jobs) != 1 || jobs.jobs[0].FinishedAt != nil {
+		t.Fatalf("refused runs must not touch the job: %+v", jobs.jobs)
+	}
+	job, err := svc.Run(ctx, service.RotationOptions{NewDataKeys: true, Restart: true, BatchSize: 2}, nil)
+	if err != nil || !job.NewDataKeys || len(jobs.jobs) != 2 {
+		t.Fatalf("restart: job=%+v err=%v", job, err)
+	}
+}
+
+func TestKeyRotation_NewKeyRequiresRotator(t *testing.T) {
+	svc := service.NewKeyRotation(testKeyring(t, "v1"), &memDataKeyRepo{}, newFakeMFARepo(), &memNoteStore{}, oddResealer{}, &memRotationJobs{})
+
+	_, err := svc.Run(context.Background(), service.RotationOptions{NewMasterKey: true}, nil)
+	if !errors.Is(err, security.ErrRotateUnsupported) {
+		t.Fatalf("expected ErrRotateUnsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+var ErrLoginLocked = errors.New("too many failed login attempts")
+
+// LoginLockedError reports how long the caller must wait before trying again.
+// It matches ErrLoginLocked with errors.Is.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string { return ErrLoginLocked.Error() }
+func (e *LoginLockedError) Unwrap() error { return ErrLoginLocked }
+
+// ThrottleRule turns a failure count into a block. The first FreeAttempts
+// failures cost nothing; each further failure blocks for BaseDelay doubled
+// per failure, capped at MaxDelay, and LockoutAfter failures lock the key out
+// for LockoutFor.
+type ThrottleRule struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	LockoutFor   time.Duration
+	Window       time.Duration // failures older than this are forgotten
+}
+
+// LoginThrottlePolicy has separate rules per account and per client IP; an IP
+// sees many accounts, so it gets a larger allowance. ResetAccount and ResetIP
+// limit password reset requests, which count whether or not they succeed
+// because each one may send an email. OIDCIP limits single sign-on starts
+// per client IP, each of which stores a pending request.
+type LoginThrottlePolicy struct {
+	Account      ThrottleRule
+	IP           ThrottleRule
+	ResetAccount ThrottleRule
+	ResetIP      ThrottleRule
+	OIDCIP       ThrottleRule
+}
+
+func DefaultLoginThrottlePolicy() LoginThrottlePolicy {
+	return LoginThrottlePolicy{
+		Account: ThrottleRule{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			LockoutAfter: 10,
+			LockoutFor:   15 * time.Minute,
+			Window:       time.Hour,
+		},
+		IP: ThrottleRule{
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			LockoutAfter: 100,
+			LockoutFor:   time.Hour,
+			Window:       time.Hour,
+		},
+		ResetAccount: ThrottleRule{
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       24 * time.Hour,
+		},
+		ResetIP: ThrottleRule{
+			FreeAttempts: 20,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		},
+		OIDCIP: ThrottleRule{
+			FreeAttempts: 30,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			Window:       10 * time.Minute,
+		},
+	}
+}
+
+func (r ThrottleRule) blockFor(failures int) time.Duration {
+	if r.LockoutAfter > 0 && failures >= r.LockoutAfter {
+		return r.LockoutFor
+	}
+	if failures <= r.FreeAttempts {
+		return 0
+	}
+	shift := failures - r.FreeAttempts - 1
+	if shift > 30 {
+		return r.MaxDelay
+	}
+	d := r.BaseDelay << shift
+	if d > r.MaxDelay {
+		return r.MaxDelay
+	}
+	return d
+}
+
+// WithLoginThrottle slows down and then locks out repeated failed logins per
+// account and per client IP. The lock is checked before any password hashing,
+// so a locked key costs no Argon2 work.
+func WithLoginThrottle(store domain.LoginAttemptStore, policy LoginThrottlePolicy) AuthOption {
+	return func(u *UserAuth) {
+		u.attempts = store
+		u.throttle = policy
+	}
+}
+
+type clientIPKey struct{}
+
+// WithClientIP records the caller's address for per-IP login throttling.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+type throttleKey struct {
+	key  string
+	rule ThrottleRule
+}
+
+// loginKeys returns the account key first, then the IP key when known.
+func (u *UserAuth) loginKeys(ctx context.Context, email string) []throttleKey {
+	keys := []throttleKey{{key: "acct:" + strings.ToLower(strings.TrimSpace(email)), rule: u.throttle.Account}}
+	if ip := clientIP(ctx); ip != "" {
+		keys = append(keys, throttleKey{key: "ip:" + ip, rule: u.throttle.IP})
+	}
+	return keys
+}
+
+// resetKeys is loginKeys for password reset requests.
+func (u *UserAuth) resetKeys(ctx context.Context, email string) []throttleKey {
+	keys := []throttleKey{{key: "reset:" + strings.ToLower(strings.TrimSpace(email)), rule: u.throttle.ResetAccount}}
+	if ip := clientIP(ctx); ip != "" {
+		keys = append(keys, throttleKey{key: "reset-ip:" + ip, rule: u.throttle.ResetIP})
+	}
+	return keys
+}
+
+// oidcStartKeys is loginKeys for starting single sign-on, which names no
+// account yet.
+func (u *UserAuth) oidcStartKeys(ctx context.Context) []throttleKey {
+	if ip := clientIP(ctx); ip != "" {
+		return []throttleKey{{key: "oidc-ip:" + ip, rule: u.throttle.OIDCIP}}
+	}
+	return nil
+}
+
+func (u *UserAuth) mfaThrottleKeys(uid int64) []throttleKey {
+	return []throttleKey{{key: "mfa:" + strconv.FormatInt(uid, 10), rule: u.throttle.Account}}
+}
+
+// checkThrottle fails with a LoginLockedError while any key is blocked.
+func (u *UserAuth) checkThrottle(ctx context.Context, keys []throttleKey) error {
+	if u.attempts == nil {
+		return nil
+	}
+	now := time.Now()
+	var wait time.Duration
+	for _, k := range keys {
+		a, err := u.attempts.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if a.BlockedUntil != nil && a.BlockedUntil.After(now) {
+			wait = max(wait, a.BlockedUntil.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return &LoginLockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (u *UserAuth) recordFailure(ctx context.Context, keys []throttleKey) error {
+	if u.attempts == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, k := range keys {
+		a, err := u.attempts.Fail(ctx, k.key, now, k.rule.Window)
+		if err != nil {
+			return err
+		}
+		if d := k.rule.blockFor(a.Failures); d > 0 {
+			if err = u.attempts.Block(ctx, k.key, now.Add(d)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resetThrottle clears the account counter after a successful login. IP
+// counters are left to decay so one valid account cannot launder an IP.
+func (u *UserAuth) resetThrottle(ctx context.Context, keys []throttleKey) error {
+	if u.attempts == nil {
+		return nil
+	}
+	return u.attempts.Reset(ctx, keys[0].key)
+}
@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/memory"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func testThrottlePolicy() service.LoginThrottlePolicy {
+	return service.LoginThrottlePolicy{
+		Account: service.ThrottleRule{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour,
+			LockoutAfter: 5, LockoutFor: 2 * time.Hour, Window: 24 * time.Hour},
+		IP: service.ThrottleRule{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour},
+	}
+}
+
+func failLogin(svc *service.UserAuth, ctx context.Context, email string) error {
+	_, err := svc.Login(ctx, domain.User{Email: email, PasswordHash: "wrong password, long enough"})
+	return err
+}
+
+func TestUserAuth_Throttle_BacksOffPerAccount(t *testing.T) {
+	store := memory.NewLoginAttemptStore()
+	svc, _ := newTestAuth(t, service.WithLoginThrottle(store, testThrottlePolicy()))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := failLogin(svc, ctx, "a@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected ErrInvalidCredentials, got: %v", i, err)
+		}
+	}
+	// The third failure is past the free allowance and starts a block.
+	if err := failLogin(svc, ctx, "a@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+	_, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword})
+	var locked *service.LoginLockedError
+	if !errors.As(err, &locked) || !errors.Is(err, service.ErrLoginLocked) {
+		t.Fatalf("expected LoginLockedError even with the right password, got: %v", err)
+	}
+	if locked.RetryAfter <= 0 || locked.RetryAfter > time.Minute {
+		t.Fatalf("unexpected retry after: %v", locked.RetryAfter)
+	}
+	if a, _ := store.Get(ctx, "acct:a@example.com"); a.Failures != 3 {
+		t.Fatalf("locked attempts must not be counted, got %d failures", a.Failures)
+	}
+
+	// Other accounts are unaffected.
+	if err = failLogin(svc, ctx, "b@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+}
+
+func TestUserAuth_Throttle_LocksOutAndResetsOnSuccess(t *testing.T) {
+	store := memory.NewLoginAttemptStore()
+	svc, _ := newTestAuth(t, service.WithLoginThrottle(store, testThrottlePolicy()))
+	ctx := context.Background()
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		_, _ = store.Fail(ctx, "acct:a@example.com", now, time.Hour)
+	}
+	_ = store.Block(ctx, "acct:a@example.com", now.Add(-time.Second)) // backoff elapsed
+	_ = failLogin(svc, ctx, "A@example.com ")
+
+	var locked *service.LoginLockedError
+	_, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword})
+	if !errors.As(err, &locked) || locked.RetryAfter < time.Hour {
+		t.Fatalf("expected a lockout, got: %v", err)
+	}
+
+	_ = store.Block(ctx, "acct:a@example.com", time.Now().Add(-time.Second))
+	if res := login(t, svc); res.AccessToken == "" {
+		t.Fatalf("expected tokens")
+	}
+	if a, _ := store.Get(ctx, "acct:a@example.com"); a.Failures != 0 {
+		t.Fatalf("success should reset the account counter: %+v", a)
+	}
+}
+
+func TestUserAuth_Throttle_PerIP(t *testing.T) {
+	store := memory.NewLoginAttemptStore()
+	svc, _ := newTestAuth(t, service.WithLoginThrottle(store, testThrottlePolicy()))
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+
+	// Spray one attempt per account from the same address.
+	for _, email := range []string{"x@example.com", "y@example.com", "z@example.com", "w@example.com"} {
+		_ = failLogin(svc, ctx, email)
+	}
+	if err := failLogin(svc, ctx, "v@example.com"); !errors.Is(err, service.ErrLoginLocked) {
+		t.Fatalf("expected the IP to be blocked, got: %v", err)
+	}
+	if err := failLogin(svc, context.Background(), "v@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("other clients must not be blocked, got: %v", err)
+	}
+}
+
+type unreachableUserRepo struct {
+	*fakeUserRepo
+}
+
+func (unreachableUserRepo) GetByEmail(context.Context, string) (domain.User, error) {
+	return domain.User{}, errors.New("connection refused")
+}
+
+func TestUserAuth_Throttle_IgnoresLookupErrors(t *testing.T) {
+	store := memory.NewLoginAttemptStore()
+	users := unreachableUserRepo{newFakeUserRepo()}
+	svc := service.NewUserAuth(users, security.NewJWTManager("test-secret", "secure-notes", time.Hour),
+		service.WithLoginThrottle(store, testThrottlePolicy()))
+	ctx := context.Background()
+
+	if err := failLogin(svc, ctx, "a@example.com"); err == nil || errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected the lookup error, got: %v", err)
+	}
+	if a, _ := store.Get(ctx, "acct:a@example.com"); a.Failures != 0 {
+		t.Fatalf("a failed lookup must not count as a failed attempt, got %d failures", a.Failures)
+	}
+	// Unknown accounts count like wrong passwords.
+	svc, _ = newTestAuth(t, service.WithLoginThrottle(store, testThrottlePolicy()))
+	if err := failLogin(svc, ctx, "nobody@example.com"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got: %v", err)
+	}
+	if a, _ := store.Get(ctx, "acct:nobody@example.com"); a.Failures != 1 {
+		t.Fatalf("expected one failure for an unknown account, got %d", a.Failures)
+	}
+}
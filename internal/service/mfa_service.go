@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrMFAUnavailable    = errors.New("two-factor authentication is not configured")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge  = errors.New("invalid or expired mfa challenge")
+)
+
+// TOTPEnrollment is shown to the user once so they can add the secret to an
+// authenticator app.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// WithMFA enables TOTP two-factor authentication. Secrets are wrapped with
+// keys; issuer is the name shown in authenticator apps.
+func WithMFA(repo domain.MFARepository, keys security.KeyProvider, issuer string) AuthOption {
+	return func(u *UserAuth) {
+		u.mfa = repo
+		u.mfaKeys = keys
+		u.mfaIssuer = issuer
+	}
+}
+
+// EnrollTOTP generates a new secret for uid. It is not enforced until the
+// user proves they can produce codes with ConfirmTOTP.
+func (u *UserAuth) EnrollTOTP(ctx context.Context, uid int64) (TOTPEnrollment, error) {
+	if u.mfa == nil {
+		return TOTPEnrollment{}, ErrMFAUnavailable
+	}
+	existing, err := u.mfa.Get(ctx, uid)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TOTPEnrollment{}, err
+	}
+	if err == nil && existing.EnabledAt != nil {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	user, err := u.repo.GetByID(ctx, uid)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	keyID, wrapped, err := u.mfaKeys.Wrap(ctx, []byte(secret))
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	err = u.mfa.Upsert(ctx, domain.UserMFA{
+		UserID:        uid,
+		SecretKeyID:   keyID,
+		SecretWrapped: wrapped,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    security.TOTPURI(u.mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP turns on 2FA once code matches the pending secret and returns
+// a fresh set of recovery codes. Only their hashes are stored.
+func (u *UserAuth) ConfirmTOTP(ctx context.Context, uid int64, code string) ([]string, error) {
+	if u.mfa == nil {
+		return nil, ErrMFAUnavailable
+	}
+	m, err := u.mfa.Get(ctx, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	if m.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := u.totpSecret(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := security.ValidateTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := security.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = security.HashToken(c)
+	}
+	if err = u.mfa.ReplaceRecoveryCodes(ctx, uid, hashes); err != nil {
+		return nil, err
+	}
+	if err = u.mfa.Enable(ctx, uid, step); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns 2FA off. It requires a current TOTP or recovery code so a
+// stolen access token alone cannot downgrade the account.
+func (u *UserAuth) DisableTOTP(ctx context.Context, uid int64, code string) error {
+	if u.mfa == nil {
+		return ErrMFAUnavailable
+	}
+	m, err := u.mfa.Get(ctx, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+	if m.EnabledAt == nil {
+		return u.mfa.Delete(ctx, uid) // abandon a pending enrollment
+	}
+	if err = u.throttledSecondFactor(ctx, m, code); err != nil {
+		return err
+	}
+	return u.mfa.Delete(ctx, uid)
+}
+
+// VerifyMFA completes a login that returned MFARequired, exchanging the
+// challenge token and a TOTP or recovery code for real tokens.
+func (u *UserAuth) VerifyMFA(ctx context.Context, challenge, code string) (LoginResult, error) {
+	if u.mfa == nil {
+		return LoginResult{}, ErrMFAUnavailable
+	}
+	uid, err := u.jwt.ParseChallenge(challenge)
+	if err != nil {
+		return LoginResult{}, ErrInvalidChallenge
+	}
+	m, err := u.mfa.Get(ctx, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return LoginResult{}, ErrInvalidChallenge
+		}
+		return LoginResult{}, err
+	}
+	if m.EnabledAt == nil {
+		return LoginResult{}, ErrInvalidChallenge
+	}
+	if err = u.throttledSecondFactor(ctx, m, code); err != nil {
+		return LoginResult{}, err
+	}
+	return u.startSession(ctx, uid)
+}
+
+// mfaChallenge returns a challenge result when uid has 2FA enabled.
+func (u *UserAuth) mfaChallenge(ctx context.Context, uid int64) (LoginResult, bool, error) {
+	if u.mfa == nil {
+		return LoginResult{}, false, nil
+	}
+	m, err := u.mfa.Get(ctx, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return LoginResult{}, false, nil
+		}
+		return LoginResult{}, false, err
+	}
+	if m.EnabledAt == nil {
+		return LoginResult{}, false, nil
+	}
+	token, exp, err := u.jwt.SignChallenge(uid, mfaChallengeTTL)
+	if err != nil {
+		return LoginResult{}, false, err
+	}
+	return LoginResult{MFARequired: true, ChallengeToken: token, ChallengeExpiresAt: exp}, true, nil
+}
+
+// throttledSecondFactor is verifySecondFactor behind the per-account MFA
+// throttle, so the 6-digit code space cannot be walked through.
+func (u *UserAuth) throttledSecondFactor(ctx context.Context, m domain.UserMFA, code string) error {
+	keys := u.mfaThrottleKeys(m.UserID)
+	if err := u.checkThrottle(ctx, keys); err != nil {
+		return err
+	}
+	if err := u.verifySecondFactor(ctx, m, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if ferr := u.recordFailure(ctx, keys); ferr != nil {
+				return ferr
+			}
+		}
+		return err
+	}
+	return u.resetThrottle(ctx, keys)
+}
+
+// verifySecondFactor accepts a 6-digit TOTP code (each time step once) or an
+// unused recovery code.
+func (u *UserAuth) verifySecondFactor(ctx context.Context, m domain.UserMFA, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+	if len(code) == 6 && isDigits(code) {
+		secret, err := u.totpSecret(ctx, m)
+		if err != nil {
+			return err
+		}
+		step, ok := security.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		fresh, err := u.mfa.UseStep(ctx, m.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	used, err := u.mfa.UseRecoveryCode(ctx, m.UserID, security.HashToken(security.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (u *UserAuth) totpSecret(ctx context.Context, m domain.UserMFA) (string, error) {
+	raw, err := u.mfaKeys.Unwrap(ctx, m.SecretKeyID, m.SecretWrapped)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/repository/memory"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func newMFAAuth(t *testing.T, opts ...service.AuthOption) (*service.UserAuth, *fakeMFARepo) {
+	t.Helper()
+	keys, err := security.NewKeyring("v1", map[string][]byte{"v1": make([]byte, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeMFARepo()
+	svc, _ := newTestAuth(t, append(opts, service.WithMFA(repo, keys, "secure-notes"))...)
+	return svc, repo
+}
+
+// enableTOTP enrolls user 1 and returns the secret and recovery codes.
+func enableTOTP(t *testing.T, svc *service.UserAuth, repo *fakeMFARepo) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := svc.EnrollTOTP(ctx, 1)
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+		t.Fatalf("unexpected uri: %s", enrollment.URI)
+	}
+	if strings.Contains(string(repo.rows[1].SecretWrapped), enrollment.Secret) {
+		t.Fatalf("secret stored in the clear")
+	}
+	code, _ := security.TOTPCode(enrollment.Secret, time.Now())
+	recovery, err := svc.ConfirmTOTP(ctx, 1, code)
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	return enrollment.Secret, recovery
+}
+
+func TestUserAuth_MFA_PendingEnrollmentIsNotEnforced(t *testing.T) {
+	svc, _ := newMFAAuth(t)
+	if _, err := svc.EnrollTOTP(context.Background(), 1); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if res := login(t, svc); res.MFARequired || res.AccessToken == "" {
+		t.Fatalf("unconfirmed 2FA must not block login: %+v", res)
+	}
+	if _, err := svc.ConfirmTOTP(context.Background(), 1, "abcdef"); !errors.Is(err, service.ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode, got: %v", err)
+	}
+}
+
+func TestUserAuth_MFA_LoginRequiresSecondFactor(t *testing.T) {
+	svc, repo := newMFAAuth(t)
+	ctx := context.Background()
+	secret, _ := enableTOTP(t, svc, repo)
+
+	res := login(t, svc)
+	if !res.MFARequired || res.AccessToken != "" || res.ChallengeToken == "" {
+		t.Fatalf("expected a challenge only, got %+v", res)
+	}
+	if _, err := svc.Authenticate(ctx, res.ChallengeToken); err == nil {
+		t.Fatalf("challenge token must not authenticate")
+	}
+
+	// The step used to confirm enrollment cannot be replayed; use the next one.
+	code, _ := security.TOTPCode(secret, time.Now().Add(30*time.Second))
+	tokens, err := svc.VerifyMFA(ctx, res.ChallengeToken, code)
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("verify: %+v %v", tokens, err)
+	}
+	if _, err = svc.VerifyMFA(ctx, res.ChallengeToken, code); !errors.Is(err, service.ErrInvalidMFACode) {
+		t.Fatalf("replayed code must fail, got: %v", err)
+	}
+	if _, err = svc.VerifyMFA(ctx, "bogus", code); !errors.Is(err, service.ErrInvalidChallenge) {
+		t.Fatalf("expected ErrInvalidChallenge, got: %v", err)
+	}
+}
+
+func TestUserAuth_MFA_RecoveryCodesAreSingleUse(t *testing.T) {
+	svc, repo := newMFAAuth(t)
+	ctx := context.Background()
+	_, recovery := enableTOTP(t, svc, repo)
+	if len(recovery) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %d", len(recovery))
+	}
+
+	res := login(t, svc)
+	if _, err := svc.VerifyMFA(ctx, res.ChallengeToken, strings.ToUpper(recovery[0])); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if _, err := svc.VerifyMFA(ctx, res.ChallengeToken, recovery[0]); !errors.Is(err, service.ErrInvalidMFACode) {
+		t.Fatalf("used recovery code must fail, got: %v", err)
+	}
+}
+
+func TestUserAuth_MFA_DisableRequiresCode(t *testing.T) {
+	svc, repo := newMFAAuth(t)
+	ctx := context.Background()
+	_, recovery := enableTOTP(t, svc, repo)
+
+	if err := svc.DisableTOTP(ctx, 1, "not-a-code"); !errors.Is(err, service.ErrInvalidMFACode) {
+		t.Fatalf("expected ErrInvalidMFACode, got: %v", err)
+	}
+	if err := svc.DisableTOTP(ctx, 1, recovery[1]); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if res := login(t, svc); res.MFARequired {
+		t.Fatalf("2FA should be off")
+	}
+	if _, err := svc.EnrollTOTP(ctx, 1); err != nil {
+		t.Fatalf("re-enroll: %v", err)
+	}
+}
+
+func TestUserAuth_MFA_DisableIsThrottled(t *testing.T) {
+	svc, repo := newMFAAuth(t, service.WithLoginThrottle(memory.NewLoginAttemptStore(), testThrottlePolicy()))
+	ctx := context.Background()
+	_, recovery := enableTOTP(t, svc, repo)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.DisableTOTP(ctx, 1, "000000"); !errors.Is(err, service.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: expected ErrInvalidMFACode, got: %v", i, err)
+		}
+	}
+	if err := svc.DisableTOTP(ctx, 1, recovery[0]); !errors.Is(err, service.ErrLoginLocked) {
+		t.Fatalf("expected ErrLoginLocked even with a valid code, got: %v", err)
+	}
+	if res := login(t, svc); !res.MFARequired {
+		t.Fatalf("2FA must stay on while locked")
+	}
+}
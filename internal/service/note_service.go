@@ -2,59 +2,234 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"log"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/textdiff"
 )
 
 type NoteService struct {
-	repo domain.NoteRepository
+	repo            domain.NoteRepository
+	users           domain.UserRepository
+	requireVerified bool
+	revisionLimit   int // 0 keeps every revision
 }
 
 var (
-	ErrInvalidTitle   = errors.New("title is required")
-	ErrInvalidContent = errors.New("content is required")
+	ErrInvalidTitle            = errors.New("title is required")
+	ErrInvalidContent          = errors.New("content is required")
+	ErrInvalidCiphertext       = errors.New("ciphertext must be non-empty base64")
+	ErrUnsupportedAlgorithm    = errors.New("unsupported encryption algorithm")
+	ErrInvalidNonce            = errors.New("nonce does not match the algorithm")
+	ErrInvalidKDFSalt          = errors.New("kdf salt must be base64 when a kdf is set")
+	ErrPlaintextWithCiphertext = errors.New("title and content must be empty for client-encrypted notes")
+	ErrPlaintextNotAllowed     = errors.New("plaintext is not allowed")
+	ErrEmailNotVerified        = errors.New("verify your email address before creating notes")
+	ErrInvalidTag              = errors.New("tags must be 1-50 characters without commas or control characters")
+	ErrTooManyTags             = errors.New("a note can have at most 20 tags")
+	ErrRevisionNotDiffable     = errors.New("client-encrypted revisions cannot be compared on the server")
+
+	errZeroKnowledgeAccount = fmt.Errorf("%w: account only accepts client-encrypted notes", ErrPlaintextNotAllowed)
+	errTagsOnEncryptedNote  = fmt.Errorf("%w: tags are stored unencrypted and cannot be set on client-encrypted notes", ErrPlaintextNotAllowed)
+)
+
+const (
+	maxTagLength   = 50
+	maxTagsPerNote = 20
 )
 
-func NewNoteService(repo domain.NoteRepository) *NoteService {
-	return &NoteService{repo: repo}
+// nonceSizes lists the accepted client algorithms and their nonce length.
+var nonceSizes = map[string]int{
+	domain.AlgAES256GCM:         12,
+	domain.AlgXChaCha20Poly1305: 24,
+}
+
+type NoteOption func(*NoteService)
+
+// WithUserRepository enables per-account policies such as zero-knowledge mode.
+func WithUserRepository(users domain.UserRepository) NoteOption {
+	return func(s *NoteService) {
+		s.users = users
+	}
+}
+
+// WithVerifiedEmailRequired blocks note creation until the account's email
+// address is verified. It needs WithUserRepository.
+func WithVerifiedEmailRequired() NoteOption {
+	return func(s *NoteService) {
+		s.requireVerified = true
+	}
+}
+
+// WithRevisionLimit keeps only the newest n revisions of each note.
+func WithRevisionLimit(n int) NoteOption {
+	return func(s *NoteService) {
+		s.revisionLimit = n
+	}
+}
+
+func NewNoteService(repo domain.NoteRepository, opts ...NoteOption) *NoteService {
+	s := &NoteService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 func (s *NoteService) CreateNote(ctx context.Context, n domain.Note) (domain.Note, error) {
-	if strings.TrimSpace(n.Title) == "" {
-		return domain.Note{}, ErrInvalidTitle
+	if s.requireVerified && s.users != nil {
+		user, err := s.users.GetByID(ctx, n.UserID)
+		if err != nil {
+			return domain.Note{}, err
+		}
+		if user.EmailVerifiedAt == nil {
+			return domain.Note{}, ErrEmailNotVerified
+		}
 	}
-	if strings.TrimSpace(n.Content) == "" {
-		return domain.Note{}, ErrInvalidContent
+	var err error
+	if n.Tags, err = normalizeTags(n.Tags); err != nil {
+		return domain.Note{}, err
+	}
+	if err = s.validate(ctx, n); err != nil {
+		return domain.Note{}, err
 	}
 	return s.repo.Create(ctx, n)
 }
-func (s *NoteService) UpdateByID(ctx context.Context, n domain.Note) error {
-	if strings.TrimSpace(n.Title) == "" {
-		return ErrInvalidTitle
+
+// UpdateByID replaces the note's title and content, and its tags unless
+// n.Tags is nil, and returns the note's new version. A non-zero n.Version
+// must match the stored note's, or domain.ErrVersionConflict is returned.
+func (s *NoteService) UpdateByID(ctx context.Context, n domain.Note) (int64, error) {
+	var err error
+	if n.Tags, err = normalizeTags(n.Tags); err != nil {
+		return 0, err
 	}
-	if strings.TrimSpace(n.Content) == "" {
-		return ErrInvalidContent
+	if n.ClientEncryption != nil && n.Tags == nil {
+		// Drop tags left from when the note was plaintext.
+		n.Tags = []string{}
+	}
+	if err = s.validate(ctx, n); err != nil {
+		return 0, err
 	}
-	if err := s.repo.Update(ctx, n); err != nil {
+	version, err := s.repo.Update(ctx, n)
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return domain.ErrNoteNotFound
+			return 0, domain.ErrNoteNotFound
 		}
-		return err
+		return 0, err
 	}
+	if s.revisionLimit > 0 {
+		// The update is already saved, so a failed prune must not fail it.
+		// The next update of the note prunes again.
+		if err = s.repo.PruneRevisions(ctx, n.ID, n.UserID, s.revisionLimit); err != nil {
+			log.Printf("prune revisions of note %d: %v", n.ID, err)
+		}
+	}
+	return version, nil
+}
 
-	return nil
+// ListRevisions returns the saved versions of a note, newest first. The
+// first one is the note as it is now, unless the note is a legacy plaintext
+// row not saved since encryption was enabled: those have no revisions yet.
+func (s *NoteService) ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]domain.NoteRevision, error) {
+	revs, err := s.repo.ListRevisions(ctx, noteID, uid, limit, offset)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrNoteNotFound
+		}
+		return nil, err
+	}
+	return revs, nil
+}
+
+// DiffRevisions returns a unified diff from one revision of a note to
+// another. The title is compared as the first line, followed by a blank
+// line and the content, so renames show up too.
+func (s *NoteService) DiffRevisions(ctx context.Context, noteID, uid, fromID, toID int64) (string, error) {
+	from, err := s.revision(ctx, noteID, fromID, uid)
+	if err != nil {
+		return "", err
+	}
+	to, err := s.revision(ctx, noteID, toID, uid)
+	if err != nil {
+		return "", err
+	}
+	if from.ClientEncryption != nil || to.ClientEncryption != nil {
+		return "", ErrRevisionNotDiffable
+	}
+	return textdiff.Unified(
+		fmt.Sprintf("revision/%d", from.ID), fmt.Sprintf("revision/%d", to.ID),
+		revisionText(from), revisionText(to), diffContext), nil
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+func revisionText(rev domain.NoteRevision) string {
+	return rev.Title + "\n\n" + rev.Content
+}
+
+// RestoreRevision makes an old revision the current version of the note.
+// History is never rewritten: the restored text is saved as a new revision.
+// Tags are left as they are. A non-zero version is checked like in UpdateByID.
+func (s *NoteService) RestoreRevision(ctx context.Context, noteID, revisionID, uid, version int64) (domain.Note, error) {
+	rev, err := s.revision(ctx, noteID, revisionID, uid)
+	if err != nil {
+		return domain.Note{}, err
+	}
+	_, err = s.UpdateByID(ctx, domain.Note{
+		ID:               noteID,
+		UserID:           uid,
+		Title:            rev.Title,
+		Content:          rev.Content,
+		ClientEncryption: rev.ClientEncryption,
+		Version:          version,
+	})
+	if err != nil {
+		return domain.Note{}, err
+	}
+	return s.GetByID(ctx, noteID, uid)
+}
+
+func (s *NoteService) revision(ctx context.Context, noteID, revisionID, uid int64) (domain.NoteRevision, error) {
+	rev, err := s.repo.GetRevision(ctx, noteID, revisionID, uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.NoteRevision{}, domain.ErrRevisionNotFound
+		}
+		return domain.NoteRevision{}, err
+	}
+	return rev, nil
 }
-func (s *NoteService) List(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
-	list, err := s.repo.List(ctx, uid, limit, offset)
+func (s *NoteService) List(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+	var err error
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return nil, err
+	}
+	list, err := s.repo.List(ctx, uid, filter, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	return list, nil
 }
-func (s *NoteService) RemoveNote(ctx context.Context, noteID, uid int64) error {
-	err := s.repo.RemoveByID(ctx, noteID, uid)
+
+// Tags lists the caller's tags with the number of notes carrying each.
+func (s *NoteService) Tags(ctx context.Context, uid int64) ([]domain.TagCount, error) {
+	return s.repo.TagCounts(ctx, uid)
+}
+
+// RemoveNote moves a note to the trash. It can be restored until it is
+// deleted permanently or the trash purger removes it. A non-zero version
+// must match the note's, or ErrVersionConflict is returned.
+func (s *NoteService) RemoveNote(ctx context.Context, noteID, uid, version int64) error {
+	err := s.repo.RemoveByID(ctx, noteID, uid, version)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.ErrNoteNotFound
@@ -63,6 +238,53 @@ func (s *NoteService) RemoveNote(ctx context.Context, noteID, uid int64) error {
 	}
 	return nil
 }
+
+// ListTrash returns the caller's deleted notes, most recently deleted first.
+func (s *NoteService) ListTrash(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+	return s.repo.ListDeleted(ctx, uid, limit, offset)
+}
+
+func (s *NoteService) RestoreNote(ctx context.Context, noteID, uid int64) error {
+	if err := s.repo.Restore(ctx, noteID, uid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrNoteNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeNote deletes a note in the trash for good. Notes that are not in the
+// trash are reported as not found.
+func (s *NoteService) PurgeNote(ctx context.Context, noteID, uid int64) error {
+	if err := s.repo.DeletePermanently(ctx, noteID, uid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrNoteNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ArchiveNote hides a note from List without deleting it.
+func (s *NoteService) ArchiveNote(ctx context.Context, noteID, uid int64) error {
+	return s.setArchived(ctx, noteID, uid, true)
+}
+
+func (s *NoteService) UnarchiveNote(ctx context.Context, noteID, uid int64) error {
+	return s.setArchived(ctx, noteID, uid, false)
+}
+
+func (s *NoteService) setArchived(ctx context.Context, noteID, uid int64, archived bool) error {
+	if err := s.repo.SetArchived(ctx, noteID, uid, archived); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrNoteNotFound
+		}
+		return err
+	}
+	return nil
+}
+
 func (s *NoteService) GetByID(ctx context.Context, noteID, uid int64) (domain.Note, error) {
 	note, err := s.repo.GetByID(ctx, noteID, uid)
 	if err != nil {
@@ -73,3 +295,79 @@ func (s *NoteService) GetByID(ctx context.Context, noteID, uid int64) (domain.No
 	}
 	return note, nil
 }
+
+// validate checks a note before it is written. Client-encrypted notes skip the
+// plaintext checks: the server can only verify that the payload is well formed.
+// They cannot carry tags, which are stored in the clear, so zero-knowledge
+// accounts have none.
+func (s *NoteService) validate(ctx context.Context, n domain.Note) error {
+	if n.ClientEncryption != nil {
+		if len(n.Tags) > 0 {
+			return errTagsOnEncryptedNote
+		}
+		return validateClientEncrypted(n)
+	}
+	if strings.TrimSpace(n.Title) == "" {
+		return ErrInvalidTitle
+	}
+	if strings.TrimSpace(n.Content) == "" {
+		return ErrInvalidContent
+	}
+	if s.users != nil {
+		user, err := s.users.GetByID(ctx, n.UserID)
+		if err != nil {
+			return err
+		}
+		if user.ZeroKnowledge {
+			return errZeroKnowledgeAccount
+		}
+	}
+	return nil
+}
+
+// normalizeTags trims and lower-cases tags, drops duplicates and sorts them,
+// so "Work" and " work" are the same tag. nil stays nil.
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		n := utf8.RuneCountInString(t)
+		if n == 0 || n > maxTagLength || strings.ContainsRune(t, ',') ||
+			strings.ContainsFunc(t, unicode.IsControl) {
+			return nil, ErrInvalidTag
+		}
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > maxTagsPerNote {
+		return nil, ErrTooManyTags
+	}
+	return out, nil
+}
+
+func validateClientEncrypted(n domain.Note) error {
+	ce := n.ClientEncryption
+	if n.Title != "" {
+		return ErrPlaintextWithCiphertext
+	}
+	if ct, err := base64.StdEncoding.DecodeString(n.Content); err != nil || len(ct) == 0 {
+		return ErrInvalidCiphertext
+	}
+	size, ok := nonceSizes[ce.Algorithm]
+	if !ok {
+		return ErrUnsupportedAlgorithm
+	}
+	if nonce, err := base64.StdEncoding.DecodeString(ce.Nonce); err != nil || len(nonce) != size {
+		return ErrInvalidNonce
+	}
+	if ce.KDF != "" {
+		if salt, err := base64.StdEncoding.DecodeString(ce.KDFSalt); err != nil || len(salt) == 0 {
+			return ErrInvalidKDFSalt
+		}
+	}
+	return nil
+}
@@ -3,7 +3,11 @@ package service_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/secure-notes/internal/domain"
 	"github.com/secure-notes/internal/service"
@@ -119,7 +123,7 @@ func TestNoteService_UpdateByID_NotFound(t *testing.T) {
 	}
 	svc := service.NewNoteService(repo)
 
-	err := svc.UpdateByID(context.Background(), domain.Note{Title: "Update", Content: "New content"})
+	_, err := svc.UpdateByID(context.Background(), domain.Note{Title: "Update", Content: "New content"})
 
 	if !errors.Is(err, domain.ErrNoteNotFound) {
 		t.Fatalf("expected domain.ErrNoteNotFound, got: %v", err)
@@ -134,17 +138,36 @@ func TestNoteService_UpdateByID_Success(t *testing.T) {
 	}
 	svc := service.NewNoteService(repo)
 
-	updateData := domain.Note{ID: 1, Title: "Updated Title", Content: "Updated Content"}
-	err := svc.UpdateByID(context.Background(), updateData)
+	updateData := domain.Note{ID: 1, Title: "Updated Title", Content: "Updated Content", Version: 4}
+	version, err := svc.UpdateByID(context.Background(), updateData)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if version != 5 {
+		t.Fatalf("expected the new version 5, got %d", version)
+	}
 	if repo.lastNote.Title != "Updated Title" {
 		t.Fatalf("repo received wrong data")
 	} // --- RemoveNote tests ---
 } // --- RemoveNote tests ---
 
+func TestNoteService_UpdateByID_PruneFailureKeepsUpdate(t *testing.T) {
+	repo := &fakeNoteRepo{
+		updateFn: func(ctx context.Context, note domain.Note) error { return nil },
+		pruneErr: errors.New("connection reset"),
+	}
+	svc := service.NewNoteService(repo, service.WithRevisionLimit(50))
+
+	version, err := svc.UpdateByID(context.Background(), domain.Note{ID: 1, UserID: 10, Title: "t", Content: "c", Version: 2})
+	if err != nil || version != 3 {
+		t.Fatalf("a saved update must succeed despite the prune: version=%d err=%v", version, err)
+	}
+	if repo.prunedTo != 50 {
+		t.Fatalf("expected a prune to 50, got %d", repo.prunedTo)
+	}
+}
+
 func TestNoteService_RemoveNote_NotFound(t *testing.T) {
 	repo := &fakeNoteRepo{
 		removeByIDFn: func(ctx context.Context, noteID, uid int64) error {
@@ -153,7 +176,7 @@ func TestNoteService_RemoveNote_NotFound(t *testing.T) {
 	}
 	svc := service.NewNoteService(repo)
 
-	err := svc.RemoveNote(context.Background(), 100, 20)
+	err := svc.RemoveNote(context.Background(), 100, 20, 0)
 
 	if !errors.Is(err, domain.ErrNoteNotFound) {
 		t.Fatalf("expected ErrNoteNotFound, got: %v", err)
@@ -168,7 +191,7 @@ func TestNoteService_RemoveNote_Success(t *testing.T) {
 	}
 	svc := service.NewNoteService(repo)
 
-	err := svc.RemoveNote(context.Background(), 100, 20)
+	err := svc.RemoveNote(context.Background(), 100, 20, 0)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -177,3 +200,326 @@ func TestNoteService_RemoveNote_Success(t *testing.T) {
 		t.Fatalf("correct IDs not passed to repo")
 	}
 }
+
+func TestNoteService_UpdateByID_VersionConflict(t *testing.T) {
+	repo := &fakeNoteRepo{
+		updateFn: func(ctx context.Context, note domain.Note) error {
+			return domain.ErrVersionConflict
+		},
+	}
+	svc := service.NewNoteService(repo)
+
+	_, err := svc.UpdateByID(context.Background(), domain.Note{ID: 1, UserID: 10, Title: "t", Content: "c", Version: 4})
+
+	if !errors.Is(err, domain.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got: %v", err)
+	}
+	if repo.lastNote.Version != 4 {
+		t.Fatalf("expected version 4 passed to repo, got %d", repo.lastNote.Version)
+	}
+}
+
+func TestNoteService_RemoveNote_VersionConflict(t *testing.T) {
+	repo := &fakeNoteRepo{
+		removeByIDFn: func(ctx context.Context, noteID, uid int64) error {
+			return domain.ErrVersionConflict
+		},
+	}
+	svc := service.NewNoteService(repo)
+
+	err := svc.RemoveNote(context.Background(), 100, 20, 3)
+
+	if !errors.Is(err, domain.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got: %v", err)
+	}
+	if repo.lastVersion != 3 {
+		t.Fatalf("expected version 3 passed to repo, got %d", repo.lastVersion)
+	}
+}
+
+// --- client-encrypted notes ---
+
+func encryptedNote() domain.Note {
+	return domain.Note{
+		UserID:  10,
+		Content: "q83vEjRWeJA=", // opaque ciphertext
+		ClientEncryption: &domain.ClientEncryption{
+			Algorithm: domain.AlgAES256GCM,
+			Nonce:     "AAECAwQFBgcICQoL", // 12 bytes
+			KDF:       "argon2id",
+			KDFSalt:   "c2FsdHNhbHRzYWx0",
+		},
+	}
+}
+
+func TestNoteService_CreateNote_ClientEncryptedStoredAsIs(t *testing.T) {
+	repo := &fakeNoteRepo{
+		createFn: func(ctx context.Context, note domain.Note) (domain.Note, error) {
+			return note, nil
+		},
+	}
+	svc := service.NewNoteService(repo)
+
+	if _, err := svc.CreateNote(context.Background(), encryptedNote()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.lastNote.Content != "q83vEjRWeJA=" || repo.lastNote.ClientEncryption == nil {
+		t.Fatalf("payload not passed through: %+v", repo.lastNote)
+	}
+}
+
+func TestNoteService_CreateNote_ClientEncryptedValidation(t *testing.T) {
+	cases := map[string]struct {
+		mutate func(n *domain.Note)
+		want   error
+	}{
+		"plaintext title": {func(n *domain.Note) { n.Title = "leak" }, service.ErrPlaintextWithCiphertext},
+		"empty payload":   {func(n *domain.Note) { n.Content = "" }, service.ErrInvalidCiphertext},
+		"not base64":      {func(n *domain.Note) { n.Content = "not base64!" }, service.ErrInvalidCiphertext},
+		"unknown alg":     {func(n *domain.Note) { n.ClientEncryption.Algorithm = "ROT13" }, service.ErrUnsupportedAlgorithm},
+		"short nonce":     {func(n *domain.Note) { n.ClientEncryption.Nonce = "AAEC" }, service.ErrInvalidNonce},
+		"kdf no salt":     {func(n *domain.Note) { n.ClientEncryption.KDFSalt = "" }, service.ErrInvalidKDFSalt},
+		"plaintext tags":  {func(n *domain.Note) { n.Tags = []string{"medical"} }, service.ErrPlaintextNotAllowed},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			n := encryptedNote()
+			tc.mutate(&n)
+			_, err := service.NewNoteService(&fakeNoteRepo{}).CreateNote(context.Background(), n)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got: %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestNoteService_ZeroKnowledgeAccountRejectsPlaintext(t *testing.T) {
+	users := newFakeUserRepo(domain.User{ID: 10, ZeroKnowledge: true})
+	repo := &fakeNoteRepo{
+		createFn: func(ctx context.Context, note domain.Note) (domain.Note, error) {
+			return note, nil
+		},
+	}
+	svc := service.NewNoteService(repo, service.WithUserRepository(users))
+
+	_, err := svc.CreateNote(context.Background(), domain.Note{UserID: 10, Title: "t", Content: "c"})
+	if !errors.Is(err, service.ErrPlaintextNotAllowed) {
+		t.Fatalf("expected ErrPlaintextNotAllowed, got: %v", err)
+	}
+	if _, err = svc.CreateNote(context.Background(), encryptedNote()); err != nil {
+		t.Fatalf("client-encrypted note should be accepted: %v", err)
+	}
+}
+
+func TestNoteService_UpdateToClientEncryptedDropsTags(t *testing.T) {
+	repo := &fakeNoteRepo{updateFn: func(ctx context.Context, note domain.Note) error { return nil }}
+	svc := service.NewNoteService(repo)
+
+	n := encryptedNote()
+	n.ID = 1
+	if _, err := svc.UpdateByID(context.Background(), n); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if repo.lastNote.Tags == nil || len(repo.lastNote.Tags) != 0 {
+		t.Fatalf("plaintext tags must be cleared, got %#v", repo.lastNote.Tags)
+	}
+}
+
+func TestNoteService_VerifiedEmailRequired(t *testing.T) {
+	verified := time.Now()
+	users := newFakeUserRepo(domain.User{ID: 10}, domain.User{ID: 11, EmailVerifiedAt: &verified})
+	repo := &fakeNoteRepo{
+		createFn: func(ctx context.Context, note domain.Note) (domain.Note, error) {
+			return note, nil
+		},
+	}
+	svc := service.NewNoteService(repo, service.WithUserRepository(users), service.WithVerifiedEmailRequired())
+
+	_, err := svc.CreateNote(context.Background(), domain.Note{UserID: 10, Title: "t", Content: "c"})
+	if !errors.Is(err, service.ErrEmailNotVerified) {
+		t.Fatalf("expected ErrEmailNotVerified, got: %v", err)
+	}
+	if _, err = svc.CreateNote(context.Background(), domain.Note{UserID: 11, Title: "t", Content: "c"}); err != nil {
+		t.Fatalf("verified account: %v", err)
+	}
+}
+
+// --- Tag tests ---
+
+func TestNoteService_NormalizesTags(t *testing.T) {
+	repo := &fakeNoteRepo{
+		createFn: func(ctx context.Context, note domain.Note) (domain.Note, error) {
+			return note, nil
+		},
+		updateFn: func(ctx context.Context, note domain.Note) error {
+			return nil
+		},
+		listFn: func(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+			if !slices.Equal(filter.Tags, []string{"home", "work"}) || !filter.MatchAllTags {
+				t.Fatalf("filter not normalized: %+v", filter)
+			}
+			return nil, nil
+		},
+	}
+	svc := service.NewNoteService(repo)
+	ctx := context.Background()
+
+	created, err := svc.CreateNote(ctx, domain.Note{Title: "t", Content: "c", Tags: []string{" Work", "home", "work "}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !slices.Equal(created.Tags, []string{"home", "work"}) {
+		t.Fatalf("tags = %q", created.Tags)
+	}
+
+	if _, err = svc.UpdateByID(ctx, domain.Note{ID: 1, Title: "t", Content: "c"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if repo.lastNote.Tags != nil {
+		t.Fatalf("omitted tags must stay nil so the repository keeps them, got %q", repo.lastNote.Tags)
+	}
+
+	for _, bad := range [][]string{{""}, {"a,b"}, {"tab\there"}, {strings.Repeat("x", 51)}} {
+		if _, err = svc.CreateNote(ctx, domain.Note{Title: "t", Content: "c", Tags: bad}); !errors.Is(err, service.ErrInvalidTag) {
+			t.Fatalf("%q: expected ErrInvalidTag, got: %v", bad, err)
+		}
+	}
+	many := make([]string, 21)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag%d", i)
+	}
+	if _, err = svc.CreateNote(ctx, domain.Note{Title: "t", Content: "c", Tags: many}); !errors.Is(err, service.ErrTooManyTags) {
+		t.Fatalf("expected ErrTooManyTags, got: %v", err)
+	}
+
+	if _, err = svc.List(ctx, 10, domain.NoteFilter{Tags: []string{"WORK", "home"}, MatchAllTags: true}, 20, 0); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+}
+
+// --- Archive tests ---
+
+func TestNoteService_ArchiveNote(t *testing.T) {
+	var got []bool
+	repo := &fakeNoteRepo{
+		setArchivedFn: func(ctx context.Context, noteID, uid int64, archived bool) error {
+			if noteID == 404 {
+				return gorm.ErrRecordNotFound
+			}
+			got = append(got, archived)
+			return nil
+		},
+	}
+	svc := service.NewNoteService(repo)
+	ctx := context.Background()
+
+	if err := svc.ArchiveNote(ctx, 1, 10); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if repo.lastNoteID != 1 || repo.lastUID != 10 {
+		t.Fatalf("ownership args not passed correctly: noteID=%d uid=%d", repo.lastNoteID, repo.lastUID)
+	}
+	if err := svc.UnarchiveNote(ctx, 1, 10); err != nil {
+		t.Fatalf("unarchive: %v", err)
+	}
+	if !slices.Equal(got, []bool{true, false}) {
+		t.Fatalf("archived flags = %v", got)
+	}
+	if err := svc.ArchiveNote(ctx, 404, 10); !errors.Is(err, domain.ErrNoteNotFound) {
+		t.Fatalf("expected ErrNoteNotFound, got: %v", err)
+	}
+}
+
+func TestNoteService_RestoreAndPurge(t *testing.T) {
+	inTrash := func(ctx context.Context, noteID, uid int64) error {
+		if noteID == 404 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	}
+	repo := &fakeNoteRepo{restoreFn: inTrash, purgeFn: inTrash}
+	svc := service.NewNoteService(repo)
+	ctx := context.Background()
+
+	if err := svc.RestoreNote(ctx, 1, 10); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if repo.lastNoteID != 1 || repo.lastUID != 10 {
+		t.Fatalf("ownership args not passed correctly: noteID=%d uid=%d", repo.lastNoteID, repo.lastUID)
+	}
+	if err := svc.PurgeNote(ctx, 2, 10); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if repo.lastNoteID != 2 || repo.lastUID != 10 {
+		t.Fatalf("ownership args not passed correctly: noteID=%d uid=%d", repo.lastNoteID, repo.lastUID)
+	}
+	if err := svc.RestoreNote(ctx, 404, 10); !errors.Is(err, domain.ErrNoteNotFound) {
+		t.Fatalf("expected ErrNoteNotFound, got: %v", err)
+	}
+	if err := svc.PurgeNote(ctx, 404, 10); !errors.Is(err, domain.ErrNoteNotFound) {
+		t.Fatalf("expected ErrNoteNotFound, got: %v", err)
+	}
+}
+
+func TestNoteService_DiffRevisions(t *testing.T) {
+	repo := &fakeNoteRepo{revisions: map[int64]domain.NoteRevision{
+		1: {ID: 1, NoteID: 5, UserID: 10, Title: "groceries", Content: "milk\neggs\n"},
+		2: {ID: 2, NoteID: 5, UserID: 10, Title: "groceries", Content: "milk\nbread\n"},
+		3: {ID: 3, NoteID: 5, UserID: 10, Content: "Y2lwaGVy", ClientEncryption: &domain.ClientEncryption{}},
+		4: {ID: 4, NoteID: 6, UserID: 11, Title: "other", Content: "x"},
+	}}
+	svc := service.NewNoteService(repo)
+	ctx := context.Background()
+
+	diff, err := svc.DiffRevisions(ctx, 5, 10, 1, 2)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	want := "--- revision/1\n+++ revision/2\n@@ -1,4 +1,4 @@\n groceries\n \n milk\n-eggs\n+bread\n"
+	if diff != want {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+	if _, err = svc.DiffRevisions(ctx, 5, 10, 1, 3); !errors.Is(err, service.ErrRevisionNotDiffable) {
+		t.Fatalf("expected ErrRevisionNotDiffable, got: %v", err)
+	}
+	if _, err = svc.DiffRevisions(ctx, 5, 10, 1, 4); !errors.Is(err, domain.ErrRevisionNotFound) {
+		t.Fatalf("another user's revision: expected ErrRevisionNotFound, got: %v", err)
+	}
+}
+
+func TestNoteService_RestoreRevision(t *testing.T) {
+	repo := &fakeNoteRepo{
+		revisions: map[int64]domain.NoteRevision{
+			1: {ID: 1, NoteID: 5, UserID: 10, Title: "old title", Content: "old body"},
+		},
+		updateFn: func(ctx context.Context, note domain.Note) error { return nil },
+		getByIDFn: func(ctx context.Context, noteID, uid int64) (domain.Note, error) {
+			return domain.Note{ID: noteID, UserID: uid, Title: "old title", Content: "old body"}, nil
+		},
+	}
+	svc := service.NewNoteService(repo, service.WithRevisionLimit(50))
+
+	note, err := svc.RestoreRevision(context.Background(), 5, 1, 10, 3)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if note.Title != "old title" {
+		t.Fatalf("unexpected note: %+v", note)
+	}
+	saved := repo.lastNote
+	if saved.ID != 5 || saved.UserID != 10 || saved.Title != "old title" || saved.Content != "old body" {
+		t.Fatalf("restore saved %+v", saved)
+	}
+	if saved.Version != 3 {
+		t.Fatalf("expected If-Match version 3 passed to repo, got %d", saved.Version)
+	}
+	if saved.Tags != nil {
+		t.Fatalf("restore should keep the current tags, got %v", saved.Tags)
+	}
+	if repo.prunedTo != 50 {
+		t.Fatalf("expected revisions pruned to 50, got %d", repo.prunedTo)
+	}
+	if _, err = svc.RestoreRevision(context.Background(), 5, 99, 10, 0); !errors.Is(err, domain.ErrRevisionNotFound) {
+		t.Fatalf("expected ErrRevisionNotFound, got: %v", err)
+	}
+}
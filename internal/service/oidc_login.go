@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/oidc"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+// oidcRequestTTL bounds how long the user may take at the provider.
+const oidcRequestTTL = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled         = errors.New("single sign-on is not enabled")
+	ErrInvalidOIDCState     = errors.New("sign-in request is unknown or expired")
+	ErrOIDCLoginFailed      = errors.New("identity provider rejected the sign-in")
+	ErrOIDCUnavailable      = errors.New("identity provider is unavailable")
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not assert a verified email")
+	ErrOIDCAccountConflict  = errors.New("an account with this email exists but its address is not verified")
+)
+
+// OIDCProvider is the part of oidc.Client used for sign-in.
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error)
+	Exchange(ctx context.Context, code, verifier, nonce string) (oidc.Identity, error)
+}
+
+// WithOIDC enables single sign-on through an OpenID Connect provider.
+// Identities are linked to users by provider subject, or on first sign-in by
+// an email address both sides have verified.
+func WithOIDC(provider OIDCProvider, identities domain.UserIdentityRepository, requests domain.OIDCAuthRequestRepository) AuthOption {
+	return func(u *UserAuth) {
+		u.oidc = provider
+		u.identities = identities
+		u.oidcRequests = requests
+	}
+}
+
+// StartOIDC begins a single sign-on login and returns the provider URL to
+// send the browser to. The caller should bind state to the browser, e.g. in a
+// cookie, and check it on the callback to stop login CSRF.
+func (u *UserAuth) StartOIDC(ctx context.Context) (authURL, state string, err error) {
+	if u.oidc == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	keys := u.oidcStartKeys(ctx)
+	if err = u.checkThrottle(ctx, keys); err != nil {
+		return "", "", err
+	}
+	if err = u.recordFailure(ctx, keys); err != nil {
+		return "", "", err
+	}
+	state, _, err = security.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := security.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err = u.oidc.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrOIDCUnavailable, err)
+	}
+	err = u.oidcRequests.Create(ctx, domain.OIDCAuthRequest{
+		StateHash:    security.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcRequestTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// LoginOIDC finishes a single sign-on login with the code and state the
+// provider redirected back with. Accounts with 2FA still get a challenge.
+func (u *UserAuth) LoginOIDC(ctx context.Context, state, code string) (LoginResult, error) {
+	if u.oidc == nil {
+		return LoginResult{}, ErrOIDCDisabled
+	}
+	if strings.TrimSpace(state) == "" || strings.TrimSpace(code) == "" {
+		return LoginResult{}, ErrInvalidOIDCState
+	}
+	req, err := u.oidcRequests.Take(ctx, security.HashToken(state))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return LoginResult{}, ErrInvalidOIDCState
+		}
+		return LoginResult{}, err
+	}
+	if time.Now().After(req.ExpiresAt) {
+		return LoginResult{}, ErrInvalidOIDCState
+	}
+	identity, err := u.oidc.Exchange(ctx, code, req.CodeVerifier, req.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrProviderUnavailable) {
+			return LoginResult{}, fmt.Errorf("%w: %v", ErrOIDCUnavailable, err)
+		}
+		return LoginResult{}, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	user, err := u.linkIdentity(ctx, identity)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if challenge, ok, err := u.mfaChallenge(ctx, user.ID); err != nil || ok {
+		return challenge, err
+	}
+	return u.startSession(ctx, user.ID)
+}
+
+// linkIdentity finds the user for a provider identity, linking or creating
+// one on first sign-in. Linking by email requires the address to be verified
+// on both sides, so nobody can pre-register a victim's address and later
+// share the account with them.
+func (u *UserAuth) linkIdentity(ctx context.Context, id oidc.Identity) (domain.User, error) {
+	link, err := u.identities.Get(ctx, id.Issuer, id.Subject)
+	if err == nil {
+		return u.repo.GetByID(ctx, link.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.User{}, err
+	}
+	if id.Email == "" || !id.EmailVerified {
+		return domain.User{}, ErrOIDCEmailNotVerified
+	}
+
+	user, err := u.repo.GetByEmail(ctx, id.Email)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			return domain.User{}, ErrOIDCAccountConflict
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		now := time.Now()
+		// No password: the account signs in through the provider until the
+		// user sets one with the password reset flow.
+		user, err = u.repo.Register(ctx, domain.User{Email: id.Email, EmailVerifiedAt: &now, Role: domain.RoleUser})
+		if err != nil {
+			return domain.User{}, err
+		}
+	default:
+		return domain.User{}, err
+	}
+
+	_, err = u.identities.Create(ctx, domain.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  id.Issuer,
+		Subject: id.Subject,
+		Email:   id.Email,
+	})
+	if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
+		return domain.User{}, err
+	}
+	return user, nil
+}
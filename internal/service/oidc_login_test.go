@@ -0,0 +1,180 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/oidc"
+	"github.com/secure-notes/internal/oidc/oidctest"
+	"github.com/secure-notes/internal/repository/memory"
+	"github.com/secure-notes/internal/service"
+)
+
+type oidcFixture struct {
+	svc        *service.UserAuth
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+	idp        *oidctest.Server
+}
+
+func newOIDCFixture(t *testing.T) oidcFixture {
+	t.Helper()
+	idp := oidctest.NewServer("notes", "s3cret")
+	t.Cleanup(idp.Close)
+	client := oidc.NewClient(oidc.Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "notes",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://app.test/api/v1/auth/oidc/callback",
+	})
+	identities := &fakeIdentityRepo{}
+	svc, users := newTestAuth(t, service.WithOIDC(client, identities, &fakeOIDCRequestRepo{}))
+	return oidcFixture{svc: svc, users: users, identities: identities, idp: idp}
+}
+
+// signIn runs the browser side of the flow and returns the callback state and code.
+func (f oidcFixture) signIn(t *testing.T, user oidctest.User) (state, code string) {
+	t.Helper()
+	f.idp.SetUser(user)
+	authURL, state, err := f.svc.StartOIDC(context.Background())
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	res.Body.Close()
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("callback location: %v", err)
+	}
+	if loc.Query().Get("state") != state {
+		t.Fatalf("provider must echo state")
+	}
+	return state, loc.Query().Get("code")
+}
+
+func TestUserAuth_LoginOIDC_CreatesAndLinksUser(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+
+	state, code := f.signIn(t, oidctest.User{Subject: "sub-1", Email: "sso@example.com", EmailVerified: true})
+	res, err := f.svc.LoginOIDC(ctx, state, code)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	p, err := f.svc.Authenticate(ctx, res.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	user, _ := f.users.GetByID(ctx, p.UserID)
+	if user.Email != "sso@example.com" || user.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if len(f.identities.identities) != 1 || f.identities.identities[0].UserID != p.UserID {
+		t.Fatalf("identity not linked: %+v", f.identities.identities)
+	}
+
+	// The subject keeps working after the provider-side email changes.
+	state, code = f.signIn(t, oidctest.User{Subject: "sub-1", Email: "renamed@example.com", EmailVerified: true})
+	res, err = f.svc.LoginOIDC(ctx, state, code)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if p2, _ := f.svc.Authenticate(ctx, res.AccessToken); p2.UserID != p.UserID {
+		t.Fatalf("expected the same user, got %d and %d", p.UserID, p2.UserID)
+	}
+
+	if _, err = f.svc.LoginOIDC(ctx, state, code); !errors.Is(err, service.ErrInvalidOIDCState) {
+		t.Fatalf("state must be single use, got: %v", err)
+	}
+}
+
+func TestUserAuth_LoginOIDC_LinksVerifiedLocalAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+	local, _ := f.users.GetByEmail(ctx, "a@example.com")
+
+	state, code := f.signIn(t, oidctest.User{Subject: "sub-2", Email: "a@example.com", EmailVerified: true})
+	if _, err := f.svc.LoginOIDC(ctx, state, code); !errors.Is(err, service.ErrOIDCAccountConflict) {
+		t.Fatalf("unverified local account must not be linked, got: %v", err)
+	}
+
+	if err := f.users.MarkEmailVerified(ctx, local.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	state, code = f.signIn(t, oidctest.User{Subject: "sub-2", Email: "a@example.com", EmailVerified: true})
+	res, err := f.svc.LoginOIDC(ctx, state, code)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if p, _ := f.svc.Authenticate(ctx, res.AccessToken); p.UserID != local.ID {
+		t.Fatalf("expected local user %d, got %d", local.ID, p.UserID)
+	}
+	// The password path is untouched.
+	login(t, f.svc)
+}
+
+func TestUserAuth_LoginOIDC_RequiresVerifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	state, code := f.signIn(t, oidctest.User{Subject: "sub-3", Email: "new@example.com"})
+	if _, err := f.svc.LoginOIDC(context.Background(), state, code); !errors.Is(err, service.ErrOIDCEmailNotVerified) {
+		t.Fatalf("expected ErrOIDCEmailNotVerified, got: %v", err)
+	}
+	if _, err := f.users.GetByEmail(context.Background(), "new@example.com"); err == nil {
+		t.Fatalf("no account should be created")
+	}
+}
+
+func TestUserAuth_LoginOIDC_RejectsForgedCode(t *testing.T) {
+	f := newOIDCFixture(t)
+
+	state, _ := f.signIn(t, oidctest.User{Subject: "sub-4", Email: "x@example.com", EmailVerified: true})
+	if _, err := f.svc.LoginOIDC(context.Background(), state, "forged"); !errors.Is(err, service.ErrOIDCLoginFailed) {
+		t.Fatalf("expected ErrOIDCLoginFailed, got: %v", err)
+	}
+	if _, err := f.svc.LoginOIDC(context.Background(), "unknown", "code"); !errors.Is(err, service.ErrInvalidOIDCState) {
+		t.Fatalf("expected ErrInvalidOIDCState, got: %v", err)
+	}
+}
+
+func TestUserAuth_LoginOIDC_Disabled(t *testing.T) {
+	svc, _ := newTestAuth(t)
+	if _, _, err := svc.StartOIDC(context.Background()); !errors.Is(err, service.ErrOIDCDisabled) {
+		t.Fatalf("expected ErrOIDCDisabled, got: %v", err)
+	}
+}
+
+func TestUserAuth_StartOIDC_ThrottledPerIP(t *testing.T) {
+	idp := oidctest.NewServer("notes", "s3cret")
+	t.Cleanup(idp.Close)
+	client := oidc.NewClient(oidc.Config{IssuerURL: idp.Issuer(), ClientID: "notes", ClientSecret: "s3cret"})
+	policy := service.DefaultLoginThrottlePolicy()
+	policy.OIDCIP = service.ThrottleRule{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	svc, _ := newTestAuth(t,
+		service.WithOIDC(client, &fakeIdentityRepo{}, &fakeOIDCRequestRepo{}),
+		service.WithLoginThrottle(memory.NewLoginAttemptStore(), policy))
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := svc.StartOIDC(ctx); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+	}
+	var locked *service.LoginLockedError
+	if _, _, err := svc.StartOIDC(ctx); !errors.As(err, &locked) {
+		t.Fatalf("expected LoginLockedError, got: %v", err)
+	}
+	if _, _, err := svc.StartOIDC(service.WithClientIP(context.Background(), "198.51.100.1")); err != nil {
+		t.Fatalf("other addresses are unaffected: %v", err)
+	}
+}
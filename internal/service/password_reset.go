@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/mail"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = time.Hour
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrMailDisabled      = errors.New("email delivery is not configured")
+)
+
+// WithMailer lets UserAuth email links to users. baseURL is the public URL of
+// the web client; links point at paths below it.
+func WithMailer(tokens domain.OneTimeTokenRepository, mailer mail.Mailer, baseURL string) AuthOption {
+	return func(u *UserAuth) {
+		u.tokens = tokens
+		u.mailer = mailer
+		u.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// ForgotPassword mails a reset link if email belongs to an account. It
+// reports success either way so the endpoint cannot be used to find accounts.
+// Requests are throttled per address and per client IP whether or not the
+// account exists; a throttled request fails with a LoginLockedError.
+func (u *UserAuth) ForgotPassword(ctx context.Context, email string) error {
+	if u.mailer == nil {
+		return ErrMailDisabled
+	}
+	keys := u.resetKeys(ctx, email)
+	if err := u.checkThrottle(ctx, keys); err != nil {
+		return err
+	}
+	if err := u.recordFailure(ctx, keys); err != nil {
+		return err
+	}
+	user, err := u.repo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	raw, err := u.newOneTimeToken(ctx, user, domain.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return u.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your secure-notes password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account.\n\n"+
+			"Open this link within %d minutes to choose a new password:\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password has not changed.",
+			int(passwordResetTTL.Minutes()), u.link("/reset-password", raw)),
+	})
+}
+
+// sendForcedReset tells a user an administrator requires a new password.
+func (u *UserAuth) sendForcedReset(ctx context.Context, user domain.User) error {
+	raw, err := u.newOneTimeToken(ctx, user, domain.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return u.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Choose a new secure-notes password",
+		Body: fmt.Sprintf("An administrator has required a new password for this account and signed it out everywhere.\n\n"+
+			"Open this link within %d minutes to choose one:\n%s\n\n"+
+			"Afterwards you can request another link from the sign-in page.",
+			int(passwordResetTTL.Minutes()), u.link("/reset-password", raw)),
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword, signs
+// the user out everywhere and deletes their personal access tokens.
+func (u *UserAuth) ResetPassword(ctx context.Context, token, password string) error {
+	if u.tokens == nil {
+		return ErrMailDisabled
+	}
+	// Check the password before using up the token, so the user can retry
+	// from the same link.
+	stored, err := u.findOneTimeToken(ctx, domain.TokenPurposePasswordReset, token)
+	if err == nil {
+		err = u.checkTokenAddress(ctx, stored)
+	}
+	if err == nil {
+		if err = u.passwords.Check(password, stored.Email); err != nil {
+			return err
+		}
+		err = u.consumeOneTimeToken(ctx, stored)
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidOneTimeToken) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	hash, err := security.HashPassword(password, security.DefaultArgon2Params())
+	if err != nil {
+		return err
+	}
+	if err = u.setPassword(ctx, stored.UserID, hash); err != nil {
+		return err
+	}
+	if err = u.tokens.InvalidateForUser(ctx, stored.UserID, domain.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+	if err = u.revokePersonalTokens(ctx, stored.UserID); err != nil {
+		return err
+	}
+	return u.LogoutAll(ctx, stored.UserID)
+}
+
+var errInvalidOneTimeToken = errors.New("invalid one-time token")
+
+// newOneTimeToken stores the hash of a fresh token and returns the raw value
+// for the email.
+func (u *UserAuth) newOneTimeToken(ctx context.Context, user domain.User, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := security.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = u.tokens.Create(ctx, domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// redeemOneTimeToken consumes a valid token or fails with errInvalidOneTimeToken.
+func (u *UserAuth) redeemOneTimeToken(ctx context.Context, purpose, raw string) (domain.OneTimeToken, error) {
+	stored, err := u.findOneTimeToken(ctx, purpose, raw)
+	if err != nil {
+		return domain.OneTimeToken{}, err
+	}
+	if err = u.consumeOneTimeToken(ctx, stored); err != nil {
+		return domain.OneTimeToken{}, err
+	}
+	return stored, nil
+}
+
+// findOneTimeToken returns the unused, unexpired token for raw without
+// consuming it.
+func (u *UserAuth) findOneTimeToken(ctx context.Context, purpose, raw string) (domain.OneTimeToken, error) {
+	if strings.TrimSpace(raw) == "" {
+		return domain.OneTimeToken{}, errInvalidOneTimeToken
+	}
+	stored, err := u.tokens.GetByHash(ctx, purpose, security.HashToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.OneTimeToken{}, errInvalidOneTimeToken
+		}
+		return domain.OneTimeToken{}, err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return domain.OneTimeToken{}, errInvalidOneTimeToken
+	}
+	return stored, nil
+}
+
+// checkTokenAddress refuses a token mailed to an address the account no
+// longer has. Links sent before tokens recorded their address have none;
+// addresses could not be changed then, so they still belong to the account.
+func (u *UserAuth) checkTokenAddress(ctx context.Context, stored domain.OneTimeToken) error {
+	if stored.Email == "" {
+		return nil
+	}
+	user, err := u.fresh.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidOneTimeToken
+		}
+		return err
+	}
+	if !strings.EqualFold(user.Email, stored.Email) {
+		return errInvalidOneTimeToken
+	}
+	return nil
+}
+
+// consumeOneTimeToken marks stored used, failing if another request beat us
+// to it.
+func (u *UserAuth) consumeOneTimeToken(ctx context.Context, stored domain.OneTimeToken) error {
+	ok, err := u.tokens.Consume(ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidOneTimeToken
+	}
+	return nil
+}
+
+func (u *UserAuth) link(path, token string) string {
+	return u.baseURL + path + "?token=" + token
+}
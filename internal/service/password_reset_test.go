@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/repository/memory"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+const newPassword = "a brand new long passphrase"
+
+func newResetAuth(t *testing.T, opts ...service.AuthOption) (*service.UserAuth, *fakeOneTimeTokenRepo, *fakeMailer, *fakeRefreshRepo) {
+	t.Helper()
+	tokens, mailer, refresh := &fakeOneTimeTokenRepo{}, &fakeMailer{}, &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, append(opts,
+		service.WithRefreshTokens(refresh, time.Hour),
+		service.WithRevocation(newFakeRevocationStore()),
+		service.WithSessions(&fakeSessionRepo{}),
+		service.WithMailer(tokens, mailer, "https://notes.example.com/"))...)
+	return svc, tokens, mailer, refresh
+}
+
+func TestUserAuth_ResetPassword(t *testing.T) {
+	svc, tokens, mailer, _ := newResetAuth(t)
+	ctx := context.Background()
+	before := login(t, svc)
+
+	if err := svc.ForgotPassword(ctx, "a@example.com"); err != nil {
+		t.Fatalf("forgot: %v", err)
+	}
+	raw := mailer.lastToken()
+	if raw == "" || mailer.sent[len(mailer.sent)-1].To != "a@example.com" {
+		t.Fatalf("expected a reset email, got %+v", mailer.sent)
+	}
+	if tokens.tokens[len(tokens.tokens)-1].TokenHash == raw {
+		t.Fatalf("reset token must be stored hashed")
+	}
+
+	if err := svc.ResetPassword(ctx, raw, "short"); !errors.Is(err, service.ErrPasswordTooShort) {
+		t.Fatalf("expected ErrPasswordTooShort, got: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, raw, newPassword); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, raw, newPassword); !errors.Is(err, service.ErrInvalidResetToken) {
+		t.Fatalf("token must be single-use, got: %v", err)
+	}
+
+	if _, err := svc.Authenticate(ctx, before.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("old sessions must be revoked, got: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, before.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("old refresh tokens must be revoked, got: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("old password must stop working, got: %v", err)
+	}
+	if _, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: newPassword}); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+}
+
+func TestUserAuth_ResetPassword_RejectsExpired(t *testing.T) {
+	svc, tokens, mailer, _ := newResetAuth(t)
+	ctx := context.Background()
+
+	_ = svc.ForgotPassword(ctx, "a@example.com")
+	first := mailer.lastToken()
+	_ = svc.ForgotPassword(ctx, "a@example.com")
+	second := mailer.lastToken()
+	tokens.tokens[len(tokens.tokens)-1].ExpiresAt = time.Now().Add(-time.Minute)
+
+	if err := svc.ResetPassword(ctx, second, newPassword); !errors.Is(err, service.ErrInvalidResetToken) {
+		t.Fatalf("expired token accepted: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, first, newPassword); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+}
+
+func TestUserAuth_ForgotPassword_UnknownEmailIsSilent(t *testing.T) {
+	svc, _, mailer, _ := newResetAuth(t)
+	sent := len(mailer.sent)
+	if err := svc.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("unknown email must not error: %v", err)
+	}
+	if len(mailer.sent) != sent {
+		t.Fatalf("no email should be sent")
+	}
+}
+
+func TestUserAuth_ForgotPassword_Throttled(t *testing.T) {
+	store := memory.NewLoginAttemptStore()
+	mailer := &fakeMailer{}
+	svc, _ := newTestAuth(t,
+		service.WithMailer(&fakeOneTimeTokenRepo{}, mailer, "https://notes.example.com/"),
+		service.WithLoginThrottle(store, service.DefaultLoginThrottlePolicy()))
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+	sent := len(mailer.sent)
+
+	for _, email := range []string{"a@example.com", "nobody@example.com"} {
+		for i := 0; i < 3; i++ {
+			if err := svc.ForgotPassword(ctx, email); err != nil {
+				t.Fatalf("%s request %d: %v", email, i, err)
+			}
+		}
+		// The fourth request is past the allowance, whether or not the
+		// account exists.
+		if err := svc.ForgotPassword(ctx, email); err != nil {
+			t.Fatalf("%s request 4: %v", email, err)
+		}
+		var locked *service.LoginLockedError
+		if err := svc.ForgotPassword(ctx, email); !errors.As(err, &locked) {
+			t.Fatalf("%s: expected LoginLockedError, got: %v", email, err)
+		}
+	}
+	if len(mailer.sent)-sent != 4 {
+		t.Fatalf("expected 4 reset emails, got %d", len(mailer.sent)-sent)
+	}
+	if a, _ := store.Get(ctx, "reset-ip:203.0.113.7"); a.Failures != 8 {
+		t.Fatalf("expected 8 requests counted for the IP, got %d", a.Failures)
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+const (
+	// personalTokenPrefix marks personal access tokens so Authenticate can
+	// tell them from JWTs and secret scanners can find leaked ones.
+	personalTokenPrefix = "snp_"
+	// personalTokenTouchEvery limits last_used_at writes to one per interval.
+	personalTokenTouchEvery = time.Minute
+	maxPersonalTokenName    = 100
+)
+
+var (
+	ErrPersonalTokensDisabled = errors.New("personal access tokens are not enabled")
+	ErrInvalidTokenName       = errors.New("token name is required and must be at most 100 characters")
+	ErrInvalidScopes          = errors.New("scopes must be a non-empty subset of notes:read, notes:write")
+	ErrInvalidTokenExpiry     = errors.New("expiry must be in the future")
+	ErrPersonalTokenNotFound  = errors.New("personal access token not found")
+)
+
+// PersonalScopes lists the scopes a personal access token may be granted.
+var PersonalScopes = []string{domain.ScopeNotesRead, domain.ScopeNotesWrite}
+
+// WithPersonalTokens lets users create long-lived tokens for scripts, which
+// Authenticate then accepts alongside access tokens.
+func WithPersonalTokens(repo domain.PersonalAccessTokenRepository) AuthOption {
+	return func(u *UserAuth) {
+		u.personal = repo
+	}
+}
+
+// CreatePersonalToken returns the new token and its raw value. The raw value
+// is not stored and cannot be shown again.
+func (u *UserAuth) CreatePersonalToken(ctx context.Context, uid int64, name string, scopes []string, expiresAt *time.Time) (domain.PersonalAccessToken, string, error) {
+	if u.personal == nil {
+		return domain.PersonalAccessToken{}, "", ErrPersonalTokensDisabled
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxPersonalTokenName {
+		return domain.PersonalAccessToken{}, "", ErrInvalidTokenName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return domain.PersonalAccessToken{}, "", err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return domain.PersonalAccessToken{}, "", ErrInvalidTokenExpiry
+	}
+
+	secret, _, err := security.NewOpaqueToken()
+	if err != nil {
+		return domain.PersonalAccessToken{}, "", err
+	}
+	raw := personalTokenPrefix + secret
+	token, err := u.personal.Create(ctx, domain.PersonalAccessToken{
+		UserID:    uid,
+		Name:      name,
+		Prefix:    raw[:len(personalTokenPrefix)+6],
+		TokenHash: security.HashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return domain.PersonalAccessToken{}, "", err
+	}
+	return token, raw, nil
+}
+
+func (u *UserAuth) ListPersonalTokens(ctx context.Context, uid int64) ([]domain.PersonalAccessToken, error) {
+	if u.personal == nil {
+		return nil, ErrPersonalTokensDisabled
+	}
+	return u.personal.ListByUser(ctx, uid)
+}
+
+func (u *UserAuth) RevokePersonalToken(ctx context.Context, uid, id int64) error {
+	if u.personal == nil {
+		return ErrPersonalTokensDisabled
+	}
+	if err := u.personal.Delete(ctx, id, uid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPersonalTokenNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// revokePersonalTokens deletes every personal access token of uid. Password
+// resets and changes call it: they are how an account is taken back, and
+// tokens created by whoever held the old password must not outlive that.
+func (u *UserAuth) revokePersonalTokens(ctx context.Context, uid int64) error {
+	if u.personal == nil {
+		return nil
+	}
+	return u.personal.DeleteAllForUser(ctx, uid)
+}
+
+func isPersonalToken(token string) bool {
+	return strings.HasPrefix(token, personalTokenPrefix)
+}
+
+// authenticatePersonal resolves a personal access token to a principal.
+func (u *UserAuth) authenticatePersonal(ctx context.Context, raw string) (domain.Principal, error) {
+	if u.personal == nil {
+		return domain.Principal{}, security.ErrInvalidToken
+	}
+	token, err := u.personal.GetByHash(ctx, security.HashToken(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Principal{}, security.ErrInvalidToken
+		}
+		return domain.Principal{}, err
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return domain.Principal{}, security.ErrInvalidToken
+	}
+	user, err := u.activeUser(ctx, token.UserID)
+	if err != nil {
+		return domain.Principal{}, tokenOwnerError(err)
+	}
+	if user.PasswordResetRequired {
+		return domain.Principal{}, security.ErrTokenRevoked
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= personalTokenTouchEvery {
+		// Usage tracking is informational; never fail a request over it.
+		_ = u.personal.Touch(ctx, token.ID, now)
+	}
+	p := domain.Principal{
+		UserID:          token.UserID,
+		PersonalTokenID: token.ID,
+		Scopes:          token.Scopes,
+		Role:            roleOf(user),
+	}
+	if token.ExpiresAt != nil {
+		p.ExpiresAt = *token.ExpiresAt
+	}
+	return p, nil
+}
+
+// normalizeScopes validates scopes and returns them sorted without duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !slices.Contains(PersonalScopes, s) {
+			return nil, ErrInvalidScopes
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidScopes
+	}
+	slices.Sort(out)
+	return out, nil
+}
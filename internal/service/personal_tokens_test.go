@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func TestUserAuth_PersonalToken_Authenticates(t *testing.T) {
+	repo := &fakePersonalTokenRepo{}
+	svc, _ := newTestAuth(t, service.WithPersonalTokens(repo))
+	ctx := context.Background()
+
+	token, raw, err := svc.CreatePersonalToken(ctx, 1, " ci ", []string{"notes:write", "notes:read", "notes:write"}, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !strings.HasPrefix(raw, token.Prefix) || repo.tokens[0].TokenHash == raw {
+		t.Fatalf("token must be stored hashed with a display prefix: %+v", token)
+	}
+	if token.Name != "ci" || len(token.Scopes) != 2 || token.Scopes[0] != domain.ScopeNotesRead {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	p, err := svc.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if p.UserID != 1 || p.PersonalTokenID != token.ID || len(p.Scopes) != 2 {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+	if repo.tokens[0].LastUsedAt == nil {
+		t.Fatalf("last used time should be recorded")
+	}
+
+	if err = svc.RevokePersonalToken(ctx, 2, token.ID); !errors.Is(err, service.ErrPersonalTokenNotFound) {
+		t.Fatalf("other users must not revoke the token, got: %v", err)
+	}
+	if err = svc.RevokePersonalToken(ctx, 1, token.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, raw); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("revoked token accepted: %v", err)
+	}
+}
+
+func TestUserAuth_PersonalToken_Expiry(t *testing.T) {
+	repo := &fakePersonalTokenRepo{}
+	svc, _ := newTestAuth(t, service.WithPersonalTokens(repo))
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := svc.CreatePersonalToken(ctx, 1, "ci", []string{"notes:read"}, &past); !errors.Is(err, service.ErrInvalidTokenExpiry) {
+		t.Fatalf("expected ErrInvalidTokenExpiry, got: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	_, raw, err := svc.CreatePersonalToken(ctx, 1, "ci", []string{"notes:read"}, &future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.tokens[0].ExpiresAt = &past
+	if _, err = svc.Authenticate(ctx, raw); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("expired token accepted: %v", err)
+	}
+}
+
+func TestUserAuth_PersonalToken_Validation(t *testing.T) {
+	svc, _ := newTestAuth(t, service.WithPersonalTokens(&fakePersonalTokenRepo{}))
+	ctx := context.Background()
+
+	if _, _, err := svc.CreatePersonalToken(ctx, 1, "", []string{"notes:read"}, nil); !errors.Is(err, service.ErrInvalidTokenName) {
+		t.Fatalf("expected ErrInvalidTokenName, got: %v", err)
+	}
+	for _, scopes := range [][]string{nil, {"admin"}} {
+		if _, _, err := svc.CreatePersonalToken(ctx, 1, "ci", scopes, nil); !errors.Is(err, service.ErrInvalidScopes) {
+			t.Fatalf("scopes %v: expected ErrInvalidScopes, got: %v", scopes, err)
+		}
+	}
+	if _, err := svc.Authenticate(ctx, "snp_unknown"); !errors.Is(err, security.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got: %v", err)
+	}
+}
+
+func TestUserAuth_Scopes(t *testing.T) {
+	svc, _ := newTestAuth(t, service.WithPersonalTokens(&fakePersonalTokenRepo{}))
+	ctx := context.Background()
+
+	session, err := svc.Authenticate(ctx, login(t, svc).AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scope := range domain.SessionScopes {
+		if !session.HasScope(scope) {
+			t.Fatalf("session token lacks %s: %v", scope, session.Scopes)
+		}
+	}
+
+	_, raw, _ := svc.CreatePersonalToken(ctx, 1, "reader", []string{domain.ScopeNotesRead}, nil)
+	pat, err := svc.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pat.HasScope(domain.ScopeNotesRead) || pat.HasScope(domain.ScopeNotesWrite) || pat.HasScope(domain.ScopeAccount) {
+		t.Fatalf("unexpected personal token scopes: %v", pat.Scopes)
+	}
+	if _, _, err = svc.CreatePersonalToken(ctx, 1, "admin", []string{domain.ScopeAccount}, nil); !errors.Is(err, service.ErrInvalidScopes) {
+		t.Fatalf("the account scope must not be grantable, got: %v", err)
+	}
+}
+
+func TestUserAuth_PersonalToken_RefusedWhileResetRequired(t *testing.T) {
+	svc, users := newTestAuth(t, service.WithPersonalTokens(&fakePersonalTokenRepo{}))
+	ctx := context.Background()
+	_, raw, err := svc.CreatePersonalToken(ctx, 1, "ci", []string{"notes:read"}, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if err = users.SetPasswordResetRequired(ctx, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.Authenticate(ctx, raw); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked while a reset is required, got: %v", err)
+	}
+}
@@ -1,19 +1,34 @@
 package service_test
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/mail"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
 )
 
 type fakeNoteRepo struct {
-	getByIDFn    func(ctx context.Context, noteID, uid int64) (domain.Note, error)
-	updateFn     func(ctx context.Context, note domain.Note) error
-	removeByIDFn func(ctx context.Context, noteID, uid int64) error
-	createFn     func(ctx context.Context, note domain.Note) (domain.Note, error)
+	getByIDFn     func(ctx context.Context, noteID, uid int64) (domain.Note, error)
+	updateFn      func(ctx context.Context, note domain.Note) error
+	removeByIDFn  func(ctx context.Context, noteID, uid int64) error
+	createFn      func(ctx context.Context, note domain.Note) (domain.Note, error)
+	listFn        func(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error)
+	setArchivedFn func(ctx context.Context, noteID, uid int64, archived bool) error
+	restoreFn     func(ctx context.Context, noteID, uid int64) error
+	purgeFn       func(ctx context.Context, noteID, uid int64) error
+	revisions     map[int64]domain.NoteRevision
+	prunedTo      int
+	pruneErr      error
 
-	lastNoteID int64
-	lastUID    int64
-	lastNote   domain.Note
+	lastNoteID  int64
+	lastUID     int64
+	lastVersion int64
+	lastNote    domain.Note
 }
 
 func (f *fakeNoteRepo) GetByID(ctx context.Context, noteID, uid int64) (domain.Note, error) {
@@ -24,19 +39,22 @@ func (f *fakeNoteRepo) GetByID(ctx context.Context, noteID, uid int64) (domain.N
 	return f.getByIDFn(ctx, noteID, uid)
 }
 
-func (f *fakeNoteRepo) Update(ctx context.Context, note domain.Note) error {
+func (f *fakeNoteRepo) Update(ctx context.Context, note domain.Note) (int64, error) {
 	if f.updateFn == nil {
 		panic("fakeNoteRepo.updateFn not set")
 	}
 	f.lastNote = note
-	return f.updateFn(ctx, note)
+	if err := f.updateFn(ctx, note); err != nil {
+		return 0, err
+	}
+	return note.Version + 1, nil
 }
 
-func (f *fakeNoteRepo) RemoveByID(ctx context.Context, noteID, uid int64) error {
+func (f *fakeNoteRepo) RemoveByID(ctx context.Context, noteID, uid, version int64) error {
 	if f.removeByIDFn == nil {
 		panic("fakeNoteRepo.removeByIDFn not set")
 	}
-	f.lastNoteID, f.lastUID = noteID, uid
+	f.lastNoteID, f.lastUID, f.lastVersion = noteID, uid, version
 	return f.removeByIDFn(ctx, noteID, uid)
 }
 
@@ -47,3 +65,602 @@ func (f *fakeNoteRepo) Create(ctx context.Context, note domain.Note) (domain.Not
 	f.lastNote = note
 	return f.createFn(ctx, note)
 }
+
+func (f *fakeNoteRepo) List(ctx context.Context, uid int64, filter domain.NoteFilter, limit, offset int) ([]domain.Note, error) {
+	if f.listFn == nil {
+		panic("fakeNoteRepo.listFn not set")
+	}
+	f.lastUID = uid
+	return f.listFn(ctx, uid, filter, limit, offset)
+}
+
+func (f *fakeNoteRepo) SetArchived(ctx context.Context, noteID, uid int64, archived bool) error {
+	if f.setArchivedFn == nil {
+		panic("fakeNoteRepo.setArchivedFn not set")
+	}
+	f.lastNoteID, f.lastUID = noteID, uid
+	return f.setArchivedFn(ctx, noteID, uid, archived)
+}
+
+func (f *fakeNoteRepo) TagCounts(ctx context.Context, uid int64) ([]domain.TagCount, error) {
+	panic("fakeNoteRepo.TagCounts not expected")
+}
+
+func (f *fakeNoteRepo) ListDeleted(ctx context.Context, uid int64, limit, offset int) ([]domain.Note, error) {
+	panic("fakeNoteRepo.ListDeleted not expected")
+}
+
+func (f *fakeNoteRepo) ListRevisions(ctx context.Context, noteID, uid int64, limit, offset int) ([]domain.NoteRevision, error) {
+	panic("fakeNoteRepo.ListRevisions not expected")
+}
+
+func (f *fakeNoteRepo) GetRevision(ctx context.Context, noteID, revisionID, uid int64) (domain.NoteRevision, error) {
+	rev, ok := f.revisions[revisionID]
+	if !ok || rev.NoteID != noteID || rev.UserID != uid {
+		return domain.NoteRevision{}, gorm.ErrRecordNotFound
+	}
+	return rev, nil
+}
+
+func (f *fakeNoteRepo) PruneRevisions(ctx context.Context, noteID, uid int64, keep int) error {
+	f.prunedTo = keep
+	return f.pruneErr
+}
+
+func (f *fakeNoteRepo) Restore(ctx context.Context, noteID, uid int64) error {
+	if f.restoreFn == nil {
+		panic("fakeNoteRepo.restoreFn not set")
+	}
+	f.lastNoteID, f.lastUID = noteID, uid
+	return f.restoreFn(ctx, noteID, uid)
+}
+
+func (f *fakeNoteRepo) DeletePermanently(ctx context.Context, noteID, uid int64) error {
+	if f.purgeFn == nil {
+		panic("fakeNoteRepo.purgeFn not set")
+	}
+	f.lastNoteID, f.lastUID = noteID, uid
+	return f.purgeFn(ctx, noteID, uid)
+}
+
+type fakeUserRepo struct {
+	users  map[int64]domain.User
+	nextID int64
+}
+
+func newFakeUserRepo(users ...domain.User) *fakeUserRepo {
+	f := &fakeUserRepo{users: make(map[int64]domain.User)}
+	for _, u := range users {
+		f.users[u.ID] = u
+		if u.ID > f.nextID {
+			f.nextID = u.ID
+		}
+	}
+	return f
+}
+
+func (f *fakeUserRepo) Register(ctx context.Context, user domain.User) (domain.User, error) {
+	for _, u := range f.users {
+		if u.Email == user.Email {
+			return domain.User{}, gorm.ErrDuplicatedKey
+		}
+	}
+	f.nextID++
+	user.ID = f.nextID
+	f.users[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeUserRepo) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, uid int64) (domain.User, error) {
+	u, ok := f.users[uid]
+	if !ok {
+		return domain.User{}, gorm.ErrRecordNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, uid int64, at time.Time) error {
+	u, ok := f.users[uid]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.EmailVerifiedAt = &at
+	f.users[uid] = u
+	return nil
+}
+
+func (f *fakeUserRepo) UpdateEmail(ctx context.Context, uid int64, email string) error {
+	u, ok := f.users[uid]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	for _, other := range f.users {
+		if other.Email == email && other.ID != uid {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	u.Email, u.EmailVerifiedAt = email, nil
+	f.users[uid] = u
+	return nil
+}
+
+func (f *fakeUserRepo) UpdatePasswordHash(ctx context.Context, uid int64, hash string) error {
+	u, ok := f.users[uid]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.PasswordHash = hash
+	f.users[uid] = u
+	return nil
+}
+
+func (f *fakeUserRepo) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	var out []domain.User
+	for id := int64(1); id <= f.nextID; id++ {
+		if u, ok := f.users[id]; ok {
+			out = append(out, u)
+		}
+	}
+	if offset >= len(out) {
+		return nil, nil
+	}
+	out = out[offset:]
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (f *fakeUserRepo) update(uid int64, fn func(*domain.User)) error {
+	u, ok := f.users[uid]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	fn(&u)
+	f.users[uid] = u
+	return nil
+}
+
+func (f *fakeUserRepo) SetRole(ctx context.Context, uid int64, role string) error {
+	return f.update(uid, func(u *domain.User) { u.Role = role })
+}
+
+func (f *fakeUserRepo) SetDisabled(ctx context.Context, uid int64, at *time.Time) error {
+	return f.update(uid, func(u *domain.User) { u.DisabledAt = at })
+}
+
+func (f *fakeUserRepo) SetPasswordResetRequired(ctx context.Context, uid int64, required bool) error {
+	return f.update(uid, func(u *domain.User) { u.PasswordResetRequired = required })
+}
+
+func (f *fakeUserRepo) SetSuspended(ctx context.Context, uid int64, until *time.Time) error {
+	return f.update(uid, func(u *domain.User) { u.SuspendedUntil = until })
+}
+
+func (f *fakeUserRepo) Delete(ctx context.Context, uid int64) error {
+	if _, ok := f.users[uid]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(f.users, uid)
+	return nil
+}
+
+type fakeRefreshRepo struct {
+	tokens []domain.RefreshToken
+}
+
+func (f *fakeRefreshRepo) Create(ctx context.Context, token domain.RefreshToken) (domain.RefreshToken, error) {
+	token.ID = int64(len(f.tokens) + 1)
+	f.tokens = append(f.tokens, token)
+	return token, nil
+}
+
+func (f *fakeRefreshRepo) GetByHash(ctx context.Context, hash string) (domain.RefreshToken, error) {
+	for _, t := range f.tokens {
+		if t.TokenHash == hash {
+			return t, nil
+		}
+	}
+	return domain.RefreshToken{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeRefreshRepo) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	t := &f.tokens[id-1]
+	if t.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return true, nil
+}
+
+func (f *fakeRefreshRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	for i := range f.tokens {
+		if f.tokens[i].FamilyID == familyID && f.tokens[i].RevokedAt == nil {
+			f.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeRefreshRepo) RevokeAllForUser(ctx context.Context, uid int64) error {
+	now := time.Now()
+	for i := range f.tokens {
+		if f.tokens[i].UserID == uid && f.tokens[i].RevokedAt == nil {
+			f.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeRevocationStore struct {
+	jtis    map[string]bool
+	cutoffs map[int64]time.Time
+}
+
+func newFakeRevocationStore() *fakeRevocationStore {
+	return &fakeRevocationStore{jtis: map[string]bool{}, cutoffs: map[int64]time.Time{}}
+}
+
+func (f *fakeRevocationStore) RevokeToken(ctx context.Context, jti string, uid int64, expiresAt time.Time) error {
+	f.jtis[jti] = true
+	return nil
+}
+
+func (f *fakeRevocationStore) RevokeAllForUser(ctx context.Context, uid int64, before time.Time) error {
+	f.cutoffs[uid] = before
+	return nil
+}
+
+func (f *fakeRevocationStore) IsRevoked(ctx context.Context, jti string, uid int64, issuedAt time.Time) (bool, error) {
+	cutoff, ok := f.cutoffs[uid]
+	return f.jtis[jti] || (ok && domain.RevokedByCutoff(issuedAt, cutoff)), nil
+}
+
+type fakeMFARepo struct {
+	rows  map[int64]domain.UserMFA
+	codes []domain.RecoveryCode
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{rows: map[int64]domain.UserMFA{}}
+}
+
+func (f *fakeMFARepo) Get(ctx context.Context, uid int64) (domain.UserMFA, error) {
+	m, ok := f.rows[uid]
+	if !ok {
+		return domain.UserMFA{}, gorm.ErrRecordNotFound
+	}
+	return m, nil
+}
+
+func (f *fakeMFARepo) Upsert(ctx context.Context, mfa domain.UserMFA) error {
+	if m, ok := f.rows[mfa.UserID]; ok && m.EnabledAt != nil {
+		return nil
+	}
+	f.rows[mfa.UserID] = mfa
+	return nil
+}
+
+func (f *fakeMFARepo) Enable(ctx context.Context, uid int64, step int64) error {
+	m := f.rows[uid]
+	now := time.Now()
+	m.EnabledAt, m.LastUsedStep = &now, step
+	f.rows[uid] = m
+	return nil
+}
+
+func (f *fakeMFARepo) Delete(ctx context.Context, uid int64) error {
+	delete(f.rows, uid)
+	return f.ReplaceRecoveryCodes(ctx, uid, nil)
+}
+
+func (f *fakeMFARepo) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	m, ok := f.rows[uid]
+	if !ok || m.LastUsedStep >= step {
+		return false, nil
+	}
+	m.LastUsedStep = step
+	f.rows[uid] = m
+	return true, nil
+}
+
+func (f *fakeMFARepo) ReplaceRecoveryCodes(ctx context.Context, uid int64, hashes []string) error {
+	kept := f.codes[:0]
+	for _, c := range f.codes {
+		if c.UserID != uid {
+			kept = append(kept, c)
+		}
+	}
+	f.codes = kept
+	for _, h := range hashes {
+		f.codes = append(f.codes, domain.RecoveryCode{UserID: uid, CodeHash: h})
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(ctx context.Context, uid int64, hash string) (bool, error) {
+	for i, c := range f.codes {
+		if c.UserID == uid && c.CodeHash == hash && c.UsedAt == nil {
+			now := time.Now()
+			f.codes[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeMFARepo) ListAfter(ctx context.Context, afterUID int64, limit int) ([]domain.UserMFA, error) {
+	var out []domain.UserMFA
+	for uid, m := range f.rows {
+		if uid > afterUID {
+			out = append(out, m)
+		}
+	}
+	slices.SortFunc(out, func(a, b domain.UserMFA) int { return cmp.Compare(a.UserID, b.UserID) })
+	return out[:min(limit, len(out))], nil
+}
+
+func (f *fakeMFARepo) CountNotWrappedBy(ctx context.Context, masterKeyID string) (int64, error) {
+	var n int64
+	for _, m := range f.rows {
+		if m.SecretKeyID != masterKeyID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeMFARepo) Rewrap(ctx context.Context, mfa domain.UserMFA, fromWrapped []byte) error {
+	m, ok := f.rows[mfa.UserID]
+	if !ok || !bytes.Equal(m.SecretWrapped, fromWrapped) {
+		return gorm.ErrRecordNotFound
+	}
+	m.SecretKeyID, m.SecretWrapped = mfa.SecretKeyID, mfa.SecretWrapped
+	f.rows[mfa.UserID] = m
+	return nil
+}
+
+type fakeOneTimeTokenRepo struct {
+	tokens []domain.OneTimeToken
+}
+
+func (f *fakeOneTimeTokenRepo) Create(ctx context.Context, token domain.OneTimeToken) (domain.OneTimeToken, error) {
+	token.ID = int64(len(f.tokens) + 1)
+	f.tokens = append(f.tokens, token)
+	return token, nil
+}
+
+func (f *fakeOneTimeTokenRepo) GetByHash(ctx context.Context, purpose, hash string) (domain.OneTimeToken, error) {
+	for _, t := range f.tokens {
+		if t.Purpose == purpose && t.TokenHash == hash {
+			return t, nil
+		}
+	}
+	return domain.OneTimeToken{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeOneTimeTokenRepo) Consume(ctx context.Context, id int64) (bool, error) {
+	for i := range f.tokens {
+		if f.tokens[i].ID == id && f.tokens[i].UsedAt == nil {
+			now := time.Now()
+			f.tokens[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeOneTimeTokenRepo) InvalidateForUser(ctx context.Context, uid int64, purpose string) error {
+	now := time.Now()
+	for i := range f.tokens {
+		if f.tokens[i].UserID == uid && f.tokens[i].Purpose == purpose && f.tokens[i].UsedAt == nil {
+			f.tokens[i].UsedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeMailer struct {
+	sent []mail.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// lastToken extracts the ?token= value from the last message sent.
+func (f *fakeMailer) lastToken() string {
+	if len(f.sent) == 0 {
+		return ""
+	}
+	body := f.sent[len(f.sent)-1].Body
+	_, after, ok := strings.Cut(body, "?token=")
+	if !ok {
+		return ""
+	}
+	return strings.Fields(after)[0]
+}
+
+type fakePersonalTokenRepo struct {
+	tokens []domain.PersonalAccessToken
+}
+
+func (f *fakePersonalTokenRepo) Create(ctx context.Context, token domain.PersonalAccessToken) (domain.PersonalAccessToken, error) {
+	token.ID = int64(len(f.tokens) + 1)
+	token.CreatedAt = time.Now()
+	f.tokens = append(f.tokens, token)
+	return token, nil
+}
+
+func (f *fakePersonalTokenRepo) GetByHash(ctx context.Context, hash string) (domain.PersonalAccessToken, error) {
+	for _, t := range f.tokens {
+		if t.TokenHash == hash {
+			return t, nil
+		}
+	}
+	return domain.PersonalAccessToken{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakePersonalTokenRepo) ListByUser(ctx context.Context, uid int64) ([]domain.PersonalAccessToken, error) {
+	var out []domain.PersonalAccessToken
+	for _, t := range f.tokens {
+		if t.UserID == uid {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakePersonalTokenRepo) Delete(ctx context.Context, id, uid int64) error {
+	for i, t := range f.tokens {
+		if t.ID == id && t.UserID == uid {
+			f.tokens = append(f.tokens[:i], f.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakePersonalTokenRepo) DeleteAllForUser(ctx context.Context, uid int64) error {
+	kept := f.tokens[:0]
+	for _, t := range f.tokens {
+		if t.UserID != uid {
+			kept = append(kept, t)
+		}
+	}
+	f.tokens = kept
+	return nil
+}
+
+func (f *fakePersonalTokenRepo) Touch(ctx context.Context, id int64, at time.Time) error {
+	for i := range f.tokens {
+		if f.tokens[i].ID == id {
+			f.tokens[i].LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+type fakeSessionRepo struct {
+	sessions []domain.Session
+}
+
+func (f *fakeSessionRepo) Create(ctx context.Context, session domain.Session) (domain.Session, error) {
+	f.sessions = append(f.sessions, session)
+	return session, nil
+}
+
+func (f *fakeSessionRepo) Get(ctx context.Context, id string) (domain.Session, error) {
+	for _, s := range f.sessions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return domain.Session{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeSessionRepo) ListActive(ctx context.Context, uid int64, now time.Time) ([]domain.Session, error) {
+	var out []domain.Session
+	for _, s := range f.sessions {
+		if s.UserID == uid && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSessionRepo) Touch(ctx context.Context, id string, at time.Time) error {
+	for i := range f.sessions {
+		if f.sessions[i].ID == id {
+			f.sessions[i].LastUsedAt = at
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionRepo) Renew(ctx context.Context, id string, at, expiresAt time.Time) error {
+	for i := range f.sessions {
+		if f.sessions[i].ID == id {
+			f.sessions[i].LastUsedAt = at
+			f.sessions[i].ExpiresAt = expiresAt
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakeSessionRepo) Revoke(ctx context.Context, id string, uid int64) error {
+	for i := range f.sessions {
+		if f.sessions[i].ID == id && f.sessions[i].UserID == uid && f.sessions[i].RevokedAt == nil {
+			now := time.Now()
+			f.sessions[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakeSessionRepo) RevokeAllForUser(ctx context.Context, uid int64) error {
+	now := time.Now()
+	for i := range f.sessions {
+		if f.sessions[i].UserID == uid && f.sessions[i].RevokedAt == nil {
+			f.sessions[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeIdentityRepo struct {
+	identities []domain.UserIdentity
+}
+
+func (f *fakeIdentityRepo) Get(ctx context.Context, issuer, subject string) (domain.UserIdentity, error) {
+	for _, i := range f.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return domain.UserIdentity{}, gorm.ErrRecordNotFound
+}
+
+func (f *fakeIdentityRepo) Create(ctx context.Context, identity domain.UserIdentity) (domain.UserIdentity, error) {
+	if _, err := f.Get(ctx, identity.Issuer, identity.Subject); err == nil {
+		return domain.UserIdentity{}, gorm.ErrDuplicatedKey
+	}
+	identity.ID = int64(len(f.identities) + 1)
+	f.identities = append(f.identities, identity)
+	return identity, nil
+}
+
+type fakeOIDCRequestRepo struct {
+	requests map[string]domain.OIDCAuthRequest
+}
+
+func (f *fakeOIDCRequestRepo) Create(ctx context.Context, req domain.OIDCAuthRequest) error {
+	if f.requests == nil {
+		f.requests = make(map[string]domain.OIDCAuthRequest)
+	}
+	f.requests[req.StateHash] = req
+	return nil
+}
+
+func (f *fakeOIDCRequestRepo) Take(ctx context.Context, stateHash string) (domain.OIDCAuthRequest, error) {
+	req, ok := f.requests[stateHash]
+	if !ok {
+		return domain.OIDCAuthRequest{}, gorm.ErrRecordNotFound
+	}
+	delete(f.requests, stateHash)
+	return req, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"gorm.io/gorm"
+)
+
+const (
+	// sessionTouchEvery limits last_used_at writes to one per interval.
+	sessionTouchEvery = time.Minute
+	maxUserAgent      = 512
+)
+
+var (
+	ErrSessionsDisabled = errors.New("sessions are not enabled")
+	ErrSessionNotFound  = errors.New("session not found")
+)
+
+// WithSessions records every login as a session the user can list and
+// revoke. Access tokens carrying a revoked session are rejected.
+func WithSessions(repo domain.SessionRepository) AuthOption {
+	return func(u *UserAuth) {
+		u.sessions = repo
+	}
+}
+
+type userAgentKey struct{}
+
+// WithUserAgent records the caller's User-Agent for the session list.
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, userAgent)
+}
+
+func userAgent(ctx context.Context) string {
+	ua, _ := ctx.Value(userAgentKey{}).(string)
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	// Headers are bytes; the column is text.
+	return strings.ToValidUTF8(ua, "")
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (u *UserAuth) ListSessions(ctx context.Context, uid int64) ([]domain.Session, error) {
+	if u.sessions == nil {
+		return nil, ErrSessionsDisabled
+	}
+	return u.sessions.ListActive(ctx, uid, time.Now())
+}
+
+// RevokeSession signs a session out: its access tokens stop authenticating
+// and its refresh tokens can no longer be redeemed.
+func (u *UserAuth) RevokeSession(ctx context.Context, uid int64, id string) error {
+	if u.sessions == nil {
+		return ErrSessionsDisabled
+	}
+	if err := u.sessions.Revoke(ctx, id, uid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	if u.refresh != nil {
+		return u.refresh.RevokeFamily(ctx, id)
+	}
+	return nil
+}
+
+// sessionTTL matches how long the login can be kept alive.
+func (u *UserAuth) sessionTTL() time.Duration {
+	if u.refresh != nil {
+		return u.refreshTTL
+	}
+	return u.jwt.TTL
+}
+
+func (u *UserAuth) createSession(ctx context.Context, uid int64, id string, now time.Time) error {
+	if u.sessions == nil {
+		return nil
+	}
+	_, err := u.sessions.Create(ctx, domain.Session{
+		ID:         id,
+		UserID:     uid,
+		UserAgent:  userAgent(ctx),
+		IP:         clientIP(ctx),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(u.sessionTTL()),
+	})
+	return err
+}
+
+// renewSession extends a session when its refresh token is redeemed. Refresh
+// families started before sessions were recorded get one on first refresh.
+func (u *UserAuth) renewSession(ctx context.Context, uid int64, id string, now time.Time) error {
+	if u.sessions == nil {
+		return nil
+	}
+	err := u.sessions.Renew(ctx, id, now, now.Add(u.sessionTTL()))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return u.createSession(ctx, uid, id, now)
+	}
+	return err
+}
+
+// checkSession rejects access tokens whose session was revoked. Tokens
+// without a sid predate sessions and are left to expire.
+func (u *UserAuth) checkSession(ctx context.Context, claims security.Claims) error {
+	if u.sessions == nil || claims.SessionID == "" {
+		return nil
+	}
+	s, err := u.sessions.Get(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return security.ErrTokenRevoked
+		}
+		return err
+	}
+	if s.UserID != claims.UserID || s.RevokedAt != nil {
+		return security.ErrTokenRevoked
+	}
+	if now := time.Now(); now.Sub(s.LastUsedAt) >= sessionTouchEvery {
+		// Usage tracking is informational; never fail a request over it.
+		_ = u.sessions.Touch(ctx, s.ID, now)
+	}
+	return nil
+}
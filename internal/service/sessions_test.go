@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/security"
+	"github.com/secure-notes/internal/service"
+)
+
+func TestUserAuth_Login_RecordsSession(t *testing.T) {
+	sessions := &fakeSessionRepo{}
+	svc, _ := newTestAuth(t, service.WithSessions(sessions))
+	ctx := service.WithUserAgent(service.WithClientIP(context.Background(), "203.0.113.7"), "curl/8.0")
+
+	res, err := svc.Login(ctx, domain.User{Email: "a@example.com", PasswordHash: testPassword})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	p, err := svc.Authenticate(context.Background(), res.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	list, err := svc.ListSessions(context.Background(), p.UserID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one session, got %v %v", list, err)
+	}
+	s := list[0]
+	if s.ID != p.SessionID || s.IP != "203.0.113.7" || s.UserAgent != "curl/8.0" {
+		t.Fatalf("unexpected session: %+v (principal sid %q)", s, p.SessionID)
+	}
+}
+
+func TestUserAuth_RevokeSession(t *testing.T) {
+	sessions := &fakeSessionRepo{}
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithSessions(sessions), service.WithRefreshTokens(refresh, time.Hour))
+	ctx := context.Background()
+
+	phone := login(t, svc)
+	laptop := login(t, svc)
+	p, err := svc.Authenticate(ctx, phone.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	if err = svc.RevokeSession(ctx, 2, p.SessionID); !errors.Is(err, service.ErrSessionNotFound) {
+		t.Fatalf("other users must not revoke the session, got: %v", err)
+	}
+	if err = svc.RevokeSession(ctx, p.UserID, p.SessionID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, phone.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("revoked session still authenticates: %v", err)
+	}
+	if _, err = svc.Refresh(ctx, phone.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("revoked session still refreshes: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, laptop.AccessToken); err != nil {
+		t.Fatalf("other sessions must survive: %v", err)
+	}
+	if err = svc.RevokeSession(ctx, p.UserID, p.SessionID); !errors.Is(err, service.ErrSessionNotFound) {
+		t.Fatalf("revoking twice should report not found, got: %v", err)
+	}
+}
+
+func TestUserAuth_Refresh_KeepsSession(t *testing.T) {
+	sessions := &fakeSessionRepo{}
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithSessions(sessions), service.WithRefreshTokens(refresh, time.Hour))
+	ctx := context.Background()
+
+	first := login(t, svc)
+	p1, _ := svc.Authenticate(ctx, first.AccessToken)
+	next, err := svc.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	p2, err := svc.Authenticate(ctx, next.AccessToken)
+	if err != nil || p2.SessionID != p1.SessionID {
+		t.Fatalf("refresh should stay in session %q, got %q (%v)", p1.SessionID, p2.SessionID, err)
+	}
+	if len(sessions.sessions) != 1 {
+		t.Fatalf("refresh must not start a session: %d", len(sessions.sessions))
+	}
+}
+
+func TestUserAuth_Refresh_AdoptsLegacyFamily(t *testing.T) {
+	sessions := &fakeSessionRepo{}
+	refresh := &fakeRefreshRepo{}
+	svc, _ := newTestAuth(t, service.WithSessions(sessions), service.WithRefreshTokens(refresh, time.Hour))
+	ctx := context.Background()
+
+	res := login(t, svc)
+	sessions.sessions = nil // as if the family predates the sessions table
+
+	next, err := svc.Refresh(ctx, res.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err = svc.Authenticate(ctx, next.AccessToken); err != nil {
+		t.Fatalf("adopted session should authenticate: %v", err)
+	}
+	if len(sessions.sessions) != 1 || sessions.sessions[0].ID != refresh.tokens[0].FamilyID {
+		t.Fatalf("expected a session for the family, got %+v", sessions.sessions)
+	}
+}
+
+func TestUserAuth_LogoutAll_RevokesSessions(t *testing.T) {
+	sessions := &fakeSessionRepo{}
+	svc, _ := newTestAuth(t, service.WithSessions(sessions))
+	ctx := context.Background()
+
+	res := login(t, svc)
+	login(t, svc)
+	p, _ := svc.Authenticate(ctx, res.AccessToken)
+	if err := svc.LogoutAll(ctx, p.UserID); err != nil {
+		t.Fatalf("logout all: %v", err)
+	}
+	if list, _ := svc.ListSessions(ctx, p.UserID); len(list) != 0 {
+		t.Fatalf("expected no active sessions, got %d", len(list))
+	}
+	if _, err := svc.Authenticate(ctx, res.AccessToken); !errors.Is(err, security.ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked, got: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+)
+
+const defaultPurgeBatch = 500
+
+// TrashPurger permanently deletes notes that have been in the trash for
+// longer than the retention period.
+type TrashPurger struct {
+	notes     domain.NoteMaintenanceRepository
+	retention time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+func NewTrashPurger(notes domain.NoteMaintenanceRepository, retention time.Duration) *TrashPurger {
+	return &TrashPurger{notes: notes, retention: retention, batchSize: defaultPurgeBatch, now: time.Now}
+}
+
+// PurgeOnce empties the trash of every user up to the retention cutoff, in
+// batches so a large backlog does not hold one long transaction.
+func (p *TrashPurger) PurgeOnce(ctx context.Context) (int64, error) {
+	cutoff := p.now().Add(-p.retention)
+	var total int64
+	for {
+		n, err := p.notes.PurgeDeletedBefore(ctx, cutoff, p.batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(p.batchSize) {
+			return total, nil
+		}
+		if err = ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// Run purges once and then every interval until ctx is cancelled. report,
+// when set, is told the outcome of each pass; a failed pass is retried on the
+// next tick.
+func (p *TrashPurger) Run(ctx context.Context, interval time.Duration, report func(purged int64, err error)) {
+	runEvery(ctx, interval, p.PurgeOnce, report)
+}
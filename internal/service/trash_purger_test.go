@@ -0,0 +1,60 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/secure-notes/internal/domain"
+	"github.com/secure-notes/internal/service"
+)
+
+func TestTrashPurger_PurgeOnce(t *testing.T) {
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	notes := &memNoteStore{}
+	for id := int64(1); id <= 1200; id++ {
+		notes.rows = append(notes.rows, domain.Note{ID: id, DeletedAt: &old})
+	}
+	notes.rows = append(notes.rows,
+		domain.Note{ID: 1201, DeletedAt: &recent},
+		domain.Note{ID: 1202},
+	)
+
+	purged, err := service.NewTrashPurger(notes, 30*24*time.Hour).PurgeOnce(context.Background())
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 1200 {
+		t.Fatalf("purged %d notes, want 1200", purged)
+	}
+	if notes.purgeCalls != 3 {
+		t.Fatalf("expected 3 batches, got %d", notes.purgeCalls)
+	}
+	if len(notes.rows) != 2 || notes.rows[0].ID != 1201 || notes.rows[1].ID != 1202 {
+		t.Fatalf("unexpected notes left: %+v", notes.rows)
+	}
+}
+
+func TestTrashPurger_RunStopsOnCancel(t *testing.T) {
+	notes := &memNoteStore{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	passes := 0
+	go func() {
+		service.NewTrashPurger(notes, time.Hour).Run(ctx, time.Hour, func(int64, error) {
+			passes++
+			cancel()
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if passes != 1 {
+		t.Fatalf("expected one pass before the first tick, got %d", passes)
+	}
+}
@@ -0,0 +1,230 @@
+// Package textdiff compares texts line by line and renders the result as a
+// unified diff, the format produced by diff -u and git diff.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Op is one line of an edit script turning a into b. Lines keep their
+// trailing newline, so a missing newline at the end of a text is a change.
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// maxEdits bounds the search for a shortest edit script, whose memory grows
+// with the square of the number of edits. Beyond it the differing middle
+// is reported as replaced wholesale: still correct, just not minimal.
+const maxEdits = 1000
+
+// Lines returns an edit script from a to b with as few deletions and
+// insertions as possible, using Myers' algorithm.
+func Lines(a, b []string) []Op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, Op{Equal, l})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Equal, l})
+	}
+	return ops
+}
+
+func myers(a, b []string) []Op {
+	n, m := len(a), len(b)
+	// Every edit script needs at least |n-m| edits.
+	if n == 0 || m == 0 || max(n-m, m-n) > maxEdits {
+		return replace(a, b)
+	}
+	// v[k+offset] is the furthest x reached on diagonal k = x-y. trace keeps
+	// v as it was before each round d, for walking the path back.
+	offset := maxEdits + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	found := false
+	for d := 0; d <= maxEdits && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replace(a, b)
+	}
+
+	ops := make([]Op, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// trace[d] covers diagonals -d..d; at index i lies diagonal i-d.
+		prev := func(k int) int {
+			if k < -d || k > d {
+				return -1
+			}
+			return trace[d][k+d]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || k != d && prev(k-1) < prev(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = prev(prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, Op{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, Op{Insert, b[y-1]})
+			} else {
+				ops = append(ops, Op{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func replace(a, b []string) []Op {
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, l := range a {
+		ops = append(ops, Op{Delete, l})
+	}
+	for _, l := range b {
+		ops = append(ops, Op{Insert, l})
+	}
+	return ops
+}
+
+// SplitLines splits s after every newline. The last line has no newline if
+// s does not end with one.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Unified renders the difference between a and b as a unified diff with
+// context unchanged lines around each change. It returns "" when the texts
+// are equal.
+func Unified(fromName, toName, a, b string, context int) string {
+	ops := Lines(SplitLines(a), SplitLines(b))
+	// aPos[i] and bPos[i] count the lines of a and b before ops[i].
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.Kind != Insert {
+			aPos[i+1]++
+		}
+		if op.Kind != Delete {
+			bPos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].Kind == Equal {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		start := max(i-context, 0)
+		end := i
+		for {
+			for end < len(ops) && ops[end].Kind != Equal {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].Kind == Equal {
+				next++
+			}
+			// Changes close enough to share context go in one hunk.
+			if next < len(ops) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end = min(end+context, len(ops))
+			break
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(" -+"[op.Kind])
+			out.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk's line range the way diff -u does: 1-based, the
+// count left out when it is 1, and an empty range placed after line before.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
@@ -0,0 +1,103 @@
+package textdiff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/secure-notes/internal/textdiff"
+)
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	want := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+ six
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	if got := textdiff.Unified("a", "b", a, b, 3); got != want {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnified_MergesNearbyChanges(t *testing.T) {
+	got := textdiff.Unified("a", "b", "1\n2\n3\n4\n5\n", "1\nx\n3\n4\ny\n", 1)
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ 1
+-2
++x
+ 3
+ 4
+-5
++y
+`
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnified_EdgeCases(t *testing.T) {
+	if got := textdiff.Unified("a", "b", "same\n", "same\n", 3); got != "" {
+		t.Fatalf("equal texts should give no diff, got:\n%s", got)
+	}
+	got := textdiff.Unified("a", "b", "", "new\n", 3)
+	if want := "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n"; got != want {
+		t.Fatalf("unexpected diff from empty text:\n%s", got)
+	}
+	got = textdiff.Unified("a", "b", "line\n", "line", 3)
+	want := "--- a\n+++ b\n@@ -1 +1 @@\n-line\n+line\n\\ No newline at end of file\n"
+	if got != want {
+		t.Fatalf("unexpected diff for a dropped final newline:\n%s", got)
+	}
+}
+
+func TestLines_Minimal(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	ops := textdiff.Lines(a, b)
+
+	var from, to []string
+	edits := 0
+	for _, op := range ops {
+		if op.Kind != textdiff.Insert {
+			from = append(from, op.Line)
+		}
+		if op.Kind != textdiff.Delete {
+			to = append(to, op.Line)
+		}
+		if op.Kind != textdiff.Equal {
+			edits++
+		}
+	}
+	if strings.Join(from, " ") != strings.Join(a, " ") || strings.Join(to, " ") != strings.Join(b, " ") {
+		t.Fatalf("script does not turn a into b: %+v", ops)
+	}
+	if edits != 5 {
+		t.Fatalf("expected 5 edits, got %d: %+v", edits, ops)
+	}
+}
+
+func TestLines_LargeInputsFallBack(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 3000; i++ {
+		a = append(a, "a")
+		b = append(b, "b")
+	}
+	ops := textdiff.Lines(a, b)
+	if len(ops) != 6000 || ops[0].Kind != textdiff.Delete || ops[5999].Kind != textdiff.Insert {
+		t.Fatalf("expected a wholesale replacement, got %d ops", len(ops))
+	}
+}
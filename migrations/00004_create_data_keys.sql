@@ -0,0 +1,19 @@
+-- +goose Up
+-- 00004_create_data_keys.sql
+CREATE TABLE IF NOT EXISTS data_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    master_key_id TEXT NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_keys_user_id ON data_keys(user_id);
+
+-- key_id is NULL for rows written before encryption was enabled.
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS key_id BIGINT REFERENCES data_keys(id);
+
+-- +goose Down
+ALTER TABLE notes DROP COLUMN IF EXISTS key_id;
+DROP TABLE IF EXISTS data_keys;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- 00005_create_key_rotation_jobs.sql
+CREATE TABLE IF NOT EXISTS key_rotation_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    master_key_id TEXT NOT NULL,
+    new_data_keys BOOLEAN NOT NULL DEFAULT false,
+    reencrypt_notes BOOLEAN NOT NULL DEFAULT false,
+    phase TEXT NOT NULL,
+    cursor BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_keys_master_key_id ON data_keys(master_key_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_data_keys_master_key_id;
+DROP TABLE IF EXISTS key_rotation_jobs;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- 00006_client_encrypted_notes.sql
+-- Metadata of notes encrypted by the client; content then holds the opaque payload.
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS client_encryption JSONB;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS zero_knowledge BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS zero_knowledge;
+ALTER TABLE notes DROP COLUMN IF EXISTS client_encryption;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- 00010_create_login_attempts.sql
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    blocked_until TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_attempts;
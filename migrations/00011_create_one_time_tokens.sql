@@ -0,0 +1,16 @@
+-- +goose Up
+-- 00011_create_one_time_tokens.sql
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_one_time_tokens_user_purpose ON one_time_tokens(user_id, purpose);
+
+-- +goose Down
+DROP TABLE IF EXISTS one_time_tokens;
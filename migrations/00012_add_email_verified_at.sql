@@ -0,0 +1,6 @@
+-- +goose Up
+-- 00012_add_email_verified_at.sql
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- 00013_add_one_time_token_email.sql
+ALTER TABLE one_time_tokens ADD COLUMN IF NOT EXISTS email TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE one_time_tokens DROP COLUMN IF EXISTS email;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- 00017_add_user_roles.sql
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE users
+    ADD CONSTRAINT chk_users_role CHECK (role IN ('user', 'admin'));
+
+-- +goose Down
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS chk_users_role,
+    DROP COLUMN IF EXISTS password_reset_required,
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- 00018_add_user_suspension.sql
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_until;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- 00020_add_note_archived.sql
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS is_archived BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS is_archived;
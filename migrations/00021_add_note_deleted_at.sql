@@ -0,0 +1,13 @@
+-- +goose Up
+-- 00021_add_note_deleted_at.sql
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes (deleted_at)
+    WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_notes_deleted_at;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS deleted_at;
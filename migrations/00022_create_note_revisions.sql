@@ -0,0 +1,28 @@
+-- +goose Up
+-- 00022_create_note_revisions.sql
+-- Every saved version of a note, sealed like the note itself.
+CREATE TABLE IF NOT EXISTS note_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    note_id BIGINT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    -- A data key cannot go while revisions sealed with it remain; rotate-keys
+    -- --reencrypt-notes moves revisions off old keys along with notes.
+    key_id BIGINT REFERENCES data_keys(id) ON DELETE RESTRICT,
+    client_encryption JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_note_revisions_note_id ON note_revisions(note_id, id DESC);
+
+-- Existing notes start their history with their current version. Legacy
+-- plaintext rows are left out so no copy of them outlives their sealing;
+-- their history starts at their next save.
+INSERT INTO note_revisions (note_id, user_id, title, content, key_id, client_encryption, created_at)
+SELECT id, user_id, title, content, key_id, client_encryption, created_at
+FROM notes
+WHERE user_id IS NOT NULL AND (key_id IS NOT NULL OR client_encryption IS NOT NULL);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_revisions;
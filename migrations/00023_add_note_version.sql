@@ -0,0 +1,8 @@
+-- +goose Up
+-- 00023_add_note_version.sql
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS version;